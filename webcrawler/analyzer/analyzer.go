@@ -1,6 +1,7 @@
 package analyzer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
@@ -23,9 +24,11 @@ func genAnalyzerId() uint32 {
 // 分析器的接口类型。
 type Analyzer interface {
 	Id() uint32 // 获得ID。
+	// 根据规则分析响应并返回请求和条目。参数ctx被取消时，剩余的解析函数不会被调用。
 	Analyze(
+		ctx context.Context,
 		respParsers []ParseResponse,
-		resp base.Response) ([]base.Data, []error) // 根据规则分析响应并返回请求和条目。
+		resp base.Response) ([]base.Data, []error)
 }
 
 // 创建分析器。
@@ -43,6 +46,7 @@ func (analyzer *myAnalyzer) Id() uint32 {
 }
 
 func (analyzer *myAnalyzer) Analyze(
+	ctx context.Context,
 	respParsers []ParseResponse,
 	resp base.Response) (dataList []base.Data, errorList []error) {
 	if respParsers == nil {
@@ -62,12 +66,16 @@ func (analyzer *myAnalyzer) Analyze(
 	dataList = make([]base.Data, 0)
 	errorList = make([]error, 0)
 	for i, respParser := range respParsers {
+		if err := ctx.Err(); err != nil {
+			errorList = append(errorList, err)
+			break
+		}
 		if respParser == nil {
 			err := errors.New(fmt.Sprintf("The document parser [%d] is invalid!", i))
 			errorList = append(errorList, err)
 			continue
 		}
-		pDataList, pErrorList := respParser(httpResp, respDepth)
+		pDataList, pErrorList := respParser(ctx, httpResp, respDepth)
 		if pDataList != nil {
 			for _, pData := range pDataList {
 				dataList = appendDataList(dataList, pData, respDepth)
@@ -79,6 +87,9 @@ func (analyzer *myAnalyzer) Analyze(
 			}
 		}
 	}
+	if resp.Truncated() {
+		logger.Warnf("The response body has been truncated. (reqUrl=%s)\n", reqUrl)
+	}
 	return dataList, errorList
 }
 
@@ -93,7 +104,7 @@ func appendDataList(dataList []base.Data, data base.Data, respDepth uint32) []ba
 	}
 	newDepth := respDepth + 1
 	if req.Depth() != newDepth {
-		req = base.NewRequest(req.HttpReq(), newDepth)
+		req = req.WithDepth(newDepth)
 	}
 	return append(dataList, req)
 }
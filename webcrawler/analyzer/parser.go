@@ -1,9 +1,11 @@
 package analyzer
 
 import (
+	"context"
 	"net/http"
 	base "webcrawler/base"
 )
 
 // 被用于解析HTTP响应的函数类型。
-type ParseResponse func(httpResp *http.Response, respDepth uint32) ([]base.Data, []error)
+// 参数ctx被取消时，耗时的解析应尽快返回。
+type ParseResponse func(ctx context.Context, httpResp *http.Response, respDepth uint32) ([]base.Data, []error)
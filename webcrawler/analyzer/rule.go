@@ -0,0 +1,647 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	base "webcrawler/base"
+	"webcrawler/tool/xpath"
+)
+
+// 字段的类型。
+const (
+	FIELD_TEXT   = "text"   // 元素的文本。其中连续的空白字符会被合并为一个空格。这是默认的类型。
+	FIELD_ATTR   = "attr"   // 元素的属性值。
+	FIELD_URL    = "url"    // 元素的属性值（默认为href），它会被解析为绝对URL。
+	FIELD_HTML   = "html"   // 元素的内部HTML。
+	FIELD_OBJECT = "object" // 由子字段组成的对象。子字段的选择器相对于该元素。
+)
+
+// 条目中记录规则名称的键。
+const ITEM_KEY_RULE = "_rule"
+
+// 条目中记录页面URL的键。
+const ITEM_KEY_URL = "_url"
+
+// 提取规则的说明书。它可以由JSON或YAML格式的配置文件载入。JSON格式的文件的内容形如：
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "name": "post",
+//	      "url": "^https?://example\\.com/post/",
+//	      "scope": "article",
+//	      "fields": [
+//	        { "name": "title", "selector": "h1", "required": true },
+//	        { "name": "tags", "selector": ".tag", "list": true },
+//	        { "name": "cover", "selector": "img", "type": "url", "attr": "src" },
+//	        { "name": "price", "xpath": "normalize-space(.//*[@itemprop='price'])" },
+//	        { "name": "author", "selector": ".author", "type": "object", "fields": [
+//	          { "name": "name", "selector": ".name" },
+//	          { "name": "home", "selector": "a", "type": "url" }
+//	        ] }
+//	      ],
+//	      "follow": [
+//	        { "selector": "a.next", "include": ["/post/"] },
+//	        { "xpath": "//link[@rel='prev']/@href" }
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// YAML格式的文件使用相同的配置项名称，如：
+//
+//	rules:
+//	  - name: post
+//	    url: ^https?://example\.com/post/
+//	    scope: article
+//	    fields:
+//	      - { name: title, selector: h1, required: true }
+//	      - { name: tags, selector: .tag, list: true }
+//	    follow:
+//	      - { selector: a.next, include: [/post/] }
+type RuleSpec struct {
+	Rules []ExtractRule `json:"rules"` // 提取规则的列表。
+}
+
+// 提取规则。
+type ExtractRule struct {
+	Name string `json:"name"` // 名称。它会被记录在条目中（键为ITEM_KEY_RULE）。
+	// 页面URL需要匹配的正则表达式。为空则表示匹配所有页面。
+	Url string `json:"url,omitempty"`
+	// 条目的范围的CSS选择器。每个与之匹配的元素都会产生一个条目。
+	// 它与ScopeXPath都为空则表示整个页面只产生一个条目。
+	Scope string `json:"scope,omitempty"`
+	// 条目的范围的XPath表达式。它不能与Scope同时被指定。
+	ScopeXPath string       `json:"scopeXPath,omitempty"`
+	Fields     []FieldRule  `json:"fields,omitempty"` // 字段规则的列表。
+	Follow     []FollowRule `json:"follow,omitempty"` // 链接跟随规则的列表。
+}
+
+// 字段规则。
+type FieldRule struct {
+	Name string `json:"name"` // 名称，即其在条目中的键。
+	// 相对于条目范围（或上层对象）的CSS选择器。它与XPath都为空则表示范围本身。
+	Selector string `json:"selector,omitempty"`
+	// 以条目范围（或上层对象）为上下文节点的XPath表达式。它不能与Selector同时被指定。
+	// 对于FIELD_TEXT类型以及未指定属性的FIELD_URL类型，字段的值取自结果的字符串值，
+	// 因此它可以选择文本节点或属性，也可以是函数调用，如“a/@href”或“normalize-space(h1)”。
+	XPath string `json:"xpath,omitempty"`
+	Type  string `json:"type,omitempty"` // 类型。为空则表示FIELD_TEXT。
+	Attr  string `json:"attr,omitempty"` // 属性名称。只对FIELD_ATTR和FIELD_URL类型有效。
+	// 是否提取所有匹配的元素。若为true，则其值为列表，否则只提取第一个匹配的元素。
+	List bool `json:"list,omitempty"`
+	// 是否为必需的。若必需的字段没有值，则整个条目（或上层对象）会被丢弃。
+	Required bool        `json:"required,omitempty"`
+	Fields   []FieldRule `json:"fields,omitempty"` // 子字段规则的列表。只对FIELD_OBJECT类型有效。
+}
+
+// 链接跟随规则。
+type FollowRule struct {
+	Selector string `json:"selector,omitempty"` // 链接元素的CSS选择器。它与XPath都为空则表示“a[href]”。
+	Attr     string `json:"attr,omitempty"`     // 链接所在的属性的名称。为空则表示“href”。
+	// 链接的XPath表达式。链接取自结果的字符串值，如“//a[@rel='next']/@href”。它不能与Selector同时被指定。
+	XPath   string   `json:"xpath,omitempty"`
+	Include []string `json:"include,omitempty"` // 链接必须匹配的正则表达式的列表。只需匹配其中之一即可。
+	Exclude []string `json:"exclude,omitempty"` // 链接不能匹配的正则表达式的列表。它优先于Include。
+}
+
+// 从配置文件中载入提取规则的说明书。扩展名为“.yaml”或“.yml”的文件会被当作YAML格式，其他文件会被当作JSON格式。
+// 未知的配置项会被视为错误，以便及早发现拼写错误。
+func LoadRuleSpec(path string) (*RuleSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yamlToJson(data)
+		if err != nil {
+			errMsg := fmt.Sprintf("Invalid rule spec file %q: %s", path, err)
+			return nil, errors.New(errMsg)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var spec RuleSpec
+	if err := decoder.Decode(&spec); err != nil {
+		errMsg := fmt.Sprintf("Invalid rule spec file %q: %s", path, err)
+		return nil, errors.New(errMsg)
+	}
+	return &spec, nil
+}
+
+// 把YAML格式的内容转换为JSON格式，以使两种格式共用相同的配置项名称和检查。
+func yamlToJson(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// 从JSON或YAML格式的配置文件中载入提取规则的说明书（参见LoadRuleSpec函数），并据此创建响应解析函数。
+func LoadRuleParser(path string) (ParseResponse, error) {
+	spec, err := LoadRuleSpec(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRuleParser(spec)
+}
+
+// 依据提取规则的说明书创建响应解析函数。说明书会被检查并预先编译。
+// 该函数只解析状态码为2xx的HTML或XML响应，并会依次应用所有与页面URL匹配的规则。
+// 由于各响应解析函数共享同一个响应体，所有规则被编译为同一个函数，页面只会被读取和解析一次。
+// 它产生的条目包含各字段的值以及规则名称（键为ITEM_KEY_RULE）和页面URL（键为ITEM_KEY_URL）。
+// 它产生的请求均为GET请求，其中链接的片段部分已被去掉。
+func NewRuleParser(spec *RuleSpec) (ParseResponse, error) {
+	if spec == nil {
+		return nil, errors.New("The rule spec is nil!")
+	}
+	if len(spec.Rules) == 0 {
+		return nil, errors.New("The rule list is empty!")
+	}
+	names := make(map[string]bool)
+	rules := make([]*compiledRule, 0, len(spec.Rules))
+	for i, rule := range spec.Rules {
+		if rule.Name == "" {
+			return nil, errors.New(fmt.Sprintf("The name of the %dth rule is empty!", i))
+		}
+		if names[rule.Name] {
+			return nil, errors.New(fmt.Sprintf("Duplicate rule %q!", rule.Name))
+		}
+		names[rule.Name] = true
+		cRule, err := compileRule(rule)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid rule %q: %s", rule.Name, err))
+		}
+		rules = append(rules, cRule)
+	}
+	return (&ruleParser{rules: rules}).parse, nil
+}
+
+// 已编译的提取规则。
+type compiledRule struct {
+	name  string            // 名称。
+	url   *regexp.Regexp    // 页面URL需要匹配的正则表达式。为nil则表示匹配所有页面。
+	scope cascadia.Selector // 条目的范围的选择器。
+	// 条目的范围的XPath表达式。它与scope都为nil则表示整个页面。
+	scopeXPath *xpath.Expr
+	fields     []*compiledField  // 字段的列表。
+	follow     []*compiledFollow // 链接跟随规则的列表。
+}
+
+// 已编译的字段规则。
+type compiledField struct {
+	name      string            // 名称。
+	selector  cascadia.Selector // 选择器。
+	xpath     *xpath.Expr       // XPath表达式。它与selector都为nil则表示范围本身。
+	fieldType string            // 类型。
+	attr      string            // 属性名称。
+	list      bool              // 是否提取所有匹配的元素。
+	required  bool              // 是否为必需的。
+	fields    []*compiledField  // 子字段的列表。
+}
+
+// 已编译的链接跟随规则。
+type compiledFollow struct {
+	selector cascadia.Selector // 链接元素的选择器。
+	attr     string            // 链接所在的属性的名称。
+	xpath    *xpath.Expr       // 链接的XPath表达式。若其不为nil，则选择器和属性名称会被忽略。
+	include  []*regexp.Regexp  // 链接必须匹配的正则表达式的列表。
+	exclude  []*regexp.Regexp  // 链接不能匹配的正则表达式的列表。
+}
+
+// 编译提取规则。
+func compileRule(rule ExtractRule) (*compiledRule, error) {
+	cRule := &compiledRule{name: rule.Name}
+	var err error
+	if rule.Url != "" {
+		if cRule.url, err = compileRegex(rule.Url); err != nil {
+			return nil, err
+		}
+	}
+	if rule.Scope != "" && rule.ScopeXPath != "" {
+		return nil, errors.New("The scope and the scope xpath can not be both specified!")
+	}
+	if rule.Scope != "" {
+		if cRule.scope, err = compileSelector(rule.Scope); err != nil {
+			return nil, err
+		}
+	}
+	if rule.ScopeXPath != "" {
+		if cRule.scopeXPath, err = xpath.Compile(rule.ScopeXPath); err != nil {
+			return nil, err
+		}
+	}
+	if len(rule.Fields) == 0 && len(rule.Follow) == 0 {
+		return nil, errors.New("Neither fields nor follow rules are specified!")
+	}
+	if cRule.fields, err = compileFields(rule.Fields); err != nil {
+		return nil, err
+	}
+	for _, follow := range rule.Follow {
+		cFollow := &compiledFollow{attr: follow.Attr}
+		if follow.XPath != "" {
+			if follow.Selector != "" {
+				return nil, errors.New("The selector and the xpath of a follow rule can not be both specified!")
+			}
+			if cFollow.xpath, err = xpath.Compile(follow.XPath); err != nil {
+				return nil, err
+			}
+		} else {
+			selector := follow.Selector
+			if selector == "" {
+				selector = "a[href]"
+			}
+			if cFollow.selector, err = compileSelector(selector); err != nil {
+				return nil, err
+			}
+		}
+		if cFollow.attr == "" {
+			cFollow.attr = "href"
+		}
+		for _, expr := range follow.Include {
+			re, err := compileRegex(expr)
+			if err != nil {
+				return nil, err
+			}
+			cFollow.include = append(cFollow.include, re)
+		}
+		for _, expr := range follow.Exclude {
+			re, err := compileRegex(expr)
+			if err != nil {
+				return nil, err
+			}
+			cFollow.exclude = append(cFollow.exclude, re)
+		}
+		cRule.follow = append(cRule.follow, cFollow)
+	}
+	return cRule, nil
+}
+
+// 编译字段规则的列表。
+func compileFields(fields []FieldRule) ([]*compiledField, error) {
+	names := make(map[string]bool)
+	cFields := make([]*compiledField, 0, len(fields))
+	for _, field := range fields {
+		if field.Name == "" {
+			return nil, errors.New("The field name is empty!")
+		}
+		if field.Name == ITEM_KEY_RULE || field.Name == ITEM_KEY_URL {
+			return nil, errors.New(fmt.Sprintf("The field name %q is reserved!", field.Name))
+		}
+		if names[field.Name] {
+			return nil, errors.New(fmt.Sprintf("Duplicate field %q!", field.Name))
+		}
+		names[field.Name] = true
+		cField := &compiledField{
+			name:      field.Name,
+			fieldType: field.Type,
+			attr:      field.Attr,
+			list:      field.List,
+			required:  field.Required,
+		}
+		if field.Selector != "" && field.XPath != "" {
+			return nil, errors.New(fmt.Sprintf("The selector and the xpath of the field %q can not be both specified!", field.Name))
+		}
+		if field.Selector != "" {
+			selector, err := compileSelector(field.Selector)
+			if err != nil {
+				return nil, err
+			}
+			cField.selector = selector
+		}
+		if field.XPath != "" {
+			expr, err := xpath.Compile(field.XPath)
+			if err != nil {
+				return nil, err
+			}
+			cField.xpath = expr
+		}
+		if cField.fieldType == "" {
+			cField.fieldType = FIELD_TEXT
+		}
+		switch cField.fieldType {
+		case FIELD_TEXT, FIELD_HTML:
+		case FIELD_ATTR:
+			if cField.attr == "" {
+				return nil, errors.New(fmt.Sprintf("The attribute of the field %q is not specified!", field.Name))
+			}
+		case FIELD_URL:
+			// 使用XPath且未指定属性时，链接取自结果的字符串值。
+			if cField.attr == "" && cField.xpath == nil {
+				cField.attr = "href"
+			}
+		case FIELD_OBJECT:
+			if len(field.Fields) == 0 {
+				return nil, errors.New(fmt.Sprintf("The object field %q has no sub fields!", field.Name))
+			}
+			subFields, err := compileFields(field.Fields)
+			if err != nil {
+				return nil, err
+			}
+			cField.fields = subFields
+		default:
+			return nil, errors.New(fmt.Sprintf("Unknown type %q of the field %q!", cField.fieldType, field.Name))
+		}
+		cFields = append(cFields, cField)
+	}
+	return cFields, nil
+}
+
+// 编译CSS选择器。
+func compileSelector(selector string) (cascadia.Selector, error) {
+	compiled, err := cascadia.Compile(selector)
+	if err != nil {
+		errMsg := fmt.Sprintf("Invalid selector '%s': %s", selector, err)
+		return nil, errors.New(errMsg)
+	}
+	return compiled, nil
+}
+
+// 编译正则表达式。
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		errMsg := fmt.Sprintf("Invalid regex '%s': %s", expr, err)
+		return nil, errors.New(errMsg)
+	}
+	return re, nil
+}
+
+// 基于提取规则的响应解析器。
+type ruleParser struct {
+	rules []*compiledRule // 已编译的提取规则的列表。
+}
+
+func (parser *ruleParser) parse(
+	ctx context.Context, httpResp *http.Response, respDepth uint32) ([]base.Data, []error) {
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		return nil, nil
+	}
+	contentType := strings.ToLower(httpResp.Header.Get("Content-Type"))
+	if contentType != "" && !strings.Contains(contentType, "html") && !strings.Contains(contentType, "xml") {
+		return nil, nil
+	}
+	reqUrl := httpResp.Request.URL
+	var matched []*compiledRule
+	for _, rule := range parser.rules {
+		if rule.url == nil || rule.url.MatchString(reqUrl.String()) {
+			matched = append(matched, rule)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+	doc, err := goquery.NewDocumentFromReader(httpResp.Body)
+	if err != nil {
+		return nil, []error{err}
+	}
+	dataList := make([]base.Data, 0)
+	errs := make([]error, 0)
+	for _, rule := range matched {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		rDataList, rErrs := rule.apply(doc.Selection, reqUrl, respDepth)
+		dataList = append(dataList, rDataList...)
+		errs = append(errs, rErrs...)
+	}
+	return dataList, errs
+}
+
+// 把规则应用于文档。
+func (rule *compiledRule) apply(
+	doc *goquery.Selection, reqUrl *url.URL, respDepth uint32) ([]base.Data, []error) {
+	dataList := make([]base.Data, 0)
+	errs := make([]error, 0)
+	if len(rule.fields) > 0 {
+		scopes := doc
+		switch {
+		case rule.scope != nil:
+			scopes = doc.FindMatcher(rule.scope)
+		case rule.scopeXPath != nil:
+			scopes = selectXPath(doc, rule.scopeXPath)
+		}
+		scopes.Each(func(index int, scope *goquery.Selection) {
+			values, ok := extractFields(scope, rule.fields, reqUrl)
+			if !ok || len(values) == 0 {
+				return
+			}
+			values[ITEM_KEY_RULE] = rule.name
+			values[ITEM_KEY_URL] = reqUrl.String()
+			item := base.Item(values)
+			dataList = append(dataList, &item)
+		})
+	}
+	// 同一页面中的重复链接只产生一个请求。
+	seen := make(map[string]bool)
+	for _, follow := range rule.follow {
+		for _, link := range follow.links(doc) {
+			linkUrl, err := resolveLink(reqUrl, link)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if linkUrl == nil || !follow.accept(linkUrl.String()) || seen[linkUrl.String()] {
+				continue
+			}
+			seen[linkUrl.String()] = true
+			httpReq, err := http.NewRequest(http.MethodGet, linkUrl.String(), nil)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			dataList = append(dataList, base.NewRequest(httpReq, respDepth))
+		}
+	}
+	return dataList, errs
+}
+
+// 获得文档中的链接。
+func (follow *compiledFollow) links(doc *goquery.Selection) []string {
+	var links []string
+	if follow.xpath != nil {
+		for _, node := range doc.Nodes {
+			links = append(links, follow.xpath.SelectStrings(node)...)
+		}
+		return links
+	}
+	doc.FindMatcher(follow.selector).Each(func(index int, sel *goquery.Selection) {
+		if link, ok := sel.Attr(follow.attr); ok {
+			links = append(links, link)
+		}
+	})
+	return links
+}
+
+// 获得以选择中的各节点为上下文节点的XPath表达式的结果中的元素。
+// 结果使用新的节点切片，以免修改参数sel（goquery的Slice和AddNodes方法会共享底层数组）。
+func selectXPath(sel *goquery.Selection, expr *xpath.Expr) *goquery.Selection {
+	var nodes []*html.Node
+	seen := make(map[*html.Node]bool)
+	for _, node := range sel.Nodes {
+		for _, result := range expr.Select(node) {
+			if !seen[result] {
+				seen[result] = true
+				nodes = append(nodes, result)
+			}
+		}
+	}
+	return &goquery.Selection{Nodes: nodes}
+}
+
+// 判断链接是否可以被跟随。
+func (follow *compiledFollow) accept(link string) bool {
+	for _, re := range follow.exclude {
+		if re.MatchString(link) {
+			return false
+		}
+	}
+	if len(follow.include) == 0 {
+		return true
+	}
+	for _, re := range follow.include {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// 依据页面URL把链接解析为绝对URL，并去掉其中的片段部分。
+// 对于空链接、只有片段部分的链接以及非HTTP(S)的链接（如“javascript:”和“mailto:”），结果值为nil。
+func resolveLink(reqUrl *url.URL, link string) (*url.URL, error) {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return nil, nil
+	}
+	linkUrl, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	linkUrl = reqUrl.ResolveReference(linkUrl)
+	if linkUrl.Scheme != "http" && linkUrl.Scheme != "https" {
+		return nil, nil
+	}
+	linkUrl.Fragment = ""
+	return linkUrl, nil
+}
+
+// 在范围内提取各字段的值。若有必需的字段没有值，则第二个结果值为false。
+func extractFields(
+	scope *goquery.Selection, fields []*compiledField, reqUrl *url.URL) (map[string]interface{}, bool) {
+	values := make(map[string]interface{})
+	for _, field := range fields {
+		var list []interface{}
+		if field.stringValued() {
+			for _, node := range scope.Nodes {
+				for _, s := range field.xpath.SelectStrings(node) {
+					if value, ok := field.convert(s, reqUrl); ok {
+						list = append(list, value)
+					}
+				}
+			}
+			if !field.list && len(list) > 1 {
+				list = list[:1]
+			}
+		} else {
+			field.selection(scope).EachWithBreak(func(index int, elem *goquery.Selection) bool {
+				if value, ok := field.extract(elem, reqUrl); ok {
+					list = append(list, value)
+				}
+				return field.list || len(list) == 0
+			})
+		}
+		switch {
+		case len(list) == 0:
+			if field.required {
+				return nil, false
+			}
+		case field.list:
+			values[field.name] = list
+		default:
+			values[field.name] = list[0]
+		}
+	}
+	return values, true
+}
+
+// 判断字段的值是否取自XPath结果的字符串值。
+func (field *compiledField) stringValued() bool {
+	if field.xpath == nil {
+		return false
+	}
+	return field.fieldType == FIELD_TEXT || (field.fieldType == FIELD_URL && field.attr == "")
+}
+
+// 获得字段在范围内匹配的元素。
+func (field *compiledField) selection(scope *goquery.Selection) *goquery.Selection {
+	switch {
+	case field.selector != nil:
+		return scope.FindMatcher(field.selector)
+	case field.xpath != nil:
+		return selectXPath(scope, field.xpath)
+	}
+	return scope
+}
+
+// 把文本或链接转换为字段值。若其为空，则第二个结果值为false。
+func (field *compiledField) convert(value string, reqUrl *url.URL) (interface{}, bool) {
+	if field.fieldType == FIELD_URL {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, false
+		}
+		linkUrl, err := url.Parse(value)
+		if err != nil {
+			return nil, false
+		}
+		return reqUrl.ResolveReference(linkUrl).String(), true
+	}
+	text := strings.Join(strings.Fields(value), " ")
+	return text, text != ""
+}
+
+// 提取单个元素中的字段值。若该元素中没有值，则第二个结果值为false。
+func (field *compiledField) extract(elem *goquery.Selection, reqUrl *url.URL) (interface{}, bool) {
+	switch field.fieldType {
+	case FIELD_ATTR:
+		return elem.Attr(field.attr)
+	case FIELD_URL:
+		link, ok := elem.Attr(field.attr)
+		if !ok {
+			return nil, false
+		}
+		return field.convert(link, reqUrl)
+	case FIELD_HTML:
+		content, err := elem.Html()
+		if err != nil {
+			return nil, false
+		}
+		return strings.TrimSpace(content), true
+	case FIELD_OBJECT:
+		values, ok := extractFields(elem, field.fields, reqUrl)
+		if !ok || len(values) == 0 {
+			return nil, false
+		}
+		return values, true
+	default:
+		return field.convert(elem.Text(), reqUrl)
+	}
+}
@@ -0,0 +1,282 @@
+package analyzer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	base "webcrawler/base"
+)
+
+const rulePage = `<html><head><title>Posts</title></head><body>
+<article class="post">
+  <h1>  First
+     post </h1>
+  <a class="author" href="/u/alice" data-id="1"><span class="name">Alice</span></a>
+  <span class="tag">go</span><span class="tag">crawler</span>
+  <img src="img/1.png">
+  <div class="body"><p>Hello <b>world</b></p></div>
+</article>
+<article class="post">
+  <h1>Second post</h1>
+  <a class="author" data-id="2"><span class="name">Bob</span></a>
+  <div class="body"><p>Bye</p></div>
+</article>
+<article class="post">
+  <p>An article without a title is dropped.</p>
+</article>
+<a href="/post/3#comments">next</a>
+<a href="/post/3">next again</a>
+<a href="/post/draft">draft</a>
+<a href="/about">about</a>
+<a href="mailto:someone@example.com">mail</a>
+<link rel="prev" href="/post/1">
+</body></html>`
+
+const ruleSpecJson = `{
+  "rules": [
+    {
+      "name": "post",
+      "url": "/posts$",
+      "scope": "article.post",
+      "fields": [
+        { "name": "title", "selector": "h1", "required": true },
+        { "name": "tags", "selector": ".tag", "list": true },
+        { "name": "authorId", "selector": ".author", "type": "attr", "attr": "data-id" },
+        { "name": "cover", "selector": "img", "type": "url", "attr": "src" },
+        { "name": "body", "selector": ".body", "type": "html" },
+        { "name": "author", "selector": ".author", "type": "object", "fields": [
+          { "name": "name", "selector": ".name" },
+          { "name": "home", "type": "url" }
+        ] }
+      ],
+      "follow": [
+        { "include": ["/post/"], "exclude": ["draft"] },
+        { "xpath": "//link[@rel='prev']/@href" }
+      ]
+    },
+    {
+      "name": "other",
+      "url": "/elsewhere$",
+      "fields": [{ "name": "title", "selector": "title" }]
+    }
+  ]
+}`
+
+const ruleSpecYaml = `rules:
+  - name: post
+    url: /posts$
+    scope: article.post
+    fields:
+      - { name: title, selector: h1, required: true }
+      - { name: tags, selector: .tag, list: true }
+      - { name: authorId, selector: .author, type: attr, attr: data-id }
+      - { name: cover, selector: img, type: url, attr: src }
+      - { name: body, selector: .body, type: html }
+      - name: author
+        selector: .author
+        type: object
+        fields:
+          - { name: name, selector: .name }
+          - { name: home, type: url }
+    follow:
+      - include: [/post/]
+        exclude: [draft]
+      - xpath: //link[@rel='prev']/@href
+  - name: other
+    url: /elsewhere$
+    fields:
+      - { name: title, selector: title }
+`
+
+func writeSpec(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error: %s", err)
+	}
+	return path
+}
+
+func TestLoadRuleSpecJsonAndYaml(t *testing.T) {
+	jsonSpec, err := LoadRuleSpec(writeSpec(t, "rules.json", ruleSpecJson))
+	if err != nil {
+		t.Fatalf("LoadRuleSpec(json) error: %s", err)
+	}
+	yamlSpec, err := LoadRuleSpec(writeSpec(t, "rules.yaml", ruleSpecYaml))
+	if err != nil {
+		t.Fatalf("LoadRuleSpec(yaml) error: %s", err)
+	}
+	if !reflect.DeepEqual(jsonSpec, yamlSpec) {
+		t.Errorf("The YAML spec differs from the JSON spec:\n%+v\n%+v", yamlSpec, jsonSpec)
+	}
+	if _, err := LoadRuleSpec(writeSpec(t, "typo.yml", "rules:\n  - name: a\n    feilds: []\n")); err == nil {
+		t.Error("An unknown YAML key should be rejected")
+	}
+	if _, err := LoadRuleSpec(writeSpec(t, "typo.json", `{"rule": []}`)); err == nil {
+		t.Error("An unknown JSON key should be rejected")
+	}
+}
+
+func TestNewRuleParserInvalidSpec(t *testing.T) {
+	cases := map[string]*RuleSpec{
+		"nil spec":          nil,
+		"no rules":          {},
+		"empty name":        {Rules: []ExtractRule{{Fields: []FieldRule{{Name: "a"}}}}},
+		"duplicate rule":    {Rules: []ExtractRule{{Name: "a", Fields: []FieldRule{{Name: "a"}}}, {Name: "a", Fields: []FieldRule{{Name: "a"}}}}},
+		"nothing to do":     {Rules: []ExtractRule{{Name: "a"}}},
+		"bad url":           {Rules: []ExtractRule{{Name: "a", Url: "(", Fields: []FieldRule{{Name: "a"}}}}},
+		"bad selector":      {Rules: []ExtractRule{{Name: "a", Fields: []FieldRule{{Name: "a", Selector: "a["}}}}},
+		"bad xpath":         {Rules: []ExtractRule{{Name: "a", Fields: []FieldRule{{Name: "a", XPath: "//a["}}}}},
+		"both scopes":       {Rules: []ExtractRule{{Name: "a", Scope: "p", ScopeXPath: "//p", Fields: []FieldRule{{Name: "a"}}}}},
+		"reserved field":    {Rules: []ExtractRule{{Name: "a", Fields: []FieldRule{{Name: ITEM_KEY_URL}}}}},
+		"duplicate field":   {Rules: []ExtractRule{{Name: "a", Fields: []FieldRule{{Name: "a"}, {Name: "a"}}}}},
+		"attr without name": {Rules: []ExtractRule{{Name: "a", Fields: []FieldRule{{Name: "a", Type: FIELD_ATTR}}}}},
+		"empty object":      {Rules: []ExtractRule{{Name: "a", Fields: []FieldRule{{Name: "a", Type: FIELD_OBJECT}}}}},
+		"unknown type":      {Rules: []ExtractRule{{Name: "a", Fields: []FieldRule{{Name: "a", Type: "number"}}}}},
+		"bad include":       {Rules: []ExtractRule{{Name: "a", Follow: []FollowRule{{Include: []string{"("}}}}}},
+	}
+	for name, spec := range cases {
+		if _, err := NewRuleParser(spec); err == nil {
+			t.Errorf("%s: NewRuleParser() should fail", name)
+		}
+	}
+}
+
+// 用基于提取规则的响应解析函数解析测试服务器上的页面。
+func parseWithRules(t *testing.T, parse ParseResponse, server *httptest.Server, path string) ([]base.Item, []string) {
+	httpResp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("Get() error: %s", err)
+	}
+	dataList, errs := parse(context.Background(), httpResp, 1)
+	if len(errs) > 0 {
+		t.Fatalf("Parse errors: %v", errs)
+	}
+	var items []base.Item
+	var links []string
+	for _, data := range dataList {
+		switch d := data.(type) {
+		case *base.Item:
+			items = append(items, *d)
+		case *base.Request:
+			if d.Depth() != 1 || d.Method() != http.MethodGet {
+				t.Errorf("Unexpected request: depth=%d, method=%s", d.Depth(), d.Method())
+			}
+			links = append(links, strings.TrimPrefix(d.HttpReq().URL.String(), server.URL))
+		default:
+			t.Errorf("Unexpected data type %T", data)
+		}
+	}
+	return items, links
+}
+
+func TestRuleParser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/posts", "/elsewhere":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, rulePage)
+		case "/posts.json":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	spec, err := LoadRuleSpec(writeSpec(t, "rules.json", ruleSpecJson))
+	if err != nil {
+		t.Fatalf("LoadRuleSpec() error: %s", err)
+	}
+	parse, err := NewRuleParser(spec)
+	if err != nil {
+		t.Fatalf("NewRuleParser() error: %s", err)
+	}
+
+	items, links := parseWithRules(t, parse, server, "/posts")
+	pageUrl := server.URL + "/posts"
+	want := []base.Item{
+		{
+			ITEM_KEY_RULE: "post",
+			ITEM_KEY_URL:  pageUrl,
+			"title":       "First post",
+			"tags":        []interface{}{"go", "crawler"},
+			"authorId":    "1",
+			"cover":       server.URL + "/img/1.png",
+			"body":        "<p>Hello <b>world</b></p>",
+			"author": map[string]interface{}{
+				"name": "Alice",
+				"home": server.URL + "/u/alice",
+			},
+		},
+		{
+			ITEM_KEY_RULE: "post",
+			ITEM_KEY_URL:  pageUrl,
+			"title":       "Second post",
+			"authorId":    "2",
+			"body":        "<p>Bye</p>",
+			// 没有链接的作者对象只有名称。
+			"author": map[string]interface{}{"name": "Bob"},
+		},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("Unexpected items:\n got %#v\nwant %#v", items, want)
+	}
+	// 片段部分被去掉，重复的链接只出现一次，被排除的、未被包含的以及非HTTP的链接均被忽略。
+	sort.Strings(links)
+	wantLinks := []string{"/post/1", "/post/3"}
+	if !reflect.DeepEqual(links, wantLinks) {
+		t.Errorf("Unexpected links: got %q, want %q", links, wantLinks)
+	}
+
+	// 只有URL与之匹配的规则会被应用。
+	items, links = parseWithRules(t, parse, server, "/elsewhere")
+	if len(items) != 1 || items[0]["title"] != "Posts" || items[0][ITEM_KEY_RULE] != "other" || len(links) != 0 {
+		t.Errorf("Unexpected result of the other rule: items=%v, links=%q", items, links)
+	}
+	// 非HTML响应以及非2xx响应均被忽略。
+	for _, path := range []string{"/posts.json", "/missing"} {
+		if items, links := parseWithRules(t, parse, server, path); len(items) != 0 || len(links) != 0 {
+			t.Errorf("%s: unexpected result: items=%v, links=%q", path, items, links)
+		}
+	}
+}
+
+func TestRuleParserXPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, rulePage)
+	}))
+	defer server.Close()
+	parse, err := NewRuleParser(&RuleSpec{Rules: []ExtractRule{{
+		Name:       "post",
+		ScopeXPath: "//article[h1]",
+		Fields: []FieldRule{
+			{Name: "title", XPath: "normalize-space(h1)", Required: true},
+			{Name: "tagCount", XPath: "count(span[@class='tag'])"},
+			{Name: "home", XPath: "a/@href", Type: FIELD_URL},
+			{Name: "names", XPath: ".//span[@class='name']", List: true},
+		},
+	}}})
+	if err != nil {
+		t.Fatalf("NewRuleParser() error: %s", err)
+	}
+	items, _ := parseWithRules(t, parse, server, "/")
+	if len(items) != 2 {
+		t.Fatalf("Got %d items, want 2: %v", len(items), items)
+	}
+	first := items[0]
+	if first["title"] != "First post" || first["tagCount"] != "2" ||
+		first["home"] != server.URL+"/u/alice" ||
+		!reflect.DeepEqual(first["names"], []interface{}{"Alice"}) {
+		t.Errorf("Unexpected first item: %v", first)
+	}
+	if _, ok := items[1]["home"]; ok || items[1]["tagCount"] != "0" {
+		t.Errorf("Unexpected second item: %v", items[1])
+	}
+}
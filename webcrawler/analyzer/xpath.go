@@ -0,0 +1,36 @@
+package analyzer
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"webcrawler/tool/xpath"
+)
+
+// 在编写ParseResponse类型的解析函数时，可以用以下函数以XPath表达式查询goquery文档，
+// 例如XPathStrings(doc.Selection, "//a/@href")。
+// 它们每次调用都会编译表达式；需要反复使用同一表达式时，应先用xpath.Compile函数编译，
+// 再调用所得表达式的Select或SelectStrings方法。
+
+// 以选择中的各节点为上下文节点求XPath表达式的值，并以选择的形式返回结果中的元素。
+// 结果中的元素按首次出现的顺序排列且不重复；属性、文本等非元素节点会被忽略。
+func XPathFind(sel *goquery.Selection, source string) (*goquery.Selection, error) {
+	expr, err := xpath.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return selectXPath(sel, expr), nil
+}
+
+// 以选择中的各节点为上下文节点求XPath表达式的值，并返回结果的字符串值。
+// 若结果为节点集，则每个节点对应一个字符串值（如“//a/@href”的结果为各链接）；
+// 否则每个上下文节点只对应一个字符串值（如“count(//a)”的结果）。
+func XPathStrings(sel *goquery.Selection, source string) ([]string, error) {
+	expr, err := xpath.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	var strs []string
+	for _, node := range sel.Nodes {
+		strs = append(strs, expr.SelectStrings(node)...)
+	}
+	return strs, nil
+}
@@ -0,0 +1,41 @@
+package analyzer
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXPathHelpers(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rulePage))
+	if err != nil {
+		t.Fatalf("NewDocumentFromReader() error: %s", err)
+	}
+	titles, err := XPathFind(doc.Selection, "//article/h1")
+	if err != nil {
+		t.Fatalf("XPathFind() error: %s", err)
+	}
+	if titles.Length() != 2 || titles.Eq(1).Text() != "Second post" {
+		t.Errorf("Unexpected titles: %q", titles.Text())
+	}
+	// 以多个节点为上下文节点时，结果中的重复元素只出现一次。
+	articles := doc.Find("article")
+	if body, _ := XPathFind(articles, "//body"); body.Length() != 1 {
+		t.Errorf("XPathFind() returned %d body elements, want 1", body.Length())
+	}
+	ids, err := XPathStrings(articles, "a/@data-id")
+	if err != nil || !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("XPathStrings() = %q, %v", ids, err)
+	}
+	counts, err := XPathStrings(articles, "count(span[@class='tag'])")
+	if err != nil || !reflect.DeepEqual(counts, []string{"2", "0", "0"}) {
+		t.Errorf("XPathStrings() = %q, %v", counts, err)
+	}
+	if _, err := XPathFind(doc.Selection, "//a["); err == nil {
+		t.Error("XPathFind() with an invalid expression should fail")
+	}
+	if _, err := XPathStrings(doc.Selection, "//a["); err == nil {
+		t.Error("XPathStrings() with an invalid expression should fail")
+	}
+}
@@ -1,7 +1,13 @@
 package base
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
 	"net/http"
+	"sync/atomic"
 )
 
 // 数据的接口。
@@ -11,13 +17,44 @@ type Data interface {
 
 // 请求。
 type Request struct {
-	httpReq *http.Request // HTTP请求的指针值。
-	depth   uint32        // 请求的深度。
+	httpReq       *http.Request // HTTP请求的指针值。
+	depth         uint32        // 请求的深度。
+	attempts      uint32        // 已进行的下载尝试的次数。
+	maxAttempts   uint32        // 最大下载尝试次数。为0则表示使用重试策略的默认值。
+	headerProfile string        // 下载时使用的报头配置的名称。
+	body          []byte        // 请求体。为nil则表示没有请求体。
 }
 
 // 创建新的请求。
+// 若HTTP请求带有可以通过GetBody字段重新获得的请求体
+// （由http.NewRequest函数以*bytes.Reader、*bytes.Buffer或*strings.Reader为请求体创建的请求均满足此条件），
+// 则请求体会被保存在请求中，以使每次下载尝试（包括重试）都能发送完整的请求体。
+// 其他请求体只能被发送一次，此时应使用SetBody方法设置请求体。
 func NewRequest(httpReq *http.Request, depth uint32) *Request {
-	return &Request{httpReq: httpReq, depth: depth}
+	req := &Request{httpReq: httpReq, depth: depth}
+	if httpReq != nil && httpReq.GetBody != nil {
+		if body, err := httpReq.GetBody(); err == nil {
+			data, err := io.ReadAll(body)
+			body.Close()
+			if err == nil && len(data) > 0 {
+				req.body = data
+			}
+		}
+	}
+	return req
+}
+
+// 创建带有请求体的请求。参数contentType代表请求体的编码方式（即Content-Type报头的值），
+// 如“application/x-www-form-urlencoded”。
+func NewRequestWithBody(
+	method string, rawUrl string, body []byte, contentType string, depth uint32) (*Request, error) {
+	httpReq, err := http.NewRequest(method, rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req := NewRequest(httpReq, depth)
+	req.SetBody(body, contentType)
+	return req, nil
 }
 
 // 获取HTTP请求。
@@ -30,6 +67,121 @@ func (req *Request) Depth() uint32 {
 	return req.depth
 }
 
+// 获取请求方法。
+func (req *Request) Method() string {
+	if req.httpReq == nil || req.httpReq.Method == "" {
+		return http.MethodGet
+	}
+	return req.httpReq.Method
+}
+
+// 获取请求体。为nil则表示没有请求体。调用方不应修改它。
+func (req *Request) Body() []byte {
+	return req.body
+}
+
+// 获取请求体的编码方式，即Content-Type报头的值。
+func (req *Request) ContentType() string {
+	if req.httpReq == nil {
+		return ""
+	}
+	return req.httpReq.Header.Get("Content-Type")
+}
+
+// 设置请求体。参数contentType代表请求体的编码方式。若其为空，则Content-Type报头保持不变。
+func (req *Request) SetBody(body []byte, contentType string) {
+	if len(body) == 0 {
+		body = nil
+	}
+	req.body = body
+	if contentType != "" {
+		req.httpReq.Header.Set("Content-Type", contentType)
+	}
+	setHttpReqBody(req.httpReq, body)
+}
+
+// 获取请求体的摘要（SHA-1的十六进制形式）。没有请求体时返回空字符串。
+// 它可以被用来区分URL相同而请求体不同的请求。
+func (req *Request) BodyDigest() string {
+	if len(req.body) == 0 {
+		return ""
+	}
+	sum := sha1.Sum(req.body)
+	return hex.EncodeToString(sum[:])
+}
+
+// 创建供一次下载尝试使用的HTTP请求。它是原HTTP请求的副本，并带有新的、可被完整读取的请求体。
+func (req *Request) NewHttpReq(ctx context.Context) *http.Request {
+	httpReq := req.httpReq.Clone(ctx)
+	if req.body != nil {
+		setHttpReqBody(httpReq, req.body)
+	}
+	return httpReq
+}
+
+// 把HTTP请求的请求体设置为参数body代表的内容。
+func setHttpReqBody(httpReq *http.Request, body []byte) {
+	if body == nil {
+		httpReq.Body = http.NoBody
+		httpReq.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		httpReq.ContentLength = 0
+		return
+	}
+	httpReq.Body = io.NopCloser(bytes.NewReader(body))
+	httpReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	httpReq.ContentLength = int64(len(body))
+}
+
+// 获取已进行的下载尝试的次数。
+func (req *Request) Attempts() uint32 {
+	return req.attempts
+}
+
+// 获取最大下载尝试次数（包括首次尝试）。为0则表示使用重试策略的默认值。
+func (req *Request) MaxAttempts() uint32 {
+	return req.maxAttempts
+}
+
+// 设置最大下载尝试次数（包括首次尝试）。它会覆盖重试策略的默认值。
+func (req *Request) SetMaxAttempts(maxAttempts uint32) {
+	req.maxAttempts = maxAttempts
+}
+
+// 获取下载时使用的报头配置的名称。
+// 在设置了报头配置的调度器中，请求被放入请求缓存之后它总是代表实际使用的报头配置，
+// 并会随请求一起被重试和持久化。
+func (req *Request) HeaderProfile() string {
+	return req.headerProfile
+}
+
+// 设置下载时使用的报头配置的名称。
+func (req *Request) SetHeaderProfile(name string) {
+	req.headerProfile = name
+}
+
+// 创建请求的副本，并将其已进行的下载尝试的次数设置为参数attempts的值。
+func (req *Request) WithAttempts(attempts uint32) *Request {
+	newReq := *req
+	newReq.attempts = attempts
+	return &newReq
+}
+
+// 创建请求的副本，并将其深度设置为参数depth的值。
+func (req *Request) WithDepth(depth uint32) *Request {
+	newReq := *req
+	newReq.depth = depth
+	return &newReq
+}
+
+// 创建请求的副本，并将其HTTP请求替换为参数httpReq的值。
+func (req *Request) WithHttpReq(httpReq *http.Request) *Request {
+	newReq := *req
+	newReq.httpReq = httpReq
+	return &newReq
+}
+
 // 数据是否有效。
 func (req *Request) Valid() bool {
 	return req.httpReq != nil && req.httpReq.URL != nil
@@ -37,13 +189,17 @@ func (req *Request) Valid() bool {
 
 // 响应。
 type Response struct {
-	httpResp *http.Response
-	depth    uint32
+	httpResp      *http.Response
+	depth         uint32
+	truncated     *uint32 // 响应体是否已被截断。响应的各个副本共享该值。
+	charset       string  // 响应体原本的字符集。
+	headerProfile string  // 下载时使用的报头配置的名称。
+	wireLength    int64   // 解压之前的响应体的长度（即网络上传输的Content-Length）。为0则表示未记录。
 }
 
 // 创建新的响应。
 func NewResponse(httpResp *http.Response, depth uint32) *Response {
-	return &Response{httpResp: httpResp, depth: depth}
+	return &Response{httpResp: httpResp, depth: depth, truncated: new(uint32)}
 }
 
 // 获取HTTP响应。
@@ -56,6 +212,60 @@ func (resp *Response) Depth() uint32 {
 	return resp.depth
 }
 
+// 获取响应体原本的字符集。若响应体未经字符集判定，则返回空字符串。
+func (resp *Response) Charset() string {
+	return resp.charset
+}
+
+// 设置响应体原本的字符集。
+func (resp *Response) SetCharset(charset string) {
+	resp.charset = charset
+}
+
+// 获取下载时使用的报头配置的名称。若下载时未使用报头配置，则返回空字符串。
+func (resp *Response) HeaderProfile() string {
+	return resp.headerProfile
+}
+
+// 设置下载时使用的报头配置的名称。
+func (resp *Response) SetHeaderProfile(name string) {
+	resp.headerProfile = name
+}
+
+// 获取网络上传输的响应体的长度。
+// 对于被透明解压的响应，它是解压之前的Content-Length报头的值，否则与HTTP响应的ContentLength字段相同。
+// 未知时返回-1。
+func (resp *Response) WireLength() int64 {
+	if resp.wireLength > 0 {
+		return resp.wireLength
+	}
+	if resp.httpResp == nil {
+		return -1
+	}
+	return resp.httpResp.ContentLength
+}
+
+// 记录网络上传输的响应体的长度。参数length为负数时表示未知。
+func (resp *Response) SetWireLength(length int64) {
+	if length < 0 {
+		length = 0
+	}
+	resp.wireLength = length
+}
+
+// 判断响应体是否已被截断。
+// 对于以流的方式被截断的响应体，只有在读到截断处之后该方法才会返回true。
+func (resp *Response) Truncated() bool {
+	return resp.truncated != nil && atomic.LoadUint32(resp.truncated) == 1
+}
+
+// 把响应标记为响应体已被截断。
+func (resp *Response) MarkTruncated() {
+	if resp.truncated != nil {
+		atomic.StoreUint32(resp.truncated, 1)
+	}
+}
+
 // 数据是否有效。
 func (resp *Response) Valid() bool {
 	return resp.httpResp != nil && resp.httpResp.Body != nil
@@ -0,0 +1,94 @@
+package base
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// 读取HTTP请求的请求体。
+func readBody(t *testing.T, httpReq *http.Request) string {
+	if httpReq.Body == nil {
+		return ""
+	}
+	data, err := io.ReadAll(httpReq.Body)
+	if err != nil {
+		t.Fatalf("Reading the body error: %s", err)
+	}
+	return string(data)
+}
+
+func TestNewRequestKeepsBody(t *testing.T) {
+	httpReq, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("a=1"))
+	req := NewRequest(httpReq, 1)
+	if string(req.Body()) != "a=1" || req.Method() != http.MethodPost {
+		t.Fatalf("Unexpected request: method=%s, body=%q", req.Method(), req.Body())
+	}
+	// 每次下载尝试都能读到完整的请求体。
+	for i := 0; i < 2; i++ {
+		attempt := req.NewHttpReq(context.Background())
+		if got := readBody(t, attempt); got != "a=1" || attempt.ContentLength != 3 {
+			t.Errorf("Attempt %d: body=%q, length=%d", i, got, attempt.ContentLength)
+		}
+	}
+	// 无法重新获得的请求体不会被保存。
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeWriter.Close()
+	httpReq, _ = http.NewRequest(http.MethodPost, "http://example.com/", pipeReader)
+	if req := NewRequest(httpReq, 0); req.Body() != nil || req.BodyDigest() != "" {
+		t.Errorf("Unexpected body %q", req.Body())
+	}
+	if req := NewRequest(&http.Request{}, 0); req.Method() != http.MethodGet {
+		t.Errorf("The default method is %q, want GET", req.Method())
+	}
+}
+
+func TestSetBody(t *testing.T) {
+	req, err := NewRequestWithBody(http.MethodPost, "http://example.com/form", []byte("x=1"), "application/x-www-form-urlencoded", 2)
+	if err != nil {
+		t.Fatalf("NewRequestWithBody() error: %s", err)
+	}
+	if req.ContentType() != "application/x-www-form-urlencoded" || req.Depth() != 2 || string(req.Body()) != "x=1" {
+		t.Errorf("Unexpected request: content type %q, depth %d, body %q", req.ContentType(), req.Depth(), req.Body())
+	}
+	digest := req.BodyDigest()
+	if len(digest) != 40 {
+		t.Errorf("Unexpected digest %q", digest)
+	}
+	// 内容类型为空时，Content-Type报头保持不变。
+	req.SetBody([]byte("x=2"), "")
+	if req.ContentType() != "application/x-www-form-urlencoded" || req.BodyDigest() == digest {
+		t.Errorf("Unexpected request after SetBody: content type %q, digest %q", req.ContentType(), req.BodyDigest())
+	}
+	if got := readBody(t, req.NewHttpReq(context.Background())); got != "x=2" {
+		t.Errorf("NewHttpReq() body = %q, want %q", got, "x=2")
+	}
+	// 空的请求体等同于没有请求体。
+	req.SetBody([]byte{}, "text/plain")
+	attempt := req.NewHttpReq(context.Background())
+	if req.Body() != nil || req.BodyDigest() != "" || attempt.Body != http.NoBody || attempt.ContentLength != 0 {
+		t.Errorf("Unexpected empty body: %q, %q, %v", req.Body(), req.BodyDigest(), attempt.Body)
+	}
+	if body, err := attempt.GetBody(); err != nil || body != http.NoBody {
+		t.Errorf("GetBody() = %v, %v", body, err)
+	}
+	if req.ContentType() != "text/plain" {
+		t.Errorf("Unexpected content type %q", req.ContentType())
+	}
+}
+
+func TestNewHttpReqIsACopy(t *testing.T) {
+	req, _ := NewRequestWithBody(http.MethodPut, "http://example.com/", []byte("body"), "text/plain", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	attempt := req.NewHttpReq(ctx)
+	attempt.Header.Set("X-Test", "1")
+	if req.HttpReq().Header.Get("X-Test") != "" {
+		t.Error("NewHttpReq() shares the header with the original request")
+	}
+	if attempt.Context() != ctx || attempt.Method != http.MethodPut {
+		t.Error("NewHttpReq() did not use the given context or method")
+	}
+}
@@ -13,6 +13,7 @@ const (
 	DOWNLOADER_ERROR     ErrorType = "Downloader Error"
 	ANALYZER_ERROR       ErrorType = "Analyzer Error"
 	ITEM_PROCESSOR_ERROR ErrorType = "Item Processor Error"
+	ROBOTS_ERROR         ErrorType = "Robots Disallowed Error"
 )
 
 // 爬虫错误的接口。
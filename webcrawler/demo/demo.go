@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"io"
@@ -11,9 +13,11 @@ import (
 	"time"
 	"webcrawler/analyzer"
 	base "webcrawler/base"
+	dl "webcrawler/downloader"
 	pipeline "webcrawler/itempipeline"
 	sched "webcrawler/scheduler"
 	"webcrawler/tool"
+	"webcrawler/tool/form"
 	"github.com/Sirupsen/logrus"
 )
 
@@ -21,7 +25,7 @@ import (
 var logger *logrus.Logger = base.NewLogger()
 
 // 条目处理器。
-func processItem(item base.Item) (result base.Item, err error) {
+func processItem(ctx context.Context, item base.Item) (result base.Item, err error) {
 	if item == nil {
 		return nil, errors.New("Invalid item!")
 	}
@@ -33,16 +37,20 @@ func processItem(item base.Item) (result base.Item, err error) {
 	if _, ok := result["number"]; !ok {
 		result["number"] = len(result)
 	}
-	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-time.After(10 * time.Millisecond):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	return result, nil
 }
 
-// 响应解析函数。只解析“A”标签。
-func parseForATag(httpResp *http.Response, respDepth uint32) ([]base.Data, []error) {
+// 响应解析函数。解析“A”标签和搜索表单。
+func parseForATag(ctx context.Context, httpResp *http.Response, respDepth uint32) ([]base.Data, []error) {
 	// TODO 支持更多的HTTP响应状态
 	if httpResp.StatusCode != 200 {
 		err := errors.New(
-			fmt.Sprintf("Unsupported status code %d. (httpResponse=%v)", httpResp))
+			fmt.Sprintf("Unsupported status code %d. (httpResponse=%v)", httpResp.StatusCode, httpResp))
 		return nil, []error{err}
 	}
 	var reqUrl *url.URL = httpResp.Request.URL
@@ -97,6 +105,43 @@ func parseForATag(httpResp *http.Response, respDepth uint32) ([]base.Data, []err
 			dataList = append(dataList, &item)
 		}
 	})
+	// 提交搜索表单（仅在指定了搜索关键词时）
+	if *searchKeyword != "" {
+		formReqs, formErrs := searchFormRequests(doc, reqUrl, respDepth)
+		dataList = append(dataList, formReqs...)
+		errs = append(errs, formErrs...)
+	}
+	return dataList, errs
+}
+
+// 搜索表单中被填写的关键词。为空则表示不提交搜索表单。
+var searchKeyword = flag.String("search", "",
+	"submit the search forms found in the crawled pages with this keyword (disabled if empty)")
+
+// 生成提交网页中的搜索表单（即带有关键词输入框的表单）的请求。
+func searchFormRequests(doc *goquery.Document, reqUrl *url.URL, respDepth uint32) ([]base.Data, []error) {
+	dataList := make([]base.Data, 0)
+	errs := make([]error, 0)
+	for _, node := range doc.Nodes {
+		for _, f := range form.Find(node, reqUrl) {
+			var keywordField string
+			for _, name := range []string{"query", "q", "wd", "keyword"} {
+				if _, ok := f.Values()[name]; ok {
+					keywordField = name
+					break
+				}
+			}
+			if keywordField == "" {
+				continue
+			}
+			req, err := f.NewRequest(url.Values{keywordField: {*searchKeyword}}, respDepth)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			dataList = append(dataList, req)
+		}
+	}
 	return dataList, errs
 }
 
@@ -136,6 +181,8 @@ func record(level byte, content string) {
 }
 
 func main() {
+	flag.Parse()
+
 	// 创建调度器
 	scheduler := sched.NewScheduler()
 
@@ -154,6 +201,22 @@ func main() {
 	// 准备启动参数
 	channelArgs := base.NewChannelArgs(10, 10, 10, 10)
 	poolBaseArgs := base.NewPoolBaseArgs(3, 3)
+	schedArgs := sched.NewSchedArgs()
+	schedArgs.SetObeyRobots(true)
+	schedArgs.SetDecodeCharset(true)
+	schedArgs.SetDefaultCharset("gbk")
+	schedArgs.SetHeaderProfiles(dl.NewHeaderProfiles(dl.PROFILE_STICKY_PER_HOST,
+		dl.HeaderProfile{
+			Name: "chrome-windows",
+			Headers: map[string]string{
+				"User-Agent":         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+				"Accept":             "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+				"Accept-Language":    "zh-CN,zh;q=0.9,en;q=0.8",
+				"Sec-CH-UA":          `"Chromium";v="120", "Google Chrome";v="120", "Not?A_Brand";v="99"`,
+				"Sec-CH-UA-Mobile":   "?0",
+				"Sec-CH-UA-Platform": `"Windows"`,
+			},
+		}))
 	crawlDepth := uint32(1)
 	httpClientGenerator := genHttpClient
 	respParsers := getResponseParsers()
@@ -168,11 +231,13 @@ func main() {
 	scheduler.Start(
 		channelArgs,
 		poolBaseArgs,
+		schedArgs,
 		crawlDepth,
 		httpClientGenerator,
 		respParsers,
 		itemProcessors,
-		firstHttpReq)
+		nil,
+		[]*http.Request{firstHttpReq})
 
 	// 等待监控结束
 	<-checkCountChan
@@ -0,0 +1,241 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	base "webcrawler/base"
+)
+
+// 响应体被拒绝的原因。
+const (
+	BODY_REJECT_REASON_TOO_LARGE    = "too large"    // Content-Length报头（对于压缩的响应是其解压之前的值）表明响应体过大。
+	BODY_REJECT_REASON_CONTENT_TYPE = "content type" // 响应的内容类型被拒绝。
+)
+
+// 默认的二进制内容类型的列表。以“/*”结尾的类型表示该大类下的所有类型。
+var DefaultBinaryTypes = []string{
+	"image/*",
+	"audio/*",
+	"video/*",
+	"font/*",
+	"application/octet-stream",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-tar",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/vnd.ms-fontobject",
+	"application/x-shockwave-flash",
+}
+
+// 表示响应在读取响应体之前就被拒绝的错误类型。
+type BodyRejectedError struct {
+	Reason        string // 原因。
+	Url           string // 请求的URL。
+	ContentType   string // 响应的媒体类型。
+	ContentLength int64  // 网络上传输的响应体的长度，即解压之前的Content-Length报头的值。未知时为-1。
+	MaxSize       int64  // 适用于该响应的最大尺寸。
+}
+
+func (err *BodyRejectedError) Error() string {
+	return fmt.Sprintf("The response body is rejected: %s. "+
+		"(url=%s, contentType=%q, contentLength=%d, maxSize=%d)",
+		err.Reason, err.Url, err.ContentType, err.ContentLength, err.MaxSize)
+}
+
+// 响应体限制。
+type BodyLimits struct {
+	defaultMaxSize int64            // 默认的最大尺寸。为0则表示不限制。
+	maxSizes       map[string]int64 // 针对各内容类型的最大尺寸的字典。
+	rejectedTypes  []string         // 被拒绝的内容类型的列表。
+	abortOversized bool             // Content-Length报头表明响应体过大时是否放弃下载。
+}
+
+// 创建响应体限制。参数defaultMaxSize代表默认的最大尺寸（字节数）。为0则表示不限制。
+// 超出最大尺寸的响应体会被截断，读取到截断处时会得到io.EOF。
+func NewBodyLimits(defaultMaxSize int64) *BodyLimits {
+	return &BodyLimits{
+		defaultMaxSize: defaultMaxSize,
+		maxSizes:       make(map[string]int64),
+	}
+}
+
+func (limits *BodyLimits) Check() error {
+	if limits.defaultMaxSize < 0 {
+		return errors.New("The default max body size can not be negative!")
+	}
+	for pattern, maxSize := range limits.maxSizes {
+		if maxSize < 0 {
+			errMsg := fmt.Sprintf("The max body size for %q can not be negative!", pattern)
+			return errors.New(errMsg)
+		}
+	}
+	return nil
+}
+
+// 设置针对内容类型的最大尺寸。为0则表示不限制。
+// 参数pattern可以是具体的媒体类型（如“text/html”），也可以是以“/*”结尾的大类（如“image/*”）。
+// 具体的媒体类型优先于大类。
+func (limits *BodyLimits) SetMaxSize(pattern string, maxSize int64) {
+	limits.maxSizes[strings.ToLower(pattern)] = maxSize
+}
+
+// 设置被拒绝的内容类型的列表。这些类型的响应会在读取响应体之前被放弃。
+// 可以使用DefaultBinaryTypes以跳过二进制文件。
+func (limits *BodyLimits) SetRejectedTypes(patterns ...string) {
+	limits.rejectedTypes = patterns
+}
+
+// 设置当Content-Length报头表明响应体过大时是否放弃下载。
+// 对于压缩的响应，解压之前的Content-Length会被当作解压之后的长度的下限，
+// 因此其超出最大尺寸时也会放弃下载。若不放弃，则响应体会被截断。
+func (limits *BodyLimits) SetAbortOversized(abort bool) {
+	limits.abortOversized = abort
+}
+
+// 获得针对媒体类型的最大尺寸。为0则表示不限制。
+func (limits *BodyLimits) MaxSize(mediaType string) int64 {
+	mediaType = strings.ToLower(mediaType)
+	if maxSize, ok := limits.maxSizes[mediaType]; ok {
+		return maxSize
+	}
+	if index := strings.Index(mediaType, "/"); index >= 0 {
+		if maxSize, ok := limits.maxSizes[mediaType[:index]+"/*"]; ok {
+			return maxSize
+		}
+	}
+	return limits.defaultMaxSize
+}
+
+// 判断媒体类型是否被拒绝。
+func (limits *BodyLimits) Rejected(mediaType string) bool {
+	return matchMediaType(strings.ToLower(mediaType), limits.rejectedTypes)
+}
+
+func (limits *BodyLimits) String() string {
+	patterns := make([]string, 0, len(limits.maxSizes))
+	for pattern := range limits.maxSizes {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	maxSizes := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		maxSizes = append(maxSizes, fmt.Sprintf("%s:%d", pattern, limits.maxSizes[pattern]))
+	}
+	return fmt.Sprintf("{ defaultMaxSize: %d, maxSizes: %v, rejectedTypes: %v, abortOversized: %v }",
+		limits.defaultMaxSize, maxSizes, limits.rejectedTypes, limits.abortOversized)
+}
+
+// 判断媒体类型是否与模式列表中的某一项匹配。
+func matchMediaType(mediaType string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasSuffix(pattern, "/*") {
+			if strings.HasPrefix(mediaType, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// 获得响应的媒体类型。无法解析时返回空字符串。
+func responseMediaType(httpResp *http.Response) string {
+	contentType := httpResp.Header.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// 创建限制响应体的下载器中间件。
+// 被拒绝的内容类型以及（在设置了放弃下载时）Content-Length报头超出最大尺寸的响应
+// 会被直接关闭，并得到*BodyRejectedError类型的错误值。
+// 其他响应的响应体会被包装为以流的方式读取的、超出最大尺寸时被截断的形式，
+// 截断时响应会被标记（参见base.Response的Truncated方法）。
+// 为了使其他中间件读取到的也是受限的响应体，它应该被放在下载器中间件序列的末尾。
+func NewBodyLimitMiddleware(limits *BodyLimits) DownloaderMiddleware {
+	return &bodyLimitMiddleware{limits: limits}
+}
+
+// 限制响应体的下载器中间件的实现类型。
+type bodyLimitMiddleware struct {
+	BaseDownloaderMiddleware
+	limits *BodyLimits // 响应体限制。
+}
+
+func (mw *bodyLimitMiddleware) ProcessResponse(
+	ctx context.Context, req *base.Request, resp *base.Response) (*base.Response, error) {
+	httpResp := resp.HttpResp()
+	mediaType := responseMediaType(httpResp)
+	maxSize := mw.limits.MaxSize(mediaType)
+	// 被解压的响应已没有Content-Length报头，因此要使用解压之前的长度。
+	// 压缩后的长度通常不会大于解压后的长度，可以作为其下限。
+	wireLength := resp.WireLength()
+	var reason string
+	if mediaType != "" && mw.limits.Rejected(mediaType) {
+		reason = BODY_REJECT_REASON_CONTENT_TYPE
+	} else if maxSize > 0 && mw.limits.abortOversized && wireLength > maxSize {
+		reason = BODY_REJECT_REASON_TOO_LARGE
+	} else if maxSize > 0 && httpResp.ContentLength > maxSize {
+		resp.MarkTruncated()
+	}
+	if reason != "" {
+		httpResp.Body.Close()
+		return nil, &BodyRejectedError{
+			Reason:        reason,
+			Url:           req.HttpReq().URL.String(),
+			ContentType:   mediaType,
+			ContentLength: wireLength,
+			MaxSize:       maxSize,
+		}
+	}
+	if maxSize > 0 {
+		httpResp.Body = &limitedBody{body: httpResp.Body, remaining: maxSize, resp: resp}
+	}
+	return resp, nil
+}
+
+// 超出最大尺寸时被截断的响应体。
+type limitedBody struct {
+	body      io.ReadCloser  // 原响应体。
+	remaining int64          // 剩余的可读取的字节数。
+	probed    bool           // 是否已探测过截断处之后是否还有数据。
+	resp      *base.Response // 所属的响应。
+}
+
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	if lb.remaining <= 0 {
+		if !lb.probed {
+			lb.probed = true
+			var b [1]byte
+			if n, _ := io.ReadFull(lb.body, b[:]); n > 0 {
+				lb.resp.MarkTruncated()
+			}
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > lb.remaining {
+		p = p[:lb.remaining]
+	}
+	n, err := lb.body.Read(p)
+	lb.remaining -= int64(n)
+	return n, err
+}
+
+func (lb *limitedBody) Close() error {
+	return lb.body.Close()
+}
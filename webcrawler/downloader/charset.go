@@ -0,0 +1,81 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"strings"
+	base "webcrawler/base"
+	"webcrawler/tool/charset"
+)
+
+// 创建把文本响应体转换为UTF-8编码的下载器中间件。
+// 字符集依次依据字节顺序标记、Content-Type报头以及<meta>标签或XML声明判定
+// （参见charset.DetermineCharset函数）。参数defaultCharset代表无法判定时使用的字符集。
+// 判定出的字符集可以通过base.Response的Charset方法获得。
+// 转换之后，Content-Type报头中的charset参数会被改为utf-8，且Content-Length报头会被去掉。
+// 为了使来源于缓存或存档的响应也被转换，而WARC文件中保存的仍是原始的响应体，
+// 它应该被放在下载器中间件序列的开头。
+func NewCharsetMiddleware(defaultCharset string) DownloaderMiddleware {
+	return &charsetMiddleware{defaultCharset: defaultCharset}
+}
+
+// 转换响应体字符集的下载器中间件的实现类型。
+type charsetMiddleware struct {
+	BaseDownloaderMiddleware
+	defaultCharset string // 无法判定时使用的字符集。
+}
+
+func (mw *charsetMiddleware) ProcessResponse(
+	ctx context.Context, req *base.Request, resp *base.Response) (*base.Response, error) {
+	httpResp := resp.HttpResp()
+	contentType := httpResp.Header.Get("Content-Type")
+	mediaType := responseMediaType(httpResp)
+	if contentType != "" && !textMediaType(mediaType) {
+		return resp, nil
+	}
+	body := httpResp.Body
+	bufReader := bufio.NewReaderSize(body, charset.PrescanLength)
+	// 即使内容不足PrescanLength，Peek方法也会返回已读到的全部内容。
+	head, _ := bufReader.Peek(charset.PrescanLength)
+	name, _ := charset.DetermineCharset(head, contentType, mw.defaultCharset)
+	resp.SetCharset(name)
+	var reader io.Reader = bufReader
+	if name != charset.UTF8 || bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}) {
+		decodingReader, err := charset.NewReader(bufReader, name)
+		if err != nil {
+			return nil, err
+		}
+		reader = decodingReader
+		if mediaType == "" {
+			mediaType = "text/plain"
+		}
+		_, params, _ := mime.ParseMediaType(contentType)
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params["charset"] = charset.UTF8
+		httpResp.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+		httpResp.Header.Del("Content-Length")
+		httpResp.ContentLength = -1
+	}
+	httpResp.Body = &readCloser{Reader: reader, Closer: body}
+	return resp, nil
+}
+
+// 判断媒体类型是否代表文本。
+func textMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "application/xml" ||
+		mediaType == "application/javascript" ||
+		mediaType == "application/json"
+}
+
+// 由读取器和关闭器组成的类型。
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
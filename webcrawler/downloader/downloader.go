@@ -1,6 +1,7 @@
 package downloader
 
 import (
+	"context"
 	"net/http"
 	base "webcrawler/base"
 	mdw "webcrawler/middleware"
@@ -20,36 +21,54 @@ func genDownloaderId() uint32 {
 
 // 网页下载器的接口类型。
 type PageDownloader interface {
-	Id() uint32                                        // 获得ID。
-	Download(req base.Request) (*base.Response, error) // 根据请求下载网页并返回响应。
+	Id() uint32 // 获得ID。
+	// 根据请求下载网页并返回响应。参数ctx被取消时，下载会被中止。
+	Download(ctx context.Context, req base.Request) (*base.Response, error)
 }
 
 // 创建网页下载器。
-func NewPageDownloader(client *http.Client) PageDownloader {
+// 参数middlewares代表下载器中间件的序列（参见DownloaderMiddleware）。
+func NewPageDownloader(client *http.Client, middlewares ...DownloaderMiddleware) PageDownloader {
 	id := genDownloaderId()
 	if client == nil {
 		client = &http.Client{}
 	}
 	return &myPageDownloader{
-		id:         id,
-		httpClient: *client,
+		id:          id,
+		httpClient:  *client,
+		middlewares: middlewares,
 	}
 }
 
 // 网页下载器的实现类型。
 type myPageDownloader struct {
-	id         uint32      // ID。
-	httpClient http.Client // HTTP客户端。
+	id          uint32                 // ID。
+	httpClient  http.Client            // HTTP客户端。
+	middlewares []DownloaderMiddleware // 下载器中间件的序列。
 }
 
 func (dl *myPageDownloader) Id() uint32 {
 	return dl.id
 }
 
-func (dl *myPageDownloader) Download(req base.Request) (*base.Response, error) {
+func (dl *myPageDownloader) Download(ctx context.Context, req base.Request) (*base.Response, error) {
+	// 下载使用的是请求的副本。这样既可以避免中间件的修改影响到调度器持有的原请求，
+	// 又可以使带有请求体的请求在重试时发送完整的请求体。
+	reqCopy := req.WithHttpReq(req.NewHttpReq(ctx))
+	if len(dl.middlewares) == 0 {
+		return dl.do(ctx, reqCopy)
+	}
+	return runMiddlewares(ctx, dl.middlewares, reqCopy,
+		func(req *base.Request) (*base.Response, error) {
+			return dl.do(ctx, req)
+		})
+}
+
+// 执行HTTP请求。
+func (dl *myPageDownloader) do(ctx context.Context, req *base.Request) (*base.Response, error) {
 	httpReq := req.HttpReq()
 	logger.Infof("Do the request (url=%s)... \n", httpReq.URL)
-	httpResp, err := dl.httpClient.Do(httpReq)
+	httpResp, err := dl.httpClient.Do(httpReq.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,286 @@
+package downloader
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	base "webcrawler/base"
+)
+
+// 解压函数的类型。它会基于参数r创建读出解压后内容的读取器。
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+// 已注册的解压函数的字典。键为内容编码的名称。
+var decompressors = map[string]Decompressor{
+	"gzip":    newGzipReader,
+	"x-gzip":  newGzipReader,
+	"deflate": newDeflateReader,
+	"br":      newBrotliReader,
+}
+
+// 解压函数的字典的读写锁。
+var decompressorsRWMutex sync.RWMutex
+
+// 注册针对内容编码的解压函数。已有的同名解压函数会被替换。
+// 内置的解压函数支持gzip、deflate和br（brotli）。
+// 只有已注册的内容编码才会出现在Accept-Encoding报头中。
+func RegisterDecompressor(encoding string, d Decompressor) {
+	decompressorsRWMutex.Lock()
+	defer decompressorsRWMutex.Unlock()
+	decompressors[strings.ToLower(encoding)] = d
+}
+
+// 获得针对内容编码的解压函数。
+func getDecompressor(encoding string) (Decompressor, bool) {
+	decompressorsRWMutex.RLock()
+	defer decompressorsRWMutex.RUnlock()
+	d, ok := decompressors[encoding]
+	return d, ok
+}
+
+// 获得Accept-Encoding报头的值。它包含所有已注册的内容编码（x-gzip除外）。
+func acceptEncoding() string {
+	decompressorsRWMutex.RLock()
+	defer decompressorsRWMutex.RUnlock()
+	encodings := make([]string, 0, len(decompressors))
+	for encoding := range decompressors {
+		if encoding != "x-gzip" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	sort.Strings(encodings)
+	return strings.Join(encodings, ", ")
+}
+
+func newGzipReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// 创建br（brotli）编码的解压读取器。
+func newBrotliReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
+
+// 创建deflate编码的解压读取器。
+// 按照规范，deflate编码的内容应带有zlib的包装，但有些服务器会直接发送原始的deflate数据。
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	bufReader := bufio.NewReader(r)
+	if head, err := bufReader.Peek(2); err == nil && isZlibHeader(head) {
+		return zlib.NewReader(bufReader)
+	}
+	return flate.NewReader(bufReader), nil
+}
+
+// 判断数据是否以zlib头开始。
+func isZlibHeader(head []byte) bool {
+	return head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0
+}
+
+// gzip数据的开头的魔数。
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// 表示内容编码不被支持的错误类型。
+type UnsupportedEncodingError struct {
+	Encoding string // 内容编码。
+	Url      string // 请求的URL。
+}
+
+func (err *UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("Unsupported content encoding %q! (url=%s)", err.Encoding, err.Url)
+}
+
+// 传输统计。它记录了读取到的压缩前（即网络上传输的）和解压后的响应体的字节数。
+type TransferStats struct {
+	compressed   uint64 // 网络上传输的字节数。
+	uncompressed uint64 // 解压后的字节数。
+	decoded      uint64 // 被解压的响应的数量。
+}
+
+// 创建传输统计。
+func NewTransferStats() *TransferStats {
+	return &TransferStats{}
+}
+
+// 获得网络上传输的响应体的字节数。
+func (stats *TransferStats) CompressedBytes() uint64 {
+	return atomic.LoadUint64(&stats.compressed)
+}
+
+// 获得解压后的响应体的字节数。
+func (stats *TransferStats) UncompressedBytes() uint64 {
+	return atomic.LoadUint64(&stats.uncompressed)
+}
+
+// 获得被解压的响应的数量。
+func (stats *TransferStats) DecodedNumber() uint64 {
+	return atomic.LoadUint64(&stats.decoded)
+}
+
+var transferStatsSummaryTemplate = "compressed: %d, uncompressed: %d, decoded responses: %d"
+
+// 获取摘要信息。
+func (stats *TransferStats) Summary() string {
+	return fmt.Sprintf(transferStatsSummaryTemplate,
+		stats.CompressedBytes(), stats.UncompressedBytes(), stats.DecodedNumber())
+}
+
+// 创建进行内容编码协商的下载器中间件。
+// 若请求中没有Accept-Encoding报头，则它会添加包含所有已注册的内容编码的该报头，
+// 这同时会使HTTP客户端不再自行解压。
+// HTTP缓存等中间件会依据该报头匹配带有“Vary: Accept-Encoding”的响应，
+// 因此它应该被放在下载器中间件序列的开头，而解压中间件则应被放在末尾。
+func NewAcceptEncodingMiddleware() DownloaderMiddleware {
+	return NewRequestHookMiddleware(func(ctx context.Context, req *base.Request) error {
+		setAcceptEncoding(req)
+		return nil
+	})
+}
+
+// 在请求中没有Accept-Encoding报头时为其添加该报头。
+func setAcceptEncoding(req *base.Request) {
+	header := req.HttpReq().Header
+	if header.Get("Accept-Encoding") == "" {
+		header.Set("Accept-Encoding", acceptEncoding())
+	}
+}
+
+// 创建进行透明解压的下载器中间件。
+// 若请求中还没有Accept-Encoding报头，则它会像NewAcceptEncodingMiddleware函数创建的中间件那样添加该报头。
+// 响应体会按照Content-Encoding报头被解压，之后该报头和Content-Length报头会被去掉，
+// 而解压之前的长度会被记录在响应中（参见base.Response的WireLength方法）。
+// 对于错误地标注了gzip（或未标注但实际是gzip）的文本响应，它会依据gzip的魔数进行判断。
+// 不被支持的内容编码会导致*UnsupportedEncodingError类型的错误值。
+// 参数stats代表传输统计。字节数会在响应体被读取的同时被记录。它可以为nil。
+// 为了使其他中间件读取到的都是解压后的响应体，它应该被放在下载器中间件序列的最末尾。
+func NewDecompressionMiddleware(stats *TransferStats) DownloaderMiddleware {
+	return &decompressionMiddleware{stats: stats}
+}
+
+// 进行透明解压的下载器中间件的实现类型。
+type decompressionMiddleware struct {
+	BaseDownloaderMiddleware
+	stats *TransferStats // 传输统计。
+}
+
+func (mw *decompressionMiddleware) ProcessRequest(
+	ctx context.Context, req *base.Request) (*base.Response, error) {
+	setAcceptEncoding(req)
+	return nil, nil
+}
+
+func (mw *decompressionMiddleware) ProcessResponse(
+	ctx context.Context, req *base.Request, resp *base.Response) (*base.Response, error) {
+	httpResp := resp.HttpResp()
+	rawBody := httpResp.Body
+	var reader io.Reader = rawBody
+	if mw.stats != nil {
+		reader = &countingReader{reader: reader, count: &mw.stats.compressed}
+	}
+	bufReader := bufio.NewReader(reader)
+	reader = bufReader
+	head, _ := bufReader.Peek(len(gzipMagic))
+	gzipped := len(head) == len(gzipMagic) && head[0] == gzipMagic[0] && head[1] == gzipMagic[1]
+	encodings := contentEncodings(httpResp.Header.Get("Content-Encoding"))
+	switch {
+	case len(encodings) == 1 && (encodings[0] == "gzip" || encodings[0] == "x-gzip") && !gzipped:
+		// 标注为gzip但并非gzip数据。空的响应体（如304响应的响应体）不需要解压。
+		if len(head) > 0 {
+			logger.Warnf("The response body is not gzipped as labeled. (url=%s)\n", req.HttpReq().URL)
+		}
+		httpResp.Header.Del("Content-Encoding")
+		encodings = nil
+	case len(encodings) == 0 && gzipped && mislabelCandidate(responseMediaType(httpResp)):
+		// 未标注但实际是gzip数据。
+		logger.Warnf("The response body is gzipped without being labeled. (url=%s)\n", req.HttpReq().URL)
+		encodings = []string{"gzip"}
+	}
+	closers := []io.Closer{rawBody}
+	// 多个内容编码需要按照与其被应用时相反的顺序解压。
+	for i := len(encodings) - 1; i >= 0; i-- {
+		decompress, ok := getDecompressor(encodings[i])
+		if !ok {
+			rawBody.Close()
+			return nil, &UnsupportedEncodingError{
+				Encoding: encodings[i],
+				Url:      req.HttpReq().URL.String(),
+			}
+		}
+		decompressed, err := decompress(reader)
+		if err != nil {
+			rawBody.Close()
+			return nil, err
+		}
+		reader = decompressed
+		closers = append(closers, decompressed)
+	}
+	if len(encodings) > 0 {
+		resp.SetWireLength(httpResp.ContentLength)
+		httpResp.Header.Del("Content-Encoding")
+		httpResp.Header.Del("Content-Length")
+		httpResp.ContentLength = -1
+		httpResp.Uncompressed = true
+		if mw.stats != nil {
+			atomic.AddUint64(&mw.stats.decoded, 1)
+		}
+	}
+	if mw.stats != nil {
+		reader = &countingReader{reader: reader, count: &mw.stats.uncompressed}
+	}
+	httpResp.Body = &multiCloser{Reader: reader, closers: closers}
+	return resp, nil
+}
+
+// 解析Content-Encoding报头。identity编码会被忽略。
+func contentEncodings(value string) []string {
+	var encodings []string
+	for _, encoding := range strings.Split(value, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" && encoding != "identity" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings
+}
+
+// 判断未标注内容编码的gzip数据是否应被视为被错误标注的。
+// 只有文本内容才会被这样处理，以免误解压本身就是gzip文件的下载内容。
+func mislabelCandidate(mediaType string) bool {
+	return mediaType == "" || textMediaType(mediaType)
+}
+
+// 能够统计读取的字节数的读取器。
+type countingReader struct {
+	reader io.Reader // 底层的读取器。
+	count  *uint64   // 字节数的计数。
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	atomic.AddUint64(cr.count, uint64(n))
+	return n, err
+}
+
+// 关闭时会按照相反的顺序关闭多个关闭器的读取器。
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer // 关闭器的列表。
+}
+
+func (mc *multiCloser) Close() error {
+	var err error
+	for i := len(mc.closers) - 1; i >= 0; i-- {
+		if closeErr := mc.closers[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
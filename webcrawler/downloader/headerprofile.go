@@ -0,0 +1,222 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	base "webcrawler/base"
+)
+
+// 报头配置的轮换方式的类型。
+type ProfileRotation string
+
+const (
+	PROFILE_ROTATE_PER_REQUEST ProfileRotation = "per-request"     // 每个请求轮流使用各报头配置。
+	PROFILE_STICKY_PER_HOST    ProfileRotation = "sticky-per-host" // 同一主机的请求总是使用同一个报头配置。
+)
+
+// 报头配置。它是一组相互协调的请求报头，
+// 如User-Agent、Accept、Accept-Language以及Sec-CH-UA等客户端提示报头。
+type HeaderProfile struct {
+	Name    string            `json:"name"`    // 名称。
+	Headers map[string]string `json:"headers"` // 报头的字典。
+}
+
+// 报头配置的集合。
+type HeaderProfiles struct {
+	rotation ProfileRotation   // 轮换方式。
+	profiles []HeaderProfile   // 报头配置的列表。
+	next     uint64            // 下一个被轮流使用的报头配置的序号。
+	sticky   map[string]string // 主机与报头配置的名称的映射。
+	mutex    sync.Mutex        // 互斥锁。
+}
+
+// 创建报头配置的集合。参数rotation为空时表示每个请求轮流使用各报头配置。
+func NewHeaderProfiles(rotation ProfileRotation, profiles ...HeaderProfile) *HeaderProfiles {
+	if rotation == "" {
+		rotation = PROFILE_ROTATE_PER_REQUEST
+	}
+	return &HeaderProfiles{
+		rotation: rotation,
+		profiles: profiles,
+		sticky:   make(map[string]string),
+	}
+}
+
+// 报头配置文件的内容。
+type headerProfilesFile struct {
+	Rotation ProfileRotation `json:"rotation"`
+	Profiles []HeaderProfile `json:"profiles"`
+}
+
+// 从JSON格式的配置文件中载入报头配置的集合。文件的内容形如：
+//
+//	{
+//	  "rotation": "sticky-per-host",
+//	  "profiles": [
+//	    { "name": "chrome-win", "headers": { "User-Agent": "...", "Accept-Language": "..." } }
+//	  ]
+//	}
+func LoadHeaderProfiles(path string) (*HeaderProfiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file headerProfilesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		errMsg := fmt.Sprintf("Invalid header profiles file %q: %s", path, err)
+		return nil, errors.New(errMsg)
+	}
+	profiles := NewHeaderProfiles(file.Rotation, file.Profiles...)
+	if err := profiles.Check(); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func (profiles *HeaderProfiles) Check() error {
+	if profiles.rotation != PROFILE_ROTATE_PER_REQUEST &&
+		profiles.rotation != PROFILE_STICKY_PER_HOST {
+		return errors.New(fmt.Sprintf("Unknown header profile rotation %q!", profiles.rotation))
+	}
+	if len(profiles.profiles) == 0 {
+		return errors.New("The header profile list is empty!")
+	}
+	names := make(map[string]bool)
+	for i, profile := range profiles.profiles {
+		if profile.Name == "" {
+			return errors.New(fmt.Sprintf("The name of the %dth header profile is empty!", i))
+		}
+		if names[profile.Name] {
+			return errors.New(fmt.Sprintf("Duplicate header profile %q!", profile.Name))
+		}
+		names[profile.Name] = true
+		for key := range profile.Headers {
+			// 内容编码由进行透明解压的中间件协商。
+			if http.CanonicalHeaderKey(key) == "Accept-Encoding" {
+				errMsg := fmt.Sprintf("The header profile %q can not contain Accept-Encoding!", profile.Name)
+				return errors.New(errMsg)
+			}
+		}
+	}
+	return nil
+}
+
+// 获得轮换方式。
+func (profiles *HeaderProfiles) Rotation() ProfileRotation {
+	return profiles.rotation
+}
+
+// 获得所有报头配置的名称。
+func (profiles *HeaderProfiles) Names() []string {
+	names := make([]string, 0, len(profiles.profiles))
+	for _, profile := range profiles.profiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// 获得指定名称的报头配置。
+func (profiles *HeaderProfiles) Profile(name string) (HeaderProfile, bool) {
+	for _, profile := range profiles.profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return HeaderProfile{}, false
+}
+
+// 为请求确定报头配置，并把其名称记录在请求中。
+// 若请求已经指定了存在的报头配置（参见base.Request的SetHeaderProfile方法），则使用该配置，
+// 否则按照轮换方式选择。调度器会在请求被放入请求缓存之前调用它，
+// 以使重试和爬取边界中的请求都带有实际使用的报头配置的名称。
+func (profiles *HeaderProfiles) Assign(req *base.Request) HeaderProfile {
+	if profile, ok := profiles.Profile(req.HeaderProfile()); ok {
+		return profile
+	}
+	if req.HeaderProfile() != "" {
+		logger.Warnf("Unknown header profile %q, select another one. (url=%s)\n",
+			req.HeaderProfile(), req.HttpReq().URL)
+	}
+	profile := profiles.Select(req.HttpReq())
+	req.SetHeaderProfile(profile.Name)
+	return profile
+}
+
+// 按照轮换方式为请求选择报头配置。
+func (profiles *HeaderProfiles) Select(httpReq *http.Request) HeaderProfile {
+	profiles.mutex.Lock()
+	defer profiles.mutex.Unlock()
+	if profiles.rotation == PROFILE_STICKY_PER_HOST {
+		host := strings.ToLower(httpReq.URL.Hostname())
+		if name, ok := profiles.sticky[host]; ok {
+			if profile, ok := profiles.Profile(name); ok {
+				return profile
+			}
+		}
+		profile := profiles.nextProfile()
+		profiles.sticky[host] = profile.Name
+		return profile
+	}
+	return profiles.nextProfile()
+}
+
+// 获得下一个被轮流使用的报头配置。
+func (profiles *HeaderProfiles) nextProfile() HeaderProfile {
+	profile := profiles.profiles[profiles.next%uint64(len(profiles.profiles))]
+	profiles.next++
+	return profile
+}
+
+func (profiles *HeaderProfiles) String() string {
+	return fmt.Sprintf("{ rotation: %s, profiles: %v }", profiles.rotation, profiles.Names())
+}
+
+// 被视为可能遭到封锁的响应状态码。
+var blockedStatusCodes = map[int]bool{
+	http.StatusForbidden:          true,
+	http.StatusTooManyRequests:    true,
+	http.StatusServiceUnavailable: true,
+}
+
+// 创建为请求添加报头配置的下载器中间件。
+// 报头配置由HeaderProfiles的Assign方法确定。请求中已有的报头不会被覆盖。
+// 实际使用的报头配置的名称会被记录在响应中（参见base.Response的HeaderProfile方法）。
+// 对于可能遭到封锁的响应（403、429和503），它会连同报头配置的名称一起被记录在日志中。
+// 为了使HTTP缓存等中间件看到的是完整的请求报头，它应该被放在下载器中间件序列的开头。
+func NewHeaderProfileMiddleware(profiles *HeaderProfiles) DownloaderMiddleware {
+	return &headerProfileMiddleware{profiles: profiles}
+}
+
+// 添加报头配置的下载器中间件的实现类型。
+type headerProfileMiddleware struct {
+	BaseDownloaderMiddleware
+	profiles *HeaderProfiles // 报头配置的集合。
+}
+
+func (mw *headerProfileMiddleware) ProcessRequest(
+	ctx context.Context, req *base.Request) (*base.Response, error) {
+	httpReq := req.HttpReq()
+	profile := mw.profiles.Assign(req)
+	for key, value := range profile.Headers {
+		if httpReq.Header.Get(key) == "" {
+			httpReq.Header.Set(key, value)
+		}
+	}
+	return nil, nil
+}
+
+func (mw *headerProfileMiddleware) ProcessResponse(
+	ctx context.Context, req *base.Request, resp *base.Response) (*base.Response, error) {
+	resp.SetHeaderProfile(req.HeaderProfile())
+	if statusCode := resp.HttpResp().StatusCode; blockedStatusCodes[statusCode] {
+		logger.Warnf("The request may be blocked. (statusCode=%d, headerProfile=%s, url=%s)\n",
+			statusCode, req.HeaderProfile(), req.HttpReq().URL)
+	}
+	return resp, nil
+}
@@ -0,0 +1,462 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	base "webcrawler/base"
+	"webcrawler/tool/canon"
+)
+
+// 表示响应来源于HTTP缓存的报头。只有来源于缓存的响应才会含有该报头。
+const CacheStatusHeader = "X-Webcrawler-Cache"
+
+// 响应来源于HTTP缓存的方式。
+const (
+	CACHE_STATUS_HIT         = "HIT"         // 缓存仍然新鲜，未发送请求。
+	CACHE_STATUS_REVALIDATED = "REVALIDATED" // 经服务器确认（304）后使用了缓存。
+)
+
+// 可以被缓存的HTTP响应状态码的字典（参见RFC 7231第6.1节）。
+var cacheableStatusCodes = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// 在验证时不应被304响应覆盖的报头的列表。
+var revalidationSkippedHeaders = []string{
+	"Content-Length",
+	"Content-Encoding",
+	"Transfer-Encoding",
+	CacheStatusHeader,
+}
+
+// HTTP缓存条目。
+type CacheEntry struct {
+	Url        string            `json:"url"`            // 请求的URL。
+	StatusCode int               `json:"statusCode"`     // 响应状态码。
+	Header     http.Header       `json:"header"`         // 响应报头。
+	Body       []byte            `json:"body"`           // 响应体。
+	Vary       map[string]string `json:"vary,omitempty"` // Vary报头所列的请求报头的值。
+	StoredAt   time.Time         `json:"storedAt"`       // 被存储或被验证的时间。
+}
+
+// HTTP缓存存储的接口类型。其实现必须是并发安全的。
+type CacheStore interface {
+	// 获取缓存条目。若不存在，则两个结果值均为nil。
+	Get(key string) (*CacheEntry, error)
+	// 存储缓存条目。已有的同键条目会被替换。
+	Put(key string, entry *CacheEntry) error
+	// 删除缓存条目。
+	Delete(key string) error
+}
+
+// 创建基于磁盘的HTTP缓存存储。每个缓存条目都会被保存在参数dir代表的目录中的一个文件里。
+func NewDiskCacheStore(dir string) (CacheStore, error) {
+	if dir == "" {
+		return nil, errors.New("Empty HTTP cache directory!")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &diskCacheStore{dir: dir}, nil
+}
+
+// 基于磁盘的HTTP缓存存储的实现类型。
+type diskCacheStore struct {
+	dir string // 缓存目录。
+}
+
+// 获得缓存条目的文件路径。
+func (store *diskCacheStore) path(key string) string {
+	return filepath.Join(store.dir, keyFileName(key))
+}
+
+func (store *diskCacheStore) Get(key string) (*CacheEntry, error) {
+	data, err := os.ReadFile(store.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("Broken HTTP cache entry: %s (key=%s)", err, key)
+	}
+	// 摘要冲突时视为不存在。
+	if entry.Url != key {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (store *diskCacheStore) Put(key string, entry *CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(store.path(key), data)
+}
+
+func (store *diskCacheStore) Delete(key string) error {
+	err := os.Remove(store.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// 获得与键对应的文件名。文件名为键的SHA-1摘要。
+func keyFileName(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// 把数据写入文件。数据会先被写入同一目录中的临时文件再改名，以免并发的读取得到不完整的内容。
+func writeFileAtomically(path string, data []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+	}
+	return err
+}
+
+// 缓存新鲜度策略的接口类型。
+// 新鲜的缓存条目会被直接使用，而不新鲜的则需要先经过服务器的验证。
+type FreshnessPolicy interface {
+	// 判断缓存条目在参数now代表的时间是否新鲜。
+	Fresh(entry *CacheEntry, now time.Time) bool
+}
+
+// 创建遵循RFC 7234的新鲜度策略。
+// 新鲜期依次由Cache-Control报头的max-age指令、Expires报头或Last-Modified报头（启发式）决定。
+// 带有no-cache指令的响应总是需要验证。
+func NewRFC7234Policy() FreshnessPolicy {
+	return rfc7234Policy{}
+}
+
+// 创建总是需要验证的新鲜度策略。每次请求都会带上条件报头。
+func NewAlwaysRevalidatePolicy() FreshnessPolicy {
+	return alwaysRevalidatePolicy{}
+}
+
+// 创建永不过期的新鲜度策略。缓存条目一经存储就不会再被请求。仅适用于开发和调试。
+func NewNeverExpirePolicy() FreshnessPolicy {
+	return neverExpirePolicy{}
+}
+
+// 遵循RFC 7234的新鲜度策略的实现类型。
+type rfc7234Policy struct{}
+
+func (rfc7234Policy) Fresh(entry *CacheEntry, now time.Time) bool {
+	directives := parseCacheControl(entry.Header.Get("Cache-Control"))
+	if _, ok := directives["no-cache"]; ok {
+		return false
+	}
+	return currentAge(entry, now) < freshnessLifetime(entry, directives)
+}
+
+// 总是需要验证的新鲜度策略的实现类型。
+type alwaysRevalidatePolicy struct{}
+
+func (alwaysRevalidatePolicy) Fresh(entry *CacheEntry, now time.Time) bool {
+	return false
+}
+
+// 永不过期的新鲜度策略的实现类型。
+type neverExpirePolicy struct{}
+
+func (neverExpirePolicy) Fresh(entry *CacheEntry, now time.Time) bool {
+	return true
+}
+
+// 计算缓存条目的新鲜期（参见RFC 7234第4.2.1节）。
+func freshnessLifetime(entry *CacheEntry, directives map[string]string) time.Duration {
+	if value, ok := directives["max-age"]; ok {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+	date := responseDate(entry)
+	if expires := entry.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return t.Sub(date)
+	}
+	// 启发式新鲜期：自上次修改以来的时长的十分之一。
+	if lastModified, err := http.ParseTime(entry.Header.Get("Last-Modified")); err == nil &&
+		cacheableStatusCodes[entry.StatusCode] && lastModified.Before(date) {
+		return date.Sub(lastModified) / 10
+	}
+	return 0
+}
+
+// 计算缓存条目的当前年龄（参见RFC 7234第4.2.3节）。
+func currentAge(entry *CacheEntry, now time.Time) time.Duration {
+	age := entry.StoredAt.Sub(responseDate(entry))
+	if age < 0 {
+		age = 0
+	}
+	if seconds, err := strconv.ParseInt(entry.Header.Get("Age"), 10, 64); err == nil {
+		if ageValue := time.Duration(seconds) * time.Second; ageValue > age {
+			age = ageValue
+		}
+	}
+	return age + now.Sub(entry.StoredAt)
+}
+
+// 获得响应的Date报头代表的时间。若其无效，则使用存储时间。
+func responseDate(entry *CacheEntry) time.Time {
+	if date, err := http.ParseTime(entry.Header.Get("Date")); err == nil {
+		return date
+	}
+	return entry.StoredAt
+}
+
+// 解析Cache-Control报头。指令名称会被转换为小写形式。
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg := part, ""
+		if index := strings.Index(part, "="); index >= 0 {
+			name, arg = part[:index], strings.Trim(strings.TrimSpace(part[index+1:]), `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(name))] = arg
+	}
+	return directives
+}
+
+// 创建HTTP缓存中间件。
+// 它会缓存GET请求的响应，并以规范化之后的URL作为键。
+// 新鲜的缓存条目会被直接当作响应；不新鲜的则会使请求带上If-None-Match和If-Modified-Since报头，
+// 而服务器返回的304响应会被替换为缓存的响应，以便分析器照常处理。
+// 来源于缓存的响应会含有CacheStatusHeader报头。
+// 参数policy代表新鲜度策略。若其为nil，则使用NewRFC7234Policy的结果。
+// 参数canonicalizer代表URL规范化器。若其为nil，则使用不去掉跟踪参数的默认规范化器。
+func NewHttpCacheMiddleware(
+	store CacheStore,
+	policy FreshnessPolicy,
+	canonicalizer canon.Canonicalizer) (DownloaderMiddleware, error) {
+	if store == nil {
+		return nil, errors.New("The HTTP cache store is nil!")
+	}
+	if policy == nil {
+		policy = NewRFC7234Policy()
+	}
+	if canonicalizer == nil {
+		canonicalizer = canon.NewCanonicalizer(false)
+	}
+	return &httpCacheMiddleware{
+		store:         store,
+		policy:        policy,
+		canonicalizer: canonicalizer,
+	}, nil
+}
+
+// HTTP缓存中间件的实现类型。
+type httpCacheMiddleware struct {
+	BaseDownloaderMiddleware
+	store         CacheStore          // 缓存存储。
+	policy        FreshnessPolicy     // 新鲜度策略。
+	canonicalizer canon.Canonicalizer // URL规范化器。
+}
+
+func (mw *httpCacheMiddleware) ProcessRequest(
+	ctx context.Context, req *base.Request) (*base.Response, error) {
+	httpReq := req.HttpReq()
+	if !cacheableRequest(httpReq) {
+		return nil, nil
+	}
+	entry := mw.lookup(httpReq)
+	if entry == nil {
+		return nil, nil
+	}
+	if mw.policy.Fresh(entry, time.Now()) {
+		logger.Infof("Use the fresh cached response. (url=%s)\n", httpReq.URL)
+		return entry.response(httpReq, req.Depth(), CACHE_STATUS_HIT), nil
+	}
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		httpReq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		httpReq.Header.Set("If-Modified-Since", lastModified)
+	}
+	return nil, nil
+}
+
+func (mw *httpCacheMiddleware) ProcessResponse(
+	ctx context.Context, req *base.Request, resp *base.Response) (*base.Response, error) {
+	httpReq := req.HttpReq()
+	httpResp := resp.HttpResp()
+	if !cacheableRequest(httpReq) || httpResp.Header.Get(CacheStatusHeader) != "" {
+		return resp, nil
+	}
+	key := mw.canonicalizer.Key(httpReq.URL)
+	if httpResp.StatusCode == http.StatusNotModified {
+		entry := mw.lookup(httpReq)
+		if entry == nil {
+			return resp, nil
+		}
+		httpResp.Body.Close()
+		for name, values := range httpResp.Header {
+			if !containsHeader(revalidationSkippedHeaders, name) {
+				entry.Header[name] = values
+			}
+		}
+		entry.StoredAt = time.Now()
+		if err := mw.store.Put(key, entry); err != nil {
+			logger.Warnf("Couldn't update the cached response: %s (url=%s)\n", err, httpReq.URL)
+		}
+		logger.Infof("Use the revalidated cached response. (url=%s)\n", httpReq.URL)
+		return entry.response(httpReq, req.Depth(), CACHE_STATUS_REVALIDATED), nil
+	}
+	if !storableResponse(httpResp) {
+		return resp, nil
+	}
+	body, err := io.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	httpResp.Body = io.NopCloser(bytes.NewReader(body))
+	// 被截断的响应体不完整，不能被缓存。
+	if resp.Truncated() {
+		return resp, nil
+	}
+	entry := &CacheEntry{
+		Url:        key,
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header.Clone(),
+		Body:       body,
+		Vary:       varyValues(httpReq, httpResp.Header),
+		StoredAt:   time.Now(),
+	}
+	if err := mw.store.Put(key, entry); err != nil {
+		logger.Warnf("Couldn't store the response: %s (url=%s)\n", err, httpReq.URL)
+	}
+	return resp, nil
+}
+
+// 查找与请求匹配的缓存条目。
+func (mw *httpCacheMiddleware) lookup(httpReq *http.Request) *CacheEntry {
+	entry, err := mw.store.Get(mw.canonicalizer.Key(httpReq.URL))
+	if err != nil {
+		logger.Warnf("Couldn't get the cached response: %s (url=%s)\n", err, httpReq.URL)
+		return nil
+	}
+	if entry == nil {
+		return nil
+	}
+	for name, value := range entry.Vary {
+		if httpReq.Header.Get(name) != value {
+			return nil
+		}
+	}
+	return entry
+}
+
+// 根据缓存条目生成响应。
+func (entry *CacheEntry) response(
+	httpReq *http.Request, depth uint32, cacheStatus string) *base.Response {
+	header := entry.Header.Clone()
+	header.Set(CacheStatusHeader, cacheStatus)
+	return base.NewResponse(newStoredHttpResp(httpReq, entry.StatusCode, header, entry.Body), depth)
+}
+
+// 根据被存储的状态码、报头和响应体生成HTTP响应。
+func newStoredHttpResp(
+	httpReq *http.Request, statusCode int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       httpReq,
+	}
+}
+
+// 判断请求是否可以使用缓存。
+func cacheableRequest(httpReq *http.Request) bool {
+	if httpReq.Method != "" && httpReq.Method != http.MethodGet {
+		return false
+	}
+	_, noStore := parseCacheControl(httpReq.Header.Get("Cache-Control"))["no-store"]
+	return !noStore
+}
+
+// 判断响应是否可以被存储（参见RFC 7234第3节）。
+func storableResponse(httpResp *http.Response) bool {
+	if !cacheableStatusCodes[httpResp.StatusCode] {
+		return false
+	}
+	if _, noStore := parseCacheControl(httpResp.Header.Get("Cache-Control"))["no-store"]; noStore {
+		return false
+	}
+	return strings.TrimSpace(httpResp.Header.Get("Vary")) != "*"
+}
+
+// 获得Vary报头所列的请求报头的值。
+func varyValues(httpReq *http.Request, header http.Header) map[string]string {
+	var values map[string]string
+	for _, field := range header.Values("Vary") {
+		for _, name := range strings.Split(field, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[name] = httpReq.Header.Get(name)
+		}
+	}
+	return values
+}
+
+// 判断报头名称是否在列表中。
+func containsHeader(names []string, name string) bool {
+	for _, n := range names {
+		if http.CanonicalHeaderKey(n) == http.CanonicalHeaderKey(name) {
+			return true
+		}
+	}
+	return false
+}
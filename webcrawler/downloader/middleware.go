@@ -0,0 +1,124 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	base "webcrawler/base"
+)
+
+// 表示请求已被下载器中间件丢弃的错误。
+// 调度器不会把它当作下载错误报告，也不会重试被丢弃的请求。
+var ErrRequestDropped = errors.New("The request has been dropped by a downloader middleware!")
+
+// 下载器中间件的接口类型。
+// 网页下载器会在下载前后依次调用各个中间件。
+// ProcessRequest方法会按照中间件的顺序被调用，而ProcessResponse方法和ProcessError方法则按照相反的顺序被调用。
+// 只有ProcessRequest方法已被调用过的中间件才会收到响应或错误。
+// 中间件可能会被多个网页下载器并发地调用，因此其实现必须是并发安全的。
+type DownloaderMiddleware interface {
+	// 在下载之前处理请求。参数req是原请求的副本，可以被直接修改（例如添加报头）。
+	// 若结果值resp不为nil，则不再进行真正的下载，后续中间件的ProcessRequest方法也不会被调用。
+	// 若结果值err不为nil，则放弃下载，并转而调用ProcessError方法。
+	// 返回ErrRequestDropped可以丢弃请求。
+	ProcessRequest(ctx context.Context, req *base.Request) (resp *base.Response, err error)
+	// 处理下载得到的响应。可以返回原响应、新的响应或错误。
+	ProcessResponse(ctx context.Context, req *base.Request, resp *base.Response) (*base.Response, error)
+	// 处理下载或其他中间件产生的错误。
+	// 若结果值resp不为nil，则错误被视为已被恢复，该响应会被当作下载结果。
+	// 若结果值newErr不为nil，则它会取代原错误。若两者均为nil，则原错误保持不变。
+	ProcessError(ctx context.Context, req *base.Request, err error) (resp *base.Response, newErr error)
+}
+
+// 下载器中间件的基础类型。它的各个方法都会原样放行请求、响应和错误。
+// 自定义的中间件可以嵌入它，并只实现自己关心的方法。
+type BaseDownloaderMiddleware struct{}
+
+func (BaseDownloaderMiddleware) ProcessRequest(
+	ctx context.Context, req *base.Request) (*base.Response, error) {
+	return nil, nil
+}
+
+func (BaseDownloaderMiddleware) ProcessResponse(
+	ctx context.Context, req *base.Request, resp *base.Response) (*base.Response, error) {
+	return resp, nil
+}
+
+func (BaseDownloaderMiddleware) ProcessError(
+	ctx context.Context, req *base.Request, err error) (*base.Response, error) {
+	return nil, err
+}
+
+// 被用来在下载之前处理请求的函数类型。
+type RequestHook func(ctx context.Context, req *base.Request) error
+
+// 创建只在下载之前处理请求的下载器中间件。
+// 参数hook返回的非nil错误值会导致下载被放弃。
+func NewRequestHookMiddleware(hook RequestHook) DownloaderMiddleware {
+	return &requestHookMiddleware{hook: hook}
+}
+
+// 只在下载之前处理请求的下载器中间件的实现类型。
+type requestHookMiddleware struct {
+	BaseDownloaderMiddleware
+	hook RequestHook // 请求处理函数。
+}
+
+func (mw *requestHookMiddleware) ProcessRequest(
+	ctx context.Context, req *base.Request) (*base.Response, error) {
+	return nil, mw.hook(ctx, req)
+}
+
+// 创建添加报头的下载器中间件。请求中已有的同名报头会被覆盖。
+func NewHeaderMiddleware(header http.Header) DownloaderMiddleware {
+	return NewRequestHookMiddleware(func(ctx context.Context, req *base.Request) error {
+		for k, v := range header {
+			req.HttpReq().Header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+		}
+		return nil
+	})
+}
+
+// 依次调用下载器中间件并执行下载。
+// 参数do代表真正的下载操作。只有当没有中间件直接给出响应或错误时，它才会被调用。
+func runMiddlewares(
+	ctx context.Context,
+	middlewares []DownloaderMiddleware,
+	req *base.Request,
+	do func(req *base.Request) (*base.Response, error)) (*base.Response, error) {
+	var resp *base.Response
+	var err error
+	called := 0
+	for _, mw := range middlewares {
+		called++
+		resp, err = mw.ProcessRequest(ctx, req)
+		if resp != nil || err != nil {
+			break
+		}
+	}
+	if resp == nil && err == nil {
+		resp, err = do(req)
+	}
+	for i := called - 1; i >= 0; i-- {
+		if errors.Is(err, ErrRequestDropped) {
+			break
+		}
+		if err != nil {
+			newResp, newErr := middlewares[i].ProcessError(ctx, req, err)
+			if newResp != nil {
+				resp, err = newResp, nil
+			} else if newErr != nil {
+				err = newErr
+			}
+		} else {
+			resp, err = middlewares[i].ProcessResponse(ctx, req, resp)
+			if resp == nil && err == nil {
+				err = ErrRequestDropped
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,195 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+	base "webcrawler/base"
+	"webcrawler/tool/canon"
+)
+
+// 表示请求在HTTP流量存档中不存在的错误。
+// 回放模式下，未被存档的请求总会得到包装了该错误的错误值，而不会访问网络。
+var ErrNotArchived = errors.New("The request is not archived!")
+
+// HTTP流量存档条目。它代表了一对被记录下来的请求和响应。
+type ArchiveEntry struct {
+	Method        string      `json:"method"`                // 请求方法。
+	Url           string      `json:"url"`                   // 请求的URL。
+	RequestHeader http.Header `json:"requestHeader"`         // 请求报头。
+	RequestBody   []byte      `json:"requestBody,omitempty"` // 请求体。
+	FinalUrl      string      `json:"finalUrl,omitempty"`    // 重定向之后的URL。与请求的URL相同时为空。
+	StatusCode    int         `json:"statusCode"`            // 响应状态码。
+	Header        http.Header `json:"header"`                // 响应报头。
+	Body          []byte      `json:"body"`                  // 响应体。
+	Truncated     bool        `json:"truncated,omitempty"`   // 响应体是否已被截断。
+	RecordedAt    time.Time   `json:"recordedAt"`            // 记录时间。
+}
+
+// HTTP流量存档的接口类型。其实现必须是并发安全的。
+type Archive interface {
+	// 加载存档条目。若不存在，则两个结果值均为nil。
+	Load(key string) (*ArchiveEntry, error)
+	// 保存存档条目。已有的同键条目会被替换。
+	Save(key string, entry *ArchiveEntry) error
+}
+
+// 创建基于目录的HTTP流量存档。每个存档条目都会被保存在参数dir代表的目录中的一个JSON文件里，
+// 因此存档可以被直接提交到代码仓库中，供解析函数的测试使用。
+func NewDirArchive(dir string) (Archive, error) {
+	if dir == "" {
+		return nil, errors.New("Empty archive directory!")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirArchive{dir: dir}, nil
+}
+
+// 基于目录的HTTP流量存档的实现类型。
+type dirArchive struct {
+	dir string // 存档目录。
+}
+
+func (archive *dirArchive) Load(key string) (*ArchiveEntry, error) {
+	data, err := os.ReadFile(filepath.Join(archive.dir, keyFileName(key)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entry ArchiveEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("Broken archive entry: %s (key=%s)", err, key)
+	}
+	return &entry, nil
+}
+
+func (archive *dirArchive) Save(key string, entry *ArchiveEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(filepath.Join(archive.dir, keyFileName(key)), data)
+}
+
+// 获得请求在存档中的键。它由请求方法和规范化之后的URL组成。
+// 对于带有请求体的请求（如提交表单的POST请求），其中还包含请求体的摘要。
+func archiveKey(canonicalizer canon.Canonicalizer, req *base.Request) string {
+	key := req.Method() + " " + canonicalizer.Key(req.HttpReq().URL)
+	if digest := req.BodyDigest(); digest != "" {
+		key += " " + digest
+	}
+	return key
+}
+
+// 创建记录模式的下载器中间件。它会把每一对请求和响应都保存到参数archive代表的存档中。
+// 为了记录真实的网络流量，它应该被放在下载器中间件序列的末尾。
+// 下载失败的请求不会被记录。
+// 参数canonicalizer代表URL规范化器。若其为nil，则使用不去掉跟踪参数的默认规范化器。
+// 记录和回放时应使用相同的规范化器。
+func NewRecordMiddleware(archive Archive, canonicalizer canon.Canonicalizer) (DownloaderMiddleware, error) {
+	if archive == nil {
+		return nil, errors.New("The archive is nil!")
+	}
+	if canonicalizer == nil {
+		canonicalizer = canon.NewCanonicalizer(false)
+	}
+	return &recordMiddleware{archive: archive, canonicalizer: canonicalizer}, nil
+}
+
+// 记录模式的下载器中间件的实现类型。
+type recordMiddleware struct {
+	BaseDownloaderMiddleware
+	archive       Archive             // HTTP流量存档。
+	canonicalizer canon.Canonicalizer // URL规范化器。
+}
+
+func (mw *recordMiddleware) ProcessResponse(
+	ctx context.Context, req *base.Request, resp *base.Response) (*base.Response, error) {
+	httpReq := req.HttpReq()
+	httpResp := resp.HttpResp()
+	body, err := io.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	httpResp.Body = io.NopCloser(bytes.NewReader(body))
+	entry := &ArchiveEntry{
+		Method:        httpReq.Method,
+		Url:           httpReq.URL.String(),
+		RequestHeader: httpReq.Header.Clone(),
+		RequestBody:   req.Body(),
+		StatusCode:    httpResp.StatusCode,
+		Header:        httpResp.Header.Clone(),
+		Body:          body,
+		Truncated:     resp.Truncated(),
+		RecordedAt:    time.Now(),
+	}
+	if httpResp.Request != nil && httpResp.Request.URL.String() != entry.Url {
+		entry.FinalUrl = httpResp.Request.URL.String()
+	}
+	if err := mw.archive.Save(archiveKey(mw.canonicalizer, req), entry); err != nil {
+		logger.Warnf("Couldn't record the response: %s (url=%s)\n", err, httpReq.URL)
+	}
+	return resp, nil
+}
+
+// 创建回放模式的下载器中间件。它会完全依据参数archive代表的存档给出响应，而不会访问网络。
+// 存档中不存在的请求会得到包装了ErrNotArchived的错误值。
+// 为了使其之前的中间件照常工作，它应该被放在下载器中间件序列的末尾。
+// 参数canonicalizer代表URL规范化器。若其为nil，则使用不去掉跟踪参数的默认规范化器。
+func NewReplayMiddleware(archive Archive, canonicalizer canon.Canonicalizer) (DownloaderMiddleware, error) {
+	if archive == nil {
+		return nil, errors.New("The archive is nil!")
+	}
+	if canonicalizer == nil {
+		canonicalizer = canon.NewCanonicalizer(false)
+	}
+	return &replayMiddleware{archive: archive, canonicalizer: canonicalizer}, nil
+}
+
+// 回放模式的下载器中间件的实现类型。
+type replayMiddleware struct {
+	BaseDownloaderMiddleware
+	archive       Archive             // HTTP流量存档。
+	canonicalizer canon.Canonicalizer // URL规范化器。
+}
+
+func (mw *replayMiddleware) ProcessRequest(
+	ctx context.Context, req *base.Request) (*base.Response, error) {
+	httpReq := req.HttpReq()
+	key := archiveKey(mw.canonicalizer, req)
+	entry, err := mw.archive.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w (key=%s)", ErrNotArchived, key)
+	}
+	respReq := httpReq
+	if entry.FinalUrl != "" {
+		finalUrl, err := url.Parse(entry.FinalUrl)
+		if err != nil {
+			return nil, fmt.Errorf("Broken archive entry: %s (key=%s)", err, key)
+		}
+		respReq = httpReq.Clone(ctx)
+		respReq.URL = finalUrl
+		respReq.Host = finalUrl.Host
+	}
+	httpResp := newStoredHttpResp(respReq, entry.StatusCode, entry.Header.Clone(), entry.Body)
+	resp := base.NewResponse(httpResp, req.Depth())
+	if entry.Truncated {
+		resp.MarkTruncated()
+	}
+	return resp, nil
+}
@@ -0,0 +1,173 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	base "webcrawler/base"
+)
+
+// 禁止访问网络的HTTP传输器。回放模式下它不应被调用。
+type forbiddenTransport struct {
+	t     *testing.T
+	calls int32
+}
+
+func (ft *forbiddenTransport) RoundTrip(httpReq *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&ft.calls, 1)
+	ft.t.Errorf("Unexpected network access in replay mode: %s %s", httpReq.Method, httpReq.URL)
+	return nil, errors.New("network access is forbidden")
+}
+
+// 被记录和回放的下载结果。
+type replayResult struct {
+	statusCode int
+	header     string
+	body       string
+	finalPath  string
+}
+
+func download(t *testing.T, downloader PageDownloader, req *base.Request) (replayResult, error) {
+	resp, err := downloader.Download(context.Background(), *req)
+	if err != nil {
+		return replayResult{}, err
+	}
+	httpResp := resp.HttpResp()
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		t.Fatalf("Read error: %s", err)
+	}
+	return replayResult{
+		statusCode: httpResp.StatusCode,
+		header:     httpResp.Header.Get("X-Page"),
+		body:       string(body),
+		finalPath:  httpResp.Request.URL.Path,
+	}, nil
+}
+
+func newGetRequest(t *testing.T, rawUrl string) *base.Request {
+	httpReq, err := http.NewRequest("GET", rawUrl, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error: %s", err)
+	}
+	return base.NewRequest(httpReq, 0)
+}
+
+func newPostRequest(t *testing.T, rawUrl string, body string) *base.Request {
+	req, err := base.NewRequestWithBody(
+		"POST", rawUrl, []byte(body), "application/x-www-form-urlencoded", 0)
+	if err != nil {
+		t.Fatalf("NewRequestWithBody() error: %s", err)
+	}
+	return req
+}
+
+func TestRecordReplayRoundTrip(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("X-Page", "page")
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, "<html><a href=\"/next\">next</a></html>")
+		case "/old":
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+		case "/search":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("X-Page", "search")
+			io.WriteString(w, r.Method+" "+string(body))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	dir := filepath.Join(t.TempDir(), "archive")
+	archive, err := NewDirArchive(dir)
+	if err != nil {
+		t.Fatalf("NewDirArchive() error: %s", err)
+	}
+
+	// 记录。
+	record, err := NewRecordMiddleware(archive, nil)
+	if err != nil {
+		t.Fatalf("NewRecordMiddleware() error: %s", err)
+	}
+	recorder := NewPageDownloader(nil, record)
+	requests := []struct {
+		name string
+		req  *base.Request
+	}{
+		{"page", newGetRequest(t, server.URL+"/page")},
+		{"redirect", newGetRequest(t, server.URL+"/old")},
+		{"not found", newGetRequest(t, server.URL+"/missing")},
+		{"post", newPostRequest(t, server.URL+"/search", "q=golang")},
+	}
+	recorded := make(map[string]replayResult)
+	for _, r := range requests {
+		result, err := download(t, recorder, r.req)
+		if err != nil {
+			t.Fatalf("%s: record error: %s", r.name, err)
+		}
+		recorded[r.name] = result
+	}
+	if recorded["redirect"].finalPath != "/page" || recorded["post"].body != "POST q=golang" {
+		t.Fatalf("Unexpected recorded results: %+v", recorded)
+	}
+	recordedHits := atomic.LoadInt32(&hits)
+
+	// 回放。它使用的存档是重新打开的，且HTTP客户端无法访问网络。
+	reopened, err := NewDirArchive(dir)
+	if err != nil {
+		t.Fatalf("NewDirArchive() error: %s", err)
+	}
+	replay, err := NewReplayMiddleware(reopened, nil)
+	if err != nil {
+		t.Fatalf("NewReplayMiddleware() error: %s", err)
+	}
+	transport := &forbiddenTransport{t: t}
+	replayer := NewPageDownloader(&http.Client{Transport: transport}, replay)
+	for _, r := range requests {
+		result, err := download(t, replayer, r.req)
+		if err != nil {
+			t.Errorf("%s: replay error: %s", r.name, err)
+			continue
+		}
+		if result != recorded[r.name] {
+			t.Errorf("%s: replayed %+v, recorded %+v", r.name, result, recorded[r.name])
+		}
+	}
+
+	// 未被存档的请求总会得到相同的ErrNotArchived错误。
+	missing := []struct {
+		name string
+		req  *base.Request
+	}{
+		{"unknown url", newGetRequest(t, server.URL+"/never")},
+		{"other method", newPostRequest(t, server.URL+"/page", "")},
+		{"other body", newPostRequest(t, server.URL+"/search", "q=rust")},
+	}
+	for _, m := range missing {
+		_, err1 := download(t, replayer, m.req)
+		_, err2 := download(t, replayer, m.req)
+		if !errors.Is(err1, ErrNotArchived) {
+			t.Errorf("%s: got error %v, want ErrNotArchived", m.name, err1)
+			continue
+		}
+		if err2 == nil || err1.Error() != err2.Error() {
+			t.Errorf("%s: errors are not deterministic: %v vs %v", m.name, err1, err2)
+		}
+	}
+	if calls := atomic.LoadInt32(&transport.calls); calls != 0 {
+		t.Errorf("The replay made %d network calls", calls)
+	}
+	if got := atomic.LoadInt32(&hits); got != recordedHits {
+		t.Errorf("The server got %d requests during the replay", got-recordedHits)
+	}
+}
@@ -0,0 +1,148 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 默认的需要重试的HTTP响应状态码的列表。
+var DefaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// 重试策略的接口类型。
+// 调度器会在每次下载之后询问重试策略。需要重试的请求会在等待一段时间之后被重新放入请求缓存，
+// 而不会占用网页下载器池中的下载器。
+type RetryPolicy interface {
+	// 获得默认的最大下载尝试次数（包括首次尝试）。请求自身的设置优先于它。
+	MaxAttempts() uint32
+	// 判断一次下载的结果是否需要重试。参数httpResp和err中至少有一个不为nil。
+	ShouldRetry(httpResp *http.Response, err error) bool
+	// 获得第attempt次下载尝试失败之后的等待时间。参数httpResp可能为nil。
+	Backoff(attempt uint32, httpResp *http.Response) time.Duration
+}
+
+// 创建基于指数退避的重试策略。
+// 参数maxAttempts代表默认的最大下载尝试次数（包括首次尝试）。
+// 参数baseDelay代表首次重试之前的等待时间。之后的每次重试的等待时间都会翻倍，但不会超过参数maxDelay。
+// 实际的等待时间会在上述时间的一半到全部之间随机选取，以免大量请求同时被重试。
+// 若响应中含有Retry-After报头，则等待时间至少为其指定的时间，但同样不会超过参数maxDelay。
+// 参数statusCodes代表需要重试的HTTP响应状态码的列表。若其为空，则使用DefaultRetryStatusCodes。
+// 除此之外，网络错误和超时也会被重试，但因调度器关闭而被取消的下载不会被重试。
+func NewExponentialBackoffPolicy(
+	maxAttempts uint32,
+	baseDelay time.Duration,
+	maxDelay time.Duration,
+	statusCodes ...int) (RetryPolicy, error) {
+	if maxAttempts == 0 {
+		return nil, errors.New("The max attempts can not be 0!")
+	}
+	if baseDelay <= 0 || maxDelay < baseDelay {
+		errMsg := fmt.Sprintf("Invalid backoff delays! (baseDelay=%s, maxDelay=%s)",
+			baseDelay, maxDelay)
+		return nil, errors.New(errMsg)
+	}
+	if len(statusCodes) == 0 {
+		statusCodes = DefaultRetryStatusCodes
+	}
+	statusCodeMap := make(map[int]bool)
+	for _, code := range statusCodes {
+		statusCodeMap[code] = true
+	}
+	return &exponentialBackoffPolicy{
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		statusCodes: statusCodeMap,
+	}, nil
+}
+
+// 基于指数退避的重试策略的实现类型。
+type exponentialBackoffPolicy struct {
+	maxAttempts uint32        // 默认的最大下载尝试次数。
+	baseDelay   time.Duration // 首次重试之前的等待时间。
+	maxDelay    time.Duration // 最长的等待时间。
+	statusCodes map[int]bool  // 需要重试的HTTP响应状态码的字典。
+}
+
+func (policy *exponentialBackoffPolicy) MaxAttempts() uint32 {
+	return policy.maxAttempts
+}
+
+func (policy *exponentialBackoffPolicy) ShouldRetry(httpResp *http.Response, err error) bool {
+	if err != nil {
+		return retryableError(err)
+	}
+	return httpResp != nil && policy.statusCodes[httpResp.StatusCode]
+}
+
+func (policy *exponentialBackoffPolicy) Backoff(attempt uint32, httpResp *http.Response) time.Duration {
+	delay := policy.maxDelay
+	if attempt < 32 {
+		if d := policy.baseDelay << (attempt - 1); d > 0 && d < policy.maxDelay {
+			delay = d
+		}
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	if httpResp != nil {
+		retryAfter, ok := ParseRetryAfter(httpResp.Header.Get("Retry-After"), time.Now())
+		if ok && retryAfter > delay {
+			delay = retryAfter
+			// 过长的Retry-After（如数小时甚至数天）会使请求长期滞留，所以它同样受最长等待时间的限制。
+			if delay > policy.maxDelay {
+				delay = policy.maxDelay
+			}
+		}
+	}
+	return delay
+}
+
+// 判断错误是否可以通过重试来解决。
+// 网络错误（包括超时）和意外的连接中断是可以重试的，
+// 而被取消的下载、不存在的域名以及无效的请求等则不是。
+func retryableError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// 解析Retry-After报头的值。其值可以是秒数或HTTP日期。
+// 参数now代表当前时间。若无法解析，则结果值ok为false。
+func ParseRetryAfter(value string, now time.Time) (delay time.Duration, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if delay = t.Sub(now); delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
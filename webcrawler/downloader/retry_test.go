@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value  string
+		delay  time.Duration
+		wantOk bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 31 Dec 2023 23:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"1.5", 0, false},
+		{"soon", 0, false},
+	}
+	for _, c := range cases {
+		delay, ok := ParseRetryAfter(c.value, now)
+		if delay != c.delay || ok != c.wantOk {
+			t.Errorf("ParseRetryAfter(%q) = %s, %v, want %s, %v", c.value, delay, ok, c.delay, c.wantOk)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	if _, err := NewExponentialBackoffPolicy(0, time.Second, time.Minute); err == nil {
+		t.Error("0 max attempts should be rejected")
+	}
+	if _, err := NewExponentialBackoffPolicy(3, time.Minute, time.Second); err == nil {
+		t.Error("A max delay less than the base delay should be rejected")
+	}
+	policy, err := NewExponentialBackoffPolicy(5, time.Second, 10*time.Second)
+	if err != nil {
+		t.Fatalf("NewExponentialBackoffPolicy() error: %s", err)
+	}
+	cases := []struct {
+		attempt uint32
+		min     time.Duration
+		max     time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{4, 4 * time.Second, 8 * time.Second},
+		{5, 5 * time.Second, 10 * time.Second},
+		{100, 5 * time.Second, 10 * time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 20; i++ {
+			if delay := policy.Backoff(c.attempt, nil); delay < c.min || delay > c.max {
+				t.Errorf("Backoff(%d) = %s, want in [%s, %s]", c.attempt, delay, c.min, c.max)
+			}
+		}
+	}
+	// Retry-After可以延长等待时间，但不会使其超过最长等待时间。
+	retryAfterCases := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"7", 7 * time.Second, 7 * time.Second},
+		{"86400", 10 * time.Second, 10 * time.Second},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 10 * time.Second, 10 * time.Second},
+		{"0", 500 * time.Millisecond, time.Second},
+	}
+	for _, c := range retryAfterCases {
+		httpResp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		httpResp.Header.Set("Retry-After", c.value)
+		if delay := policy.Backoff(1, httpResp); delay < c.min || delay > c.max {
+			t.Errorf("Backoff() with Retry-After %q = %s, want in [%s, %s]", c.value, delay, c.min, c.max)
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	policy, _ := NewExponentialBackoffPolicy(3, time.Second, time.Minute, http.StatusServiceUnavailable)
+	cases := []struct {
+		name string
+		code int
+		err  error
+		want bool
+	}{
+		{"listed status code", http.StatusServiceUnavailable, nil, true},
+		{"unlisted status code", http.StatusInternalServerError, nil, false},
+		{"ok", http.StatusOK, nil, false},
+		{"canceled", 0, fmt.Errorf("download: %w", context.Canceled), false},
+		{"deadline exceeded", 0, context.DeadlineExceeded, true},
+		{"connection refused", 0, &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"unknown host", 0, &net.DNSError{Err: "no such host", Name: "x.invalid", IsNotFound: true}, false},
+		{"temporary dns error", 0, &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}, true},
+		{"unexpected eof", 0, io.ErrUnexpectedEOF, true},
+		{"invalid request", 0, errors.New("unsupported protocol scheme"), false},
+	}
+	for _, c := range cases {
+		var httpResp *http.Response
+		if c.code != 0 {
+			httpResp = &http.Response{StatusCode: c.code}
+		}
+		if got := policy.ShouldRetry(httpResp, c.err); got != c.want {
+			t.Errorf("%s: ShouldRetry() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
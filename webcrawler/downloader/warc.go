@@ -0,0 +1,399 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	base "webcrawler/base"
+)
+
+// WARC记录的类型。
+const (
+	WARC_TYPE_WARCINFO = "warcinfo"
+	WARC_TYPE_REQUEST  = "request"
+	WARC_TYPE_RESPONSE = "response"
+	WARC_TYPE_METADATA = "metadata"
+)
+
+// 默认的WARC文件的最大尺寸。
+const DefaultWarcMaxFileSize = 1 << 30
+
+// 表示WARC写入器已被关闭的错误。
+var ErrWarcWriterClosed = errors.New("The WARC writer has been closed!")
+
+// WARC记录。
+type WarcRecord struct {
+	Type        string            // 记录类型（WARC-Type）。
+	Id          string            // 记录ID（WARC-Record-ID）。为空时会在写入时生成。
+	TargetUri   string            // 目标URI（WARC-Target-URI）。可以为空。
+	Date        time.Time         // 日期（WARC-Date）。为零值时会使用写入时的时间。
+	ContentType string            // 内容类型（Content-Type）。
+	Fields      map[string]string // 其他的WARC报头字段。
+	Block       []byte            // 记录块。
+}
+
+// WARC写入器的接口类型。其实现必须是并发安全的。
+type WarcWriter interface {
+	// 写入记录。同一次调用中的各条记录总会被连续地写入同一个文件。
+	WriteRecords(records ...*WarcRecord) error
+	// 获得已创建的WARC文件的路径的列表。
+	Files() []string
+	// 关闭写入器。
+	Close() error
+}
+
+// 创建WARC/1.1格式的写入器。
+// 文件会被创建在参数dir代表的目录中，其名称为“前缀-创建时间-序号.warc”（压缩时以“.gz”结尾）。
+// 参数prefix代表文件名的前缀。参数maxFileSize代表文件的最大尺寸。当文件的尺寸达到它时，
+// 后续的记录会被写入新的文件。若其为0，则不会切换文件。
+// 参数compress表示是否对每条记录单独进行gzip压缩。
+// 每个文件都以一条warcinfo记录开头。
+func NewWarcWriter(dir string, prefix string, maxFileSize int64, compress bool) (WarcWriter, error) {
+	if dir == "" {
+		return nil, errors.New("Empty WARC directory!")
+	}
+	if prefix == "" {
+		return nil, errors.New("Empty WARC file prefix!")
+	}
+	if maxFileSize < 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid WARC max file size %d!", maxFileSize))
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &myWarcWriter{
+		dir:         dir,
+		prefix:      prefix,
+		maxFileSize: maxFileSize,
+		compress:    compress,
+	}, nil
+}
+
+// WARC写入器的实现类型。
+type myWarcWriter struct {
+	dir         string        // 目录。
+	prefix      string        // 文件名的前缀。
+	maxFileSize int64         // 文件的最大尺寸。
+	compress    bool          // 是否压缩每条记录。
+	file        *os.File      // 当前的文件。
+	buf         *bufio.Writer // 当前文件的缓冲写入器。
+	size        int64         // 当前文件的尺寸。
+	files       []string      // 已创建的文件的路径的列表。
+	closed      bool          // 是否已关闭。
+	mutex       sync.Mutex    // 互斥锁。
+}
+
+func (writer *myWarcWriter) WriteRecords(records ...*WarcRecord) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if writer.closed {
+		return ErrWarcWriterClosed
+	}
+	if writer.file == nil || (writer.maxFileSize > 0 && writer.size >= writer.maxFileSize) {
+		if err := writer.rotate(); err != nil {
+			return err
+		}
+	}
+	for _, record := range records {
+		if err := writer.write(record); err != nil {
+			return err
+		}
+	}
+	return writer.buf.Flush()
+}
+
+func (writer *myWarcWriter) Files() []string {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return append([]string(nil), writer.files...)
+}
+
+func (writer *myWarcWriter) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if writer.closed {
+		return nil
+	}
+	writer.closed = true
+	return writer.closeFile()
+}
+
+// 关闭当前的文件。
+func (writer *myWarcWriter) closeFile() error {
+	if writer.file == nil {
+		return nil
+	}
+	err := writer.buf.Flush()
+	if closeErr := writer.file.Close(); err == nil {
+		err = closeErr
+	}
+	writer.file = nil
+	writer.buf = nil
+	return err
+}
+
+// 切换到新的文件，并写入warcinfo记录。
+func (writer *myWarcWriter) rotate() error {
+	if err := writer.closeFile(); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s-%05d.warc",
+		writer.prefix, time.Now().UTC().Format("20060102150405"), len(writer.files))
+	if writer.compress {
+		name += ".gz"
+	}
+	path := filepath.Join(writer.dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	writer.file = file
+	writer.buf = bufio.NewWriter(file)
+	writer.size = 0
+	writer.files = append(writer.files, path)
+	return writer.write(&WarcRecord{
+		Type:        WARC_TYPE_WARCINFO,
+		ContentType: "application/warc-fields",
+		Fields:      map[string]string{"WARC-Filename": name},
+		Block: formatWarcFields(map[string]string{
+			"software": "webcrawler",
+			"format":   "WARC File Format 1.1",
+		}),
+	})
+}
+
+// 写入一条记录。
+func (writer *myWarcWriter) write(record *WarcRecord) error {
+	if record.Id == "" {
+		record.Id = NewWarcRecordId()
+	}
+	if record.Date.IsZero() {
+		record.Date = time.Now()
+	}
+	var header bytes.Buffer
+	header.WriteString("WARC/1.1\r\n")
+	fmt.Fprintf(&header, "WARC-Type: %s\r\n", record.Type)
+	fmt.Fprintf(&header, "WARC-Record-ID: %s\r\n", record.Id)
+	fmt.Fprintf(&header, "WARC-Date: %s\r\n", record.Date.UTC().Format(time.RFC3339Nano))
+	if record.TargetUri != "" {
+		fmt.Fprintf(&header, "WARC-Target-URI: %s\r\n", record.TargetUri)
+	}
+	if record.ContentType != "" {
+		fmt.Fprintf(&header, "Content-Type: %s\r\n", record.ContentType)
+	}
+	header.Write(formatWarcFields(record.Fields))
+	fmt.Fprintf(&header, "Content-Length: %d\r\n\r\n", len(record.Block))
+	counter := &countingWriter{writer: writer.buf}
+	var w io.Writer = counter
+	var gzipWriter *gzip.Writer
+	if writer.compress {
+		gzipWriter = gzip.NewWriter(counter)
+		w = gzipWriter
+	}
+	for _, part := range [][]byte{header.Bytes(), record.Block, []byte("\r\n\r\n")} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	if gzipWriter != nil {
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+	}
+	writer.size += counter.count
+	return nil
+}
+
+// 能够统计写入的字节数的写入器。
+type countingWriter struct {
+	writer io.Writer // 底层的写入器。
+	count  int64     // 已写入的字节数。
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.writer.Write(p)
+	cw.count += int64(n)
+	return n, err
+}
+
+// 生成新的WARC记录ID。其形式为“<urn:uuid:...>”。
+func NewWarcRecordId() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		panic(err)
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>",
+		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+// 计算WARC摘要。其形式为“sha1:”加上Base32编码的SHA-1摘要。
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// 按照application/warc-fields格式生成字段。字段会按照名称排序。
+func formatWarcFields(fields map[string]string) []byte {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, fields[name])
+	}
+	return buf.Bytes()
+}
+
+// 创建把下载得到的网页写入WARC文件的下载器中间件。
+// 每次下载都会产生一条请求记录、一条响应记录和一条元数据记录。
+// 为了记录真实的网络流量，它应该被放在下载器中间件序列的末尾，
+// 这样来源于缓存或存档的响应就不会被写入。
+// 响应体会被完整地读出并写入WARC文件，之后仍可以被分析器读取。
+// 注意，记录中的报头是Go的HTTP客户端处理之后的报头。
+// 例如，被透明解压的响应不再含有Content-Encoding报头。
+func NewWarcMiddleware(writer WarcWriter) DownloaderMiddleware {
+	return &warcMiddleware{writer: writer}
+}
+
+// 把网页写入WARC文件的下载器中间件的实现类型。
+type warcMiddleware struct {
+	BaseDownloaderMiddleware
+	writer WarcWriter // WARC写入器。
+}
+
+func (mw *warcMiddleware) ProcessResponse(
+	ctx context.Context, req *base.Request, resp *base.Response) (*base.Response, error) {
+	httpResp := resp.HttpResp()
+	body, err := io.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	httpResp.Body = io.NopCloser(bytes.NewReader(body))
+	// 发生重定向时，记录最后一次被发送的请求。
+	httpReq := req.HttpReq()
+	if httpResp.Request != nil {
+		httpReq = httpResp.Request
+	}
+	targetUri := httpReq.URL.String()
+	now := time.Now()
+	reqBlock, err := httpRequestBlock(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	respBlock := httpResponseBlock(httpResp, body)
+	respId := NewWarcRecordId()
+	respFields := map[string]string{
+		"WARC-Block-Digest":   warcDigest(respBlock),
+		"WARC-Payload-Digest": warcDigest(body),
+	}
+	if resp.Truncated() {
+		respFields["WARC-Truncated"] = "length"
+	}
+	metadata := map[string]string{
+		"depth": strconv.FormatUint(uint64(req.Depth()), 10),
+	}
+	if originalUrl := req.HttpReq().URL.String(); originalUrl != targetUri {
+		metadata["via"] = originalUrl
+	}
+	err = mw.writer.WriteRecords(
+		&WarcRecord{
+			Type:        WARC_TYPE_REQUEST,
+			TargetUri:   targetUri,
+			Date:        now,
+			ContentType: "application/http;msgtype=request",
+			Fields:      map[string]string{"WARC-Concurrent-To": respId},
+			Block:       reqBlock,
+		},
+		&WarcRecord{
+			Type:        WARC_TYPE_RESPONSE,
+			Id:          respId,
+			TargetUri:   targetUri,
+			Date:        now,
+			ContentType: "application/http;msgtype=response",
+			Fields:      respFields,
+			Block:       respBlock,
+		},
+		&WarcRecord{
+			Type:        WARC_TYPE_METADATA,
+			TargetUri:   targetUri,
+			Date:        now,
+			ContentType: "application/warc-fields",
+			Fields:      map[string]string{"WARC-Refers-To": respId},
+			Block:       formatWarcFields(metadata),
+		})
+	if err != nil {
+		logger.Warnf("Couldn't write the WARC records: %s (url=%s)\n", err, targetUri)
+	}
+	return resp, nil
+}
+
+// 生成HTTP请求的记录块。
+func httpRequestBlock(httpReq *http.Request) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", requestMethod(httpReq), httpReq.URL.RequestURI())
+	host := httpReq.Host
+	if host == "" {
+		host = httpReq.URL.Host
+	}
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	if err := httpReq.Header.WriteSubset(&buf, map[string]bool{"Host": true}); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+	if httpReq.GetBody != nil {
+		body, err := httpReq.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		if _, err := io.Copy(&buf, body); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// 生成HTTP响应的记录块。
+func httpResponseBlock(httpResp *http.Response, body []byte) []byte {
+	var buf bytes.Buffer
+	status := httpResp.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", httpResp.StatusCode, http.StatusText(httpResp.StatusCode))
+	}
+	major, minor := httpResp.ProtoMajor, httpResp.ProtoMinor
+	if major == 0 {
+		major, minor = 1, 1
+	}
+	fmt.Fprintf(&buf, "HTTP/%d.%d %s\r\n", major, minor, status)
+	httpResp.Header.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// 获得请求方法。空的请求方法代表GET。
+func requestMethod(httpReq *http.Request) string {
+	if httpReq.Method == "" {
+		return http.MethodGet
+	}
+	return httpReq.Method
+}
@@ -1,6 +1,7 @@
 package itemproc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync/atomic"
@@ -9,8 +10,8 @@ import (
 
 // 条目处理管道的接口类型。
 type ItemPipeline interface {
-	// 发送条目。
-	Send(item base.Item) []error
+	// 发送条目。参数ctx会被传给各个条目处理器。它被取消时，剩余的处理步骤会被忽略。
+	Send(ctx context.Context, item base.Item) []error
 	// FailFast方法会返回一个布尔值。该值表示当前的条目处理管道是否是快速失败的。
 	// 这里的快速失败是指：只要对某个条目的处理流程在某一个步骤上出错，
 	// 那么条目处理管道就会忽略掉后续的所有处理步骤并报告错误。
@@ -51,7 +52,7 @@ type myItemPipeline struct {
 	processingNumber uint64        // 正在被处理的条目的数量。
 }
 
-func (ip *myItemPipeline) Send(item base.Item) []error {
+func (ip *myItemPipeline) Send(ctx context.Context, item base.Item) []error {
 	atomic.AddUint64(&ip.processingNumber, 1)
 	defer atomic.AddUint64(&ip.processingNumber, ^uint64(0))
 	atomic.AddUint64(&ip.sent, 1)
@@ -63,7 +64,11 @@ func (ip *myItemPipeline) Send(item base.Item) []error {
 	atomic.AddUint64(&ip.accepted, 1)
 	var currentItem base.Item = item
 	for _, itemProcessor := range ip.itemProcessors {
-		processedItem, err := itemProcessor(currentItem)
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		processedItem, err := itemProcessor(ctx, currentItem)
 		if err != nil {
 			errs = append(errs, err)
 			if ip.failFast {
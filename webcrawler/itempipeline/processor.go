@@ -1,8 +1,10 @@
 package itemproc
 
 import (
+	"context"
 	base "webcrawler/base"
 )
 
 // 被用来处理条目的函数类型。
-type ProcessItem func(item base.Item) (result base.Item, err error)
+// 参数ctx被取消时，耗时的处理应尽快返回。
+type ProcessItem func(ctx context.Context, item base.Item) (result base.Item, err error)
@@ -51,6 +51,8 @@ func (ss *myStopSign) Sign() bool {
 }
 
 func (ss *myStopSign) Signed() bool {
+	ss.rwmutex.RLock()
+	defer ss.rwmutex.RUnlock()
 	return ss.signed
 }
 
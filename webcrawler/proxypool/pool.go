@@ -0,0 +1,352 @@
+package proxypool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	base "webcrawler/base"
+)
+
+// 日志记录器。
+var logger *logrus.Logger = base.NewLogger()
+
+// 表示没有可用的代理的错误。
+var ErrNoProxyAvailable = errors.New("No proxy is available!")
+
+// 代理的选择策略的类型。
+type SelectStrategy uint8
+
+const (
+	SELECT_ROUND_ROBIN     SelectStrategy = 0 // 轮流选择。
+	SELECT_STICKY_PER_HOST SelectStrategy = 1 // 同一主机的请求总是使用同一个代理，直到该代理被剔除。
+	SELECT_LEAST_FAILURES  SelectStrategy = 2 // 选择失败次数最少的代理。
+)
+
+// 选择策略与名称的映射。
+var strategyNameMap = map[SelectStrategy]string{
+	SELECT_ROUND_ROBIN:     "round-robin",
+	SELECT_STICKY_PER_HOST: "sticky-per-host",
+	SELECT_LEAST_FAILURES:  "least-failures",
+}
+
+func (strategy SelectStrategy) String() string {
+	if name, ok := strategyNameMap[strategy]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(strategy))
+}
+
+// 代理健康检查函数的类型。返回nil表示代理可用。
+type HealthChecker func(ctx context.Context, proxyUrl *url.URL) error
+
+// 创建基于HTTP请求的健康检查函数。
+// 它会通过代理向参数targetUrl代表的URL发送GET请求，只要得到了响应（无论状态码如何，407除外）就认为代理可用。
+// 参数timeout代表单次检查的超时时间。
+func NewHttpHealthChecker(targetUrl string, timeout time.Duration) HealthChecker {
+	return func(ctx context.Context, proxyUrl *url.URL) error {
+		client := &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyURL(proxyUrl)},
+			Timeout:   timeout,
+		}
+		defer client.CloseIdleConnections()
+		httpReq, err := http.NewRequestWithContext(ctx, "GET", targetUrl, nil)
+		if err != nil {
+			return err
+		}
+		httpResp, err := client.Do(httpReq)
+		if err != nil {
+			return err
+		}
+		httpResp.Body.Close()
+		if httpResp.StatusCode == http.StatusProxyAuthRequired {
+			return errors.New("Proxy authentication required")
+		}
+		return nil
+	}
+}
+
+// 代理池的接口类型。其实现必须是并发安全的。
+type ProxyPool interface {
+	// 为请求选择代理。若没有可用的代理，则返回ErrNoProxyAvailable。
+	Select(httpReq *http.Request) (*url.URL, error)
+	// 报告一次经由代理的请求的结果。参数err为nil表示成功。
+	// 连续失败达到一定次数的代理会被剔除，直到其通过健康检查为止。
+	Report(proxyUrl *url.URL, latency time.Duration, err error)
+	// 获得各代理的统计信息。
+	Stats() []ProxyStats
+	// 获取摘要信息。
+	Summary() string
+	// 关闭代理池，即停止定期的健康检查。
+	Close()
+}
+
+// 代理的统计信息。
+type ProxyStats struct {
+	Url                 string        // 代理的URL。
+	Available           bool          // 是否可用（未被剔除）。
+	Successes           uint64        // 成功的次数。
+	Failures            uint64        // 失败的次数。
+	ConsecutiveFailures uint32        // 连续失败的次数。
+	AvgLatency          time.Duration // 成功的请求的平均耗时。
+	LastError           string        // 最近一次失败的原因。
+}
+
+// 创建代理池。
+// 参数proxies代表代理的URL的列表，协议可以是http、https或socks5（如“socks5://127.0.0.1:1080”）。
+// 参数strategy代表选择策略。
+// 参数maxFailures代表剔除代理所需的连续失败次数。为0则表示从不剔除。
+// 参数recheckInterval代表对被剔除的代理进行健康检查的间隔时间。为0则表示不检查，被剔除的代理不再被使用。
+// 参数checker代表健康检查函数。若其为nil，则被剔除的代理不会被恢复。
+func NewProxyPool(
+	proxies []string,
+	strategy SelectStrategy,
+	maxFailures uint32,
+	recheckInterval time.Duration,
+	checker HealthChecker) (ProxyPool, error) {
+	if len(proxies) == 0 {
+		return nil, errors.New("The proxy list is empty!")
+	}
+	if _, ok := strategyNameMap[strategy]; !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown proxy select strategy %d!", strategy))
+	}
+	if recheckInterval < 0 {
+		return nil, errors.New("The recheck interval can not be negative!")
+	}
+	entries := make([]*proxyEntry, 0, len(proxies))
+	seen := make(map[string]bool)
+	for _, proxy := range proxies {
+		proxyUrl, err := url.Parse(strings.TrimSpace(proxy))
+		if err != nil {
+			return nil, err
+		}
+		switch proxyUrl.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			errMsg := fmt.Sprintf("Unsupported proxy scheme %q! (proxy=%s)", proxyUrl.Scheme, proxy)
+			return nil, errors.New(errMsg)
+		}
+		if proxyUrl.Host == "" {
+			return nil, errors.New(fmt.Sprintf("Invalid proxy %q!", proxy))
+		}
+		if seen[proxyUrl.String()] {
+			continue
+		}
+		seen[proxyUrl.String()] = true
+		entries = append(entries, &proxyEntry{url: proxyUrl, available: true})
+	}
+	pool := &myProxyPool{
+		entries:         entries,
+		strategy:        strategy,
+		maxFailures:     maxFailures,
+		recheckInterval: recheckInterval,
+		checker:         checker,
+		sticky:          make(map[string]*proxyEntry),
+		done:            make(chan struct{}),
+	}
+	if recheckInterval > 0 && checker != nil {
+		go pool.recheckLoop()
+	}
+	return pool, nil
+}
+
+// 代理条目。
+type proxyEntry struct {
+	url                 *url.URL      // 代理的URL。
+	available           bool          // 是否可用。
+	successes           uint64        // 成功的次数。
+	failures            uint64        // 失败的次数。
+	consecutiveFailures uint32        // 连续失败的次数。
+	totalLatency        time.Duration // 成功的请求的总耗时。
+	lastError           string        // 最近一次失败的原因。
+}
+
+// 代理池的实现类型。
+type myProxyPool struct {
+	entries         []*proxyEntry          // 代理条目的列表。
+	strategy        SelectStrategy         // 选择策略。
+	maxFailures     uint32                 // 剔除代理所需的连续失败次数。
+	recheckInterval time.Duration          // 健康检查的间隔时间。
+	checker         HealthChecker          // 健康检查函数。
+	next            int                    // 下一次轮流选择的起始位置。
+	sticky          map[string]*proxyEntry // 主机与代理的映射。
+	done            chan struct{}          // 关闭的通知通道。
+	closeOnce       sync.Once              // 保证只关闭一次。
+	mutex           sync.Mutex             // 互斥锁。
+}
+
+func (pool *myProxyPool) Select(httpReq *http.Request) (*url.URL, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	var entry *proxyEntry
+	switch pool.strategy {
+	case SELECT_STICKY_PER_HOST:
+		host := strings.ToLower(httpReq.URL.Host)
+		entry = pool.sticky[host]
+		if entry == nil || !entry.available {
+			entry = pool.roundRobin()
+			if entry != nil {
+				pool.sticky[host] = entry
+			}
+		}
+	case SELECT_LEAST_FAILURES:
+		// 从轮流选择的位置开始查找，以使失败次数相同的代理被轮流选择。
+		total := len(pool.entries)
+		for i := 0; i < total; i++ {
+			e := pool.entries[(pool.next+i)%total]
+			if e.available && (entry == nil || e.failures < entry.failures) {
+				entry = e
+			}
+		}
+		pool.next = (pool.next + 1) % total
+	default:
+		entry = pool.roundRobin()
+	}
+	if entry == nil {
+		return nil, ErrNoProxyAvailable
+	}
+	return entry.url, nil
+}
+
+// 轮流选择一个可用的代理。
+func (pool *myProxyPool) roundRobin() *proxyEntry {
+	total := len(pool.entries)
+	for i := 0; i < total; i++ {
+		entry := pool.entries[(pool.next+i)%total]
+		if entry.available {
+			pool.next = (pool.next + i + 1) % total
+			return entry
+		}
+	}
+	return nil
+}
+
+func (pool *myProxyPool) Report(proxyUrl *url.URL, latency time.Duration, err error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	entry := pool.find(proxyUrl)
+	if entry == nil {
+		return
+	}
+	if err == nil {
+		entry.successes++
+		entry.consecutiveFailures = 0
+		entry.totalLatency += latency
+		return
+	}
+	entry.failures++
+	entry.consecutiveFailures++
+	entry.lastError = err.Error()
+	if entry.available && pool.maxFailures > 0 && entry.consecutiveFailures >= pool.maxFailures {
+		entry.available = false
+		logger.Warnf("Evict the proxy after %d consecutive failures: %s (proxy=%s)\n",
+			entry.consecutiveFailures, err, entry.url)
+	}
+}
+
+// 查找代理条目。
+func (pool *myProxyPool) find(proxyUrl *url.URL) *proxyEntry {
+	if proxyUrl == nil {
+		return nil
+	}
+	for _, entry := range pool.entries {
+		if entry.url == proxyUrl || entry.url.String() == proxyUrl.String() {
+			return entry
+		}
+	}
+	return nil
+}
+
+// 定期对被剔除的代理进行健康检查，并恢复通过检查的代理。
+func (pool *myProxyPool) recheckLoop() {
+	ticker := time.NewTicker(pool.recheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pool.done:
+			return
+		case <-ticker.C:
+		}
+		pool.mutex.Lock()
+		evicted := make([]*proxyEntry, 0)
+		for _, entry := range pool.entries {
+			if !entry.available {
+				evicted = append(evicted, entry)
+			}
+		}
+		pool.mutex.Unlock()
+		for _, entry := range evicted {
+			ctx, cancel := context.WithTimeout(context.Background(), pool.recheckInterval)
+			go func() {
+				select {
+				case <-pool.done:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			err := pool.checker(ctx, entry.url)
+			cancel()
+			pool.mutex.Lock()
+			if err == nil {
+				entry.available = true
+				entry.consecutiveFailures = 0
+				logger.Infof("Restore the proxy. (proxy=%s)\n", entry.url)
+			} else {
+				entry.lastError = err.Error()
+			}
+			pool.mutex.Unlock()
+		}
+	}
+}
+
+func (pool *myProxyPool) Stats() []ProxyStats {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	stats := make([]ProxyStats, 0, len(pool.entries))
+	for _, entry := range pool.entries {
+		var avgLatency time.Duration
+		if entry.successes > 0 {
+			avgLatency = entry.totalLatency / time.Duration(entry.successes)
+		}
+		stats = append(stats, ProxyStats{
+			Url:                 entry.url.Redacted(),
+			Available:           entry.available,
+			Successes:           entry.successes,
+			Failures:            entry.failures,
+			ConsecutiveFailures: entry.consecutiveFailures,
+			AvgLatency:          avgLatency,
+			LastError:           entry.lastError,
+		})
+	}
+	return stats
+}
+
+var proxyPoolSummaryTemplate = "strategy: %s, available: %d/%d, proxies: [%s]"
+
+var proxyStatsSummaryTemplate = "%s{available: %v, successes: %d, failures: %d, avgLatency: %s}"
+
+func (pool *myProxyPool) Summary() string {
+	stats := pool.Stats()
+	available := 0
+	proxies := make([]string, 0, len(stats))
+	for _, s := range stats {
+		if s.Available {
+			available++
+		}
+		proxies = append(proxies, fmt.Sprintf(proxyStatsSummaryTemplate,
+			s.Url, s.Available, s.Successes, s.Failures, s.AvgLatency))
+	}
+	return fmt.Sprintf(proxyPoolSummaryTemplate,
+		pool.strategy, available, len(stats), strings.Join(proxies, ", "))
+}
+
+func (pool *myProxyPool) Close() {
+	pool.closeOnce.Do(func() {
+		close(pool.done)
+	})
+}
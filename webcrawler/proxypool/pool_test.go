@@ -0,0 +1,366 @@
+package proxypool
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 本地的桩代理。它会直接以自己的名称响应经由它发送的请求。
+type stubProxy struct {
+	name   string
+	server *httptest.Server
+	hits   int64 // 收到的请求的数量。
+	down   int32 // 为1时以407响应，即表现为不可用的代理。
+}
+
+func newStubProxy(t *testing.T, name string) *stubProxy {
+	proxy := &stubProxy{name: name}
+	proxy.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&proxy.hits, 1)
+		if atomic.LoadInt32(&proxy.down) == 1 {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		io.WriteString(w, proxy.name)
+	}))
+	t.Cleanup(proxy.server.Close)
+	return proxy
+}
+
+func (proxy *stubProxy) setDown(down bool) {
+	var value int32
+	if down {
+		value = 1
+	}
+	atomic.StoreInt32(&proxy.down, value)
+}
+
+// 获得一个已关闭的代理的URL，连接它总会失败。
+func deadProxyUrl() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+// 创建经由代理池发送请求的HTTP客户端。
+func newPoolClient(t *testing.T, pool ProxyPool) *http.Client {
+	transport, err := NewTransport(pool, nil)
+	if err != nil {
+		t.Fatalf("NewTransport() error: %s", err)
+	}
+	return &http.Client{Transport: transport}
+}
+
+// 经由代理池请求参数rawUrl代表的URL，并返回响应的代理的名称。
+func fetch(t *testing.T, client *http.Client, rawUrl string) (string, error) {
+	httpResp, err := client.Get(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		t.Fatalf("Read error: %s", err)
+	}
+	return string(body), nil
+}
+
+// 获得指定代理的统计信息。
+func statsOf(t *testing.T, pool ProxyPool, proxyUrl string) ProxyStats {
+	for _, stats := range pool.Stats() {
+		if stats.Url == proxyUrl {
+			return stats
+		}
+	}
+	t.Fatalf("No stats for the proxy %s", proxyUrl)
+	return ProxyStats{}
+}
+
+func TestNewProxyPoolInvalidArguments(t *testing.T) {
+	cases := []struct {
+		name            string
+		proxies         []string
+		strategy        SelectStrategy
+		recheckInterval time.Duration
+	}{
+		{"empty list", nil, SELECT_ROUND_ROBIN, 0},
+		{"unknown strategy", []string{"http://127.0.0.1:1"}, SelectStrategy(9), 0},
+		{"negative interval", []string{"http://127.0.0.1:1"}, SELECT_ROUND_ROBIN, -time.Second},
+		{"unsupported scheme", []string{"ftp://127.0.0.1:1"}, SELECT_ROUND_ROBIN, 0},
+		{"missing host", []string{"http://"}, SELECT_ROUND_ROBIN, 0},
+	}
+	for _, c := range cases {
+		if _, err := NewProxyPool(c.proxies, c.strategy, 0, c.recheckInterval, nil); err == nil {
+			t.Errorf("%s: NewProxyPool() should fail", c.name)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	proxies := []*stubProxy{newStubProxy(t, "p0"), newStubProxy(t, "p1"), newStubProxy(t, "p2")}
+	pool, err := NewProxyPool(
+		[]string{proxies[0].server.URL, proxies[1].server.URL, proxies[2].server.URL},
+		SELECT_ROUND_ROBIN, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("NewProxyPool() error: %s", err)
+	}
+	defer pool.Close()
+	client := newPoolClient(t, pool)
+	want := []string{"p0", "p1", "p2", "p0", "p1", "p2"}
+	for i, name := range want {
+		got, err := fetch(t, client, "http://example.test/page")
+		if err != nil {
+			t.Fatalf("Request %d error: %s", i, err)
+		}
+		if got != name {
+			t.Errorf("Request %d went through %s, want %s", i, got, name)
+		}
+	}
+	for _, proxy := range proxies {
+		stats := statsOf(t, pool, proxy.server.URL)
+		if stats.Successes != 2 || stats.Failures != 0 || !stats.Available {
+			t.Errorf("Unexpected stats for %s: %+v", proxy.name, stats)
+		}
+	}
+}
+
+func TestStickyPerHost(t *testing.T) {
+	proxies := []*stubProxy{newStubProxy(t, "p0"), newStubProxy(t, "p1"), newStubProxy(t, "p2")}
+	pool, err := NewProxyPool(
+		[]string{proxies[0].server.URL, proxies[1].server.URL, proxies[2].server.URL},
+		SELECT_STICKY_PER_HOST, 1, 0, nil)
+	if err != nil {
+		t.Fatalf("NewProxyPool() error: %s", err)
+	}
+	defer pool.Close()
+	client := newPoolClient(t, pool)
+	hosts := []string{"http://a.test/", "http://b.test/", "http://a.test/x", "http://b.test/y", "http://a.test/z"}
+	assigned := make(map[string]string)
+	for _, rawUrl := range hosts {
+		got, err := fetch(t, client, rawUrl)
+		if err != nil {
+			t.Fatalf("Request to %s error: %s", rawUrl, err)
+		}
+		host := mustParse(t, rawUrl).Host
+		if name, ok := assigned[host]; ok && name != got {
+			t.Errorf("Host %s moved from %s to %s", host, name, got)
+		}
+		assigned[host] = got
+	}
+	if assigned["a.test"] == assigned["b.test"] {
+		t.Errorf("Hosts a.test and b.test share the proxy %s", assigned["a.test"])
+	}
+	// 主机的代理被剔除之后，它会被固定到另一个代理上。
+	var stickyProxy *stubProxy
+	for _, proxy := range proxies {
+		if proxy.name == assigned["a.test"] {
+			stickyProxy = proxy
+		}
+	}
+	stickyProxy.setDown(true)
+	if _, err := fetch(t, client, "http://a.test/"); err != nil {
+		t.Fatalf("Request error: %s", err)
+	}
+	if statsOf(t, pool, stickyProxy.server.URL).Available {
+		t.Fatalf("The proxy %s should be evicted after a 407 response", stickyProxy.name)
+	}
+	moved, err := fetch(t, client, "http://a.test/")
+	if err != nil {
+		t.Fatalf("Request error: %s", err)
+	}
+	if moved == stickyProxy.name {
+		t.Errorf("Host a.test still uses the evicted proxy %s", moved)
+	}
+	again, err := fetch(t, client, "http://a.test/")
+	if err != nil {
+		t.Fatalf("Request error: %s", err)
+	}
+	if again != moved {
+		t.Errorf("Host a.test moved from %s to %s without an eviction", moved, again)
+	}
+}
+
+func TestLeastFailures(t *testing.T) {
+	urls := []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080"}
+	pool, err := NewProxyPool(urls, SELECT_LEAST_FAILURES, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("NewProxyPool() error: %s", err)
+	}
+	defer pool.Close()
+	httpReq, _ := http.NewRequest("GET", "http://example.test/", nil)
+	// 失败次数相同时，各代理被轮流选择。
+	counts := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		proxyUrl, err := pool.Select(httpReq)
+		if err != nil {
+			t.Fatalf("Select() error: %s", err)
+		}
+		counts[proxyUrl.String()]++
+	}
+	for _, u := range urls {
+		if counts[u] != 2 {
+			t.Errorf("Proxy %s was selected %d times, want 2 (counts=%v)", u, counts[u], counts)
+		}
+	}
+	// 失败次数最少的代理总是被优先选择，即使其它代理之后又成功了。
+	failure := errors.New("connection refused")
+	pool.Report(mustParse(t, urls[0]), 0, failure)
+	pool.Report(mustParse(t, urls[0]), 0, failure)
+	pool.Report(mustParse(t, urls[1]), 0, failure)
+	pool.Report(mustParse(t, urls[1]), 0, nil)
+	for i := 0; i < 4; i++ {
+		proxyUrl, err := pool.Select(httpReq)
+		if err != nil {
+			t.Fatalf("Select() error: %s", err)
+		}
+		if proxyUrl.String() != urls[2] {
+			t.Errorf("Selected %s, want %s", proxyUrl, urls[2])
+		}
+	}
+	pool.Report(mustParse(t, urls[2]), 0, failure)
+	pool.Report(mustParse(t, urls[2]), 0, failure)
+	proxyUrl, _ := pool.Select(httpReq)
+	if proxyUrl.String() != urls[1] {
+		t.Errorf("Selected %s, want %s", proxyUrl, urls[1])
+	}
+}
+
+func TestEvictionAfterConsecutiveFailures(t *testing.T) {
+	live := newStubProxy(t, "live")
+	dead := deadProxyUrl()
+	pool, err := NewProxyPool([]string{dead, live.server.URL}, SELECT_ROUND_ROBIN, 2, 0, nil)
+	if err != nil {
+		t.Fatalf("NewProxyPool() error: %s", err)
+	}
+	defer pool.Close()
+	client := newPoolClient(t, pool)
+	failures := 0
+	for i := 0; i < 8; i++ {
+		got, err := fetch(t, client, "http://example.test/")
+		if err != nil {
+			failures++
+			continue
+		}
+		if got != "live" {
+			t.Errorf("Request %d went through %s", i, got)
+		}
+	}
+	if failures != 2 {
+		t.Errorf("Got %d failed requests, want 2 before the eviction", failures)
+	}
+	deadStats := statsOf(t, pool, dead)
+	if deadStats.Available || deadStats.Failures != 2 || deadStats.ConsecutiveFailures != 2 ||
+		deadStats.LastError == "" {
+		t.Errorf("Unexpected stats for the dead proxy: %+v", deadStats)
+	}
+	if liveStats := statsOf(t, pool, live.server.URL); !liveStats.Available || liveStats.Successes != 6 {
+		t.Errorf("Unexpected stats for the live proxy: %+v", liveStats)
+	}
+	// 成功的请求会清零连续失败的次数，因此不连续的失败不会导致剔除。
+	failure := errors.New("timeout")
+	liveUrl := mustParse(t, live.server.URL)
+	pool.Report(liveUrl, 0, failure)
+	pool.Report(liveUrl, time.Millisecond, nil)
+	pool.Report(liveUrl, 0, failure)
+	if liveStats := statsOf(t, pool, live.server.URL); !liveStats.Available || liveStats.ConsecutiveFailures != 1 {
+		t.Errorf("Unexpected stats for the live proxy: %+v", liveStats)
+	}
+	pool.Report(liveUrl, 0, failure)
+	if _, err := fetch(t, client, "http://example.test/"); !errors.Is(err, ErrNoProxyAvailable) {
+		t.Errorf("Got error %v, want ErrNoProxyAvailable", err)
+	}
+}
+
+func TestRecheckAndReadmission(t *testing.T) {
+	flaky := newStubProxy(t, "flaky")
+	stable := newStubProxy(t, "stable")
+	checker := NewHttpHealthChecker("http://health.test/", time.Second)
+	pool, err := NewProxyPool([]string{flaky.server.URL, stable.server.URL},
+		SELECT_ROUND_ROBIN, 1, 20*time.Millisecond, checker)
+	if err != nil {
+		t.Fatalf("NewProxyPool() error: %s", err)
+	}
+	defer pool.Close()
+	client := newPoolClient(t, pool)
+	flaky.setDown(true)
+	if _, err := fetch(t, client, "http://example.test/"); err != nil {
+		t.Fatalf("Request error: %s", err)
+	}
+	if statsOf(t, pool, flaky.server.URL).Available {
+		t.Fatal("The flaky proxy should be evicted")
+	}
+	// 仍不可用的代理在健康检查之后仍处于被剔除的状态。
+	hits := atomic.LoadInt64(&flaky.hits)
+	waitFor(t, func() bool { return atomic.LoadInt64(&flaky.hits) >= hits+2 })
+	if stats := statsOf(t, pool, flaky.server.URL); stats.Available {
+		t.Fatalf("The flaky proxy should stay evicted while it is down: %+v", stats)
+	}
+	for i := 0; i < 3; i++ {
+		if got, err := fetch(t, client, "http://example.test/"); err != nil || got != "stable" {
+			t.Fatalf("Request %d went through %q (err=%v), want stable", i, got, err)
+		}
+	}
+	// 恢复之后，代理会在下一次健康检查时被重新启用。
+	flaky.setDown(false)
+	waitFor(t, func() bool { return statsOf(t, pool, flaky.server.URL).Available })
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		got, err := fetch(t, client, "http://example.test/")
+		if err != nil {
+			t.Fatalf("Request %d error: %s", i, err)
+		}
+		seen[got] = true
+	}
+	if !seen["flaky"] || !seen["stable"] {
+		t.Errorf("Requests went through %v, want both proxies", seen)
+	}
+	if stats := statsOf(t, pool, flaky.server.URL); stats.ConsecutiveFailures != 0 {
+		t.Errorf("Unexpected stats for the re-admitted proxy: %+v", stats)
+	}
+}
+
+func TestCloseStopsRecheck(t *testing.T) {
+	proxy := newStubProxy(t, "p0")
+	proxy.setDown(true)
+	checker := NewHttpHealthChecker("http://health.test/", time.Second)
+	pool, err := NewProxyPool([]string{proxy.server.URL}, SELECT_ROUND_ROBIN, 1, 10*time.Millisecond, checker)
+	if err != nil {
+		t.Fatalf("NewProxyPool() error: %s", err)
+	}
+	pool.Report(mustParse(t, proxy.server.URL), 0, errors.New("refused"))
+	waitFor(t, func() bool { return atomic.LoadInt64(&proxy.hits) > 0 })
+	pool.Close()
+	pool.Close()
+	time.Sleep(30 * time.Millisecond)
+	hits := atomic.LoadInt64(&proxy.hits)
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt64(&proxy.hits); got != hits {
+		t.Errorf("The proxy was checked %d more times after Close()", got-hits)
+	}
+}
+
+func mustParse(t *testing.T, rawUrl string) *url.URL {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatalf("Invalid URL %q: %s", rawUrl, err)
+	}
+	return u
+}
+
+// 等待条件被满足。超时则使测试失败。
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,74 @@
+package proxypool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// 被用来在请求的上下文中传递所选代理的键的类型。
+type proxyContextKey struct{}
+
+// 创建经由代理池发送请求的HTTP传输器。
+// 每个请求（包括重定向之后的请求）都会经由代理池选出的代理发送，其结果会被报告给代理池。
+// 连接错误和407响应被视为代理的失败，被取消的请求则不被计入。
+// 参数base代表底层的传输器。若其为nil，则使用http.DefaultTransport的副本。
+// 它必须是*http.Transport类型的，因为代理需要由其Proxy字段指定。
+func NewTransport(pool ProxyPool, base http.RoundTripper) (http.RoundTripper, error) {
+	if pool == nil {
+		return nil, errors.New("The proxy pool is nil!")
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		errMsg := fmt.Sprintf("Unsupported base transport %T! It must be *http.Transport.", base)
+		return nil, errors.New(errMsg)
+	}
+	transport = transport.Clone()
+	transport.Proxy = func(httpReq *http.Request) (*url.URL, error) {
+		proxyUrl, _ := httpReq.Context().Value(proxyContextKey{}).(*url.URL)
+		return proxyUrl, nil
+	}
+	return &proxyTransport{pool: pool, transport: transport}, nil
+}
+
+// 经由代理池发送请求的HTTP传输器的实现类型。
+type proxyTransport struct {
+	pool      ProxyPool       // 代理池。
+	transport *http.Transport // 底层的传输器。
+}
+
+func (pt *proxyTransport) RoundTrip(httpReq *http.Request) (*http.Response, error) {
+	proxyUrl, err := pt.pool.Select(httpReq)
+	if err != nil {
+		if httpReq.Body != nil {
+			httpReq.Body.Close()
+		}
+		return nil, err
+	}
+	ctx := context.WithValue(httpReq.Context(), proxyContextKey{}, proxyUrl)
+	start := time.Now()
+	httpResp, err := pt.transport.RoundTrip(httpReq.WithContext(ctx))
+	latency := time.Since(start)
+	switch {
+	case err != nil:
+		if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			pt.pool.Report(proxyUrl, latency, err)
+		}
+	case httpResp.StatusCode == http.StatusProxyAuthRequired:
+		pt.pool.Report(proxyUrl, latency, errors.New("Proxy authentication required"))
+	default:
+		pt.pool.Report(proxyUrl, latency, nil)
+	}
+	return httpResp, err
+}
+
+// 关闭底层传输器中的空闲连接。
+func (pt *proxyTransport) CloseIdleConnections() {
+	pt.transport.CloseIdleConnections()
+}
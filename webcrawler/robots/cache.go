@@ -0,0 +1,164 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	base "webcrawler/base"
+)
+
+// 日志记录器。
+var logger *logrus.Logger = base.NewLogger()
+
+// robots.txt的最大尺寸。超出部分会被忽略。
+const maxRobotsSize = 512 * 1024
+
+// 获取robots.txt出错（服务端出错或网络错误）时其结果的有效时间。
+// 之后robots.txt会被重新获取，以免一次偶然的错误影响整个缓存有效期。
+const errorTtl = 5 * time.Minute
+
+// robots.txt缓存的接口类型。
+// 针对每个站点（协议、主机名和端口号），robots.txt只会被获取和解析一次，
+// 直到其缓存过期为止。
+type RobotsCache interface {
+	// 判断URL是否被robots.txt允许访问。
+	// 若robots.txt尚未被缓存或已过期，则该方法会先获取它。参数ctx会被用于该次获取。
+	Allowed(ctx context.Context, u *url.URL) bool
+	// 获得针对URL所属站点的爬取间隔。未指定时返回0。
+	CrawlDelay(ctx context.Context, u *url.URL) time.Duration
+	// 获得用户代理。
+	UserAgent() string
+	// 获取摘要信息。
+	Summary() string
+}
+
+// 创建robots.txt缓存。
+// 参数client代表被用来获取robots.txt的HTTP客户端。
+// 参数userAgent代表用户代理。它既被用于选择规则组，也会被放入获取robots.txt的请求中。
+// 参数ttl代表缓存的有效时间。获取出错时的结果最多只会被缓存errorTtl的时间。
+func NewRobotsCache(client *http.Client, userAgent string, ttl time.Duration) RobotsCache {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &myRobotsCache{
+		client:    client,
+		userAgent: userAgent,
+		ttl:       ttl,
+		entries:   make(map[string]*robotsEntry),
+	}
+}
+
+// 缓存条目。
+type robotsEntry struct {
+	robots  *Robots       // 解析结果。
+	expires time.Time     // 过期时间。
+	ready   chan struct{} // 获取完成的通知通道。
+}
+
+// robots.txt缓存的实现类型。
+type myRobotsCache struct {
+	client    *http.Client            // HTTP客户端。
+	userAgent string                  // 用户代理。
+	ttl       time.Duration           // 缓存的有效时间。
+	entries   map[string]*robotsEntry // 缓存条目的字典。键为站点。
+	fetched   uint64                  // 已获取的次数。
+	mutex     sync.Mutex              // 互斥锁。
+}
+
+func (cache *myRobotsCache) Allowed(ctx context.Context, u *url.URL) bool {
+	robots := cache.get(ctx, u)
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return robots.Test(cache.userAgent, path)
+}
+
+func (cache *myRobotsCache) CrawlDelay(ctx context.Context, u *url.URL) time.Duration {
+	return cache.get(ctx, u).CrawlDelay(cache.userAgent)
+}
+
+func (cache *myRobotsCache) UserAgent() string {
+	return cache.userAgent
+}
+
+var robotsCacheSummaryTemplate = "userAgent: %s, ttl: %s, sites: %d, fetched: %d"
+
+func (cache *myRobotsCache) Summary() string {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return fmt.Sprintf(robotsCacheSummaryTemplate,
+		cache.userAgent, cache.ttl, len(cache.entries), cache.fetched)
+}
+
+// 获得URL所属站点的解析结果。
+// 同一站点的并发调用只会触发一次获取，其余调用会等待该次获取完成。
+func (cache *myRobotsCache) get(ctx context.Context, u *url.URL) *Robots {
+	site := strings.ToLower(u.Scheme + "://" + u.Host)
+	cache.mutex.Lock()
+	entry, ok := cache.entries[site]
+	if ok && (entry.robots == nil || time.Now().Before(entry.expires)) {
+		cache.mutex.Unlock()
+		<-entry.ready
+		return entry.robots
+	}
+	entry = &robotsEntry{ready: make(chan struct{})}
+	cache.entries[site] = entry
+	cache.fetched++
+	cache.mutex.Unlock()
+
+	robots, err := cache.fetch(ctx, site)
+	ttl := cache.ttl
+	if err != nil {
+		logger.Warnf("Fetch robots.txt error: %s (site=%s)\n", err, site)
+		if ttl > errorTtl {
+			ttl = errorTtl
+		}
+	}
+	cache.mutex.Lock()
+	entry.robots = robots
+	entry.expires = time.Now().Add(ttl)
+	cache.mutex.Unlock()
+	close(entry.ready)
+	return robots
+}
+
+// 获取并解析站点的robots.txt。
+// 若robots.txt不存在（状态码为4xx），则允许访问所有路径。
+// 若服务端出错（状态码为5xx），则暂时禁止访问所有路径。
+// 若出现网络错误，则允许访问所有路径，由下载器报告相应的错误。
+// 后两种情况会返回非nil的错误值，其结果只会被缓存较短的时间（参见errorTtl）。
+func (cache *myRobotsCache) fetch(ctx context.Context, site string) (*Robots, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", site+"/robots.txt", nil)
+	if err != nil {
+		return AllowAll(), err
+	}
+	if cache.userAgent != "" {
+		httpReq.Header.Set("User-Agent", cache.userAgent)
+	}
+	httpResp, err := cache.client.Do(httpReq)
+	if err != nil {
+		return AllowAll(), err
+	}
+	defer httpResp.Body.Close()
+	switch {
+	case httpResp.StatusCode >= 200 && httpResp.StatusCode < 300:
+		robots, err := Parse(io.LimitReader(httpResp.Body, maxRobotsSize))
+		if err != nil {
+			return AllowAll(), err
+		}
+		return robots, nil
+	case httpResp.StatusCode >= 500:
+		errMsg := fmt.Sprintf("Unavailable robots.txt (status code %d)", httpResp.StatusCode)
+		return DisallowAll(), errors.New(errMsg)
+	default:
+		return AllowAll(), nil
+	}
+}
@@ -0,0 +1,101 @@
+package robots
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRobotsCacheFetch(t *testing.T) {
+	var status int32 = http.StatusOK
+	var fetched int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		if r.Header.Get("User-Agent") != "webcrawler" {
+			t.Errorf("Unexpected user agent: %q", r.Header.Get("User-Agent"))
+		}
+		if code := int(atomic.LoadInt32(&status)); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		io.WriteString(w, "User-agent: *\nDisallow: /private\nCrawl-delay: 2\n")
+	}))
+	defer server.Close()
+	ttl := 24 * time.Hour
+	cases := []struct {
+		name        string
+		status      int32
+		wantAllowed bool
+		wantTtl     time.Duration
+	}{
+		{"ok", http.StatusOK, false, ttl},
+		{"not found", http.StatusNotFound, true, ttl},
+		{"unavailable", http.StatusServiceUnavailable, false, errorTtl},
+	}
+	for _, c := range cases {
+		atomic.StoreInt32(&status, c.status)
+		cache := NewRobotsCache(nil, "webcrawler", ttl).(*myRobotsCache)
+		u, _ := url.Parse(server.URL + "/private/page")
+		if got := cache.Allowed(context.Background(), u); got != c.wantAllowed {
+			t.Errorf("%s: Allowed() = %v, want %v", c.name, got, c.wantAllowed)
+		}
+		// 第二次调用使用缓存。
+		before := atomic.LoadInt32(&fetched)
+		cache.Allowed(context.Background(), u)
+		if atomic.LoadInt32(&fetched) != before {
+			t.Errorf("%s: robots.txt was fetched again", c.name)
+		}
+		entry := cache.entries[u.Scheme+"://"+u.Host]
+		if remaining := time.Until(entry.expires); remaining > c.wantTtl || remaining < c.wantTtl-time.Minute {
+			t.Errorf("%s: the entry expires in %s, want about %s", c.name, remaining, c.wantTtl)
+		}
+	}
+	atomic.StoreInt32(&status, http.StatusOK)
+	cache := NewRobotsCache(nil, "webcrawler", ttl)
+	u, _ := url.Parse(server.URL + "/")
+	if delay := cache.CrawlDelay(context.Background(), u); delay != 2*time.Second {
+		t.Errorf("CrawlDelay() = %s, want 2s", delay)
+	}
+}
+
+func TestRobotsCacheNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	serverUrl := server.URL
+	server.Close()
+	cache := NewRobotsCache(nil, "webcrawler", time.Hour).(*myRobotsCache)
+	u, _ := url.Parse(serverUrl + "/page")
+	if !cache.Allowed(context.Background(), u) {
+		t.Error("A network error should allow all paths")
+	}
+	entry := cache.entries[u.Scheme+"://"+u.Host]
+	if time.Until(entry.expires) > errorTtl {
+		t.Errorf("The result of a network error expires in %s, want at most %s",
+			time.Until(entry.expires), errorTtl)
+	}
+}
+
+func TestRobotsCacheContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	cache := NewRobotsCache(nil, "webcrawler", time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	u, _ := url.Parse(server.URL + "/page")
+	start := time.Now()
+	cache.Allowed(ctx, u)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("The fetch ignored the cancelled context and took %s", elapsed)
+	}
+}
@@ -0,0 +1,199 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robots.txt的解析结果。
+type Robots struct {
+	groups   []*group // 规则组的列表。
+	sitemaps []string // 站点地图的URL的列表。
+}
+
+// 规则组。一个规则组适用于一个或多个用户代理。
+type group struct {
+	agents     []string      // 用户代理的列表。均为小写形式。
+	rules      []rule        // 规则的列表。
+	crawlDelay time.Duration // 爬取间隔。为0则表示未指定。
+}
+
+// 规则。
+type rule struct {
+	allow   bool   // 是否为Allow规则。
+	pattern string // 路径模式。其中可以包含通配符“*”以及表示结尾的“$”。
+}
+
+// 创建一个允许访问所有路径的解析结果。
+func AllowAll() *Robots {
+	return &Robots{}
+}
+
+// 创建一个禁止访问所有路径的解析结果。
+func DisallowAll() *Robots {
+	return &Robots{
+		groups: []*group{
+			{agents: []string{"*"}, rules: []rule{{allow: false, pattern: "/"}}},
+		},
+	}
+}
+
+// 解析robots.txt的内容。
+// 无法识别的行会被忽略。这与绝大多数搜索引擎的处理方式一致。
+func Parse(r io.Reader) (*Robots, error) {
+	robots := &Robots{}
+	var current *group
+	// 表示当前规则组是否已包含规则。若是，则后续的User-agent行会开启一个新的规则组。
+	groupHasRules := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		index := strings.Index(line, ":")
+		if index < 0 {
+			continue
+		}
+		field := strings.ToLower(strings.TrimSpace(line[:index]))
+		value := strings.TrimSpace(line[index+1:])
+		switch field {
+		case "user-agent":
+			if current == nil || groupHasRules {
+				current = &group{}
+				robots.groups = append(robots.groups, current)
+				groupHasRules = false
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			groupHasRules = true
+			// 空的Disallow规则表示允许访问所有路径。
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules,
+				rule{allow: field == "allow", pattern: value})
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			groupHasRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			current.crawlDelay = time.Duration(seconds * float64(time.Second))
+		case "sitemap":
+			robots.sitemaps = append(robots.sitemaps, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return robots, nil
+}
+
+// 判断用户代理是否被允许访问某个路径。
+// 参数path应为包含查询字符串的请求路径，如“/a/b?c=d”。
+// 多条规则均匹配时，模式最长的规则生效。长度相同时Allow规则优先。
+func (robots *Robots) Test(userAgent string, path string) bool {
+	g := robots.findGroup(userAgent)
+	if g == nil {
+		return true
+	}
+	if path == "" {
+		path = "/"
+	}
+	allowed := true
+	matchedLen := -1
+	for _, r := range g.rules {
+		if !matchPattern(r.pattern, path) {
+			continue
+		}
+		patternLen := len(r.pattern)
+		if patternLen > matchedLen || (patternLen == matchedLen && r.allow) {
+			allowed = r.allow
+			matchedLen = patternLen
+		}
+	}
+	return allowed
+}
+
+// 获得针对用户代理的爬取间隔。未指定时返回0。
+func (robots *Robots) CrawlDelay(userAgent string) time.Duration {
+	g := robots.findGroup(userAgent)
+	if g == nil {
+		return 0
+	}
+	return g.crawlDelay
+}
+
+// 获得站点地图的URL的列表。
+func (robots *Robots) Sitemaps() []string {
+	return robots.sitemaps
+}
+
+// 查找适用于用户代理的规则组。
+// 名称与用户代理匹配得最具体（即最长）的规则组会被选中。若没有，则选中“*”规则组。
+func (robots *Robots) findGroup(userAgent string) *group {
+	userAgent = strings.ToLower(userAgent)
+	var found *group
+	var foundLen int
+	var wildcard *group
+	for _, g := range robots.groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+				continue
+			}
+			if agent != "" && strings.Contains(userAgent, agent) && len(agent) > foundLen {
+				found = g
+				foundLen = len(agent)
+			}
+		}
+	}
+	if found != nil {
+		return found
+	}
+	return wildcard
+}
+
+// 判断路径是否与模式匹配。
+// 模式中的“*”可以匹配任意长度的字符序列，位于模式末尾的“$”表示路径的结尾。
+// 不以“$”结尾的模式只需匹配路径的前缀。
+func matchPattern(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	// 第一部分必须是路径的前缀。
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	last := len(parts) - 1
+	for i := 1; i <= last; i++ {
+		part := parts[i]
+		if i == last && anchored {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		index := strings.Index(path[pos:], part)
+		if index < 0 {
+			return false
+		}
+		pos += index + len(part)
+	}
+	if anchored {
+		return pos == len(path)
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package robots
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	content := `# comment
+User-agent: a-bot
+User-agent: B-Bot   # trailing comment
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 1.5
+
+user-agent: *
+disallow:
+Sitemap: http://example.com/sitemap.xml
+Crawl-delay: oops
+Unknown line without colon
+Noindex: /ignored
+`
+	robots, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Parse() error: %s", err)
+	}
+	if len(robots.groups) != 2 {
+		t.Fatalf("Got %d groups, want 2", len(robots.groups))
+	}
+	first := robots.groups[0]
+	if !reflect.DeepEqual(first.agents, []string{"a-bot", "b-bot"}) {
+		t.Errorf("Unexpected agents of the first group: %q", first.agents)
+	}
+	wantRules := []rule{{allow: false, pattern: "/private"}, {allow: true, pattern: "/private/public"}}
+	if !reflect.DeepEqual(first.rules, wantRules) {
+		t.Errorf("Unexpected rules of the first group: %+v", first.rules)
+	}
+	if first.crawlDelay != 1500*time.Millisecond {
+		t.Errorf("Unexpected crawl delay of the first group: %s", first.crawlDelay)
+	}
+	second := robots.groups[1]
+	if !reflect.DeepEqual(second.agents, []string{"*"}) || len(second.rules) != 0 || second.crawlDelay != 0 {
+		t.Errorf("Unexpected second group: %+v", second)
+	}
+	if !reflect.DeepEqual(robots.Sitemaps(), []string{"http://example.com/sitemap.xml"}) {
+		t.Errorf("Unexpected sitemaps: %q", robots.Sitemaps())
+	}
+}
+
+func TestParseRulesBeforeUserAgent(t *testing.T) {
+	robots, err := Parse(strings.NewReader("Disallow: /\nCrawl-delay: 3\n"))
+	if err != nil {
+		t.Fatalf("Parse() error: %s", err)
+	}
+	if len(robots.groups) != 0 || !robots.Test("bot", "/") {
+		t.Errorf("Rules before any User-agent line should be ignored: %+v", robots.groups)
+	}
+}
+
+func TestFindGroup(t *testing.T) {
+	content := `User-agent: *
+Disallow: /all
+
+User-agent: googlebot
+Disallow: /google
+
+User-agent: googlebot-news
+Disallow: /news
+
+User-agent: other
+User-agent: another
+Disallow: /other
+`
+	robots, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Parse() error: %s", err)
+	}
+	cases := []struct {
+		userAgent string
+		want      string // 被选中的规则组中的唯一规则的模式。
+	}{
+		{"Googlebot", "/google"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", "/google"},
+		{"Googlebot-News", "/news"},
+		{"AnotherBot/1.0", "/other"},
+		{"other", "/other"},
+		{"webcrawler", "/all"},
+		{"", "/all"},
+	}
+	for _, c := range cases {
+		g := robots.findGroup(c.userAgent)
+		if g == nil || len(g.rules) != 1 || g.rules[0].pattern != c.want {
+			t.Errorf("findGroup(%q) = %+v, want the group with %q", c.userAgent, g, c.want)
+		}
+	}
+	noWildcard, _ := Parse(strings.NewReader("User-agent: googlebot\nDisallow: /\n"))
+	if g := noWildcard.findGroup("webcrawler"); g != nil {
+		t.Errorf("findGroup() without a wildcard group = %+v, want nil", g)
+	}
+	if !noWildcard.Test("webcrawler", "/") {
+		t.Error("A user agent without a matching group should be allowed")
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/", true},
+		{"/", "/anything", true},
+		{"/fish", "/fish", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/fish/salmon.html", true},
+		{"/fish", "/Fish.asp", false},
+		{"/fish", "/catfish", false},
+		{"/fish/", "/fish", false},
+		{"/fish*", "/fishheads/yummy.html", true},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php", "/windows.PHP", false},
+		{"/*.php$", "/filename.php", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/*.php$", "/filename.php5", false},
+		{"/fish*.php", "/fish.php", true},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"*", "/x", true},
+		{"/*$", "/x", true},
+		{"/p?q=1", "/p?q=1&r=2", true},
+	}
+	for _, c := range cases {
+		if got := matchPattern(c.pattern, c.path); got != c.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", c.pattern, c.path, got, c.want)
+		}
+	}
+}
+
+func TestTest(t *testing.T) {
+	content := `User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Allow: /page
+Disallow: /page
+Disallow: /search?
+Allow: /shop/*/item
+Disallow: /shop
+`
+	robots, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Parse() error: %s", err)
+	}
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"", true},
+		{"/", true},
+		{"/private", false},
+		{"/private/secret", false},
+		{"/private/public", true},
+		{"/private/public/x", true},
+		{"/doc.pdf", false},
+		{"/doc.pdf?download=1", true},
+		// 长度相同时Allow规则优先。
+		{"/page", true},
+		{"/search", true},
+		{"/search?q=go", false},
+		// 最长的匹配规则生效，与其在文件中的顺序无关。
+		{"/shop/books/item", true},
+		{"/shop/books/list", false},
+	}
+	for _, c := range cases {
+		if got := robots.Test("webcrawler", c.path); got != c.want {
+			t.Errorf("Test(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestAllowAllAndDisallowAll(t *testing.T) {
+	if !AllowAll().Test("bot", "/x") {
+		t.Error("AllowAll() should allow every path")
+	}
+	if DisallowAll().Test("bot", "/x") || DisallowAll().Test("bot", "") {
+		t.Error("DisallowAll() should disallow every path")
+	}
+}
@@ -0,0 +1,490 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	dl "webcrawler/downloader"
+	"webcrawler/proxypool"
+	"webcrawler/session"
+	"webcrawler/tool/canon"
+	"webcrawler/tool/charset"
+)
+
+// 默认的快照间隔时间。
+const defaultSnapshotInterval = 30 * time.Second
+
+// 默认的优雅关闭的超时时间。
+const defaultShutdownTimeout = 30 * time.Second
+
+// 默认的robots.txt用户代理。
+const defaultRobotsUserAgent = "webcrawler"
+
+// 默认的robots.txt缓存的有效时间。
+const defaultRobotsTtl = 24 * time.Hour
+
+// 调度器参数的容器的描述模板。
+var schedArgsTemplate string = "{ frontierDir: %q, snapshotInterval: %s," +
+	" prioritizer: %s, hostMaxInFlight: %d, hostMinDelay: %s, politenessByIp: %v," +
+	" obeyRobots: %v, robotsUserAgent: %q, robotsTtl: %s," +
+	" allowedSchemes: %v, schemeInsensitiveDedup: %v, canonicalizer: %s," +
+	" shutdownTimeout: %s, retryPolicy: %s, downloaderMiddlewares: %v, warcWriter: %s, bodyLimits: %v," +
+	" decodeCharset: %v, defaultCharset: %q, proxyPool: %s, headerProfiles: %v, sessionManager: %s }"
+
+// 调度器参数的容器。
+type SchedArgs struct {
+	frontierDir            string                    // 爬取边界的持久化目录。为空则表示不进行持久化。
+	snapshotInterval       time.Duration             // 爬取边界快照的间隔时间。
+	prioritizer            Prioritizer               // 请求优先级计算器。为nil则表示先进先出。
+	hostMaxInFlight        uint32                    // 每个主机的最大并发请求数量。为0则表示不限制。
+	hostMinDelay           time.Duration             // 针对同一主机的相邻两次请求之间的最小间隔。
+	politenessByIp         bool                      // 是否按照IP地址（而不是主机名）施加上述限制。
+	obeyRobots             bool                      // 是否遵守robots.txt。
+	robotsUserAgent        string                    // 针对robots.txt的用户代理。
+	robotsTtl              time.Duration             // robots.txt缓存的有效时间。
+	allowedSchemes         []string                  // 被允许的URL协议的列表。
+	schemeInsensitiveDedup bool                      // 去重时是否将http和https协议的同一URL视为同一网页。
+	canonicalizer          canon.Canonicalizer       // 去重之前被用来规范化URL的规范化器。
+	seenSetGenerator       GenSeenSet                // 已请求URL集合的生成器。
+	shutdownTimeout        time.Duration             // Run方法在上下文被取消后等待进行中的工作完成的最长时间。
+	retryPolicy            dl.RetryPolicy            // 下载的重试策略。为nil则表示不重试。
+	downloaderMiddlewares  []dl.DownloaderMiddleware // 下载器中间件的序列。
+	warcWriter             dl.WarcWriter             // 下载得到的网页的WARC写入器。为nil则表示不写入。
+	bodyLimits             *dl.BodyLimits            // 响应体限制。为nil则表示不限制。
+	decodeCharset          bool                      // 是否把文本响应体转换为UTF-8编码。
+	defaultCharset         string                    // 无法判定响应体的字符集时使用的字符集。
+	proxyPool              proxypool.ProxyPool       // 下载时使用的代理池。为nil则表示不使用代理池。
+	headerProfiles         *dl.HeaderProfiles        // 下载时使用的报头配置的集合。为nil则表示不使用。
+	sessionManager         session.SessionManager    // 会话管理器。为nil则表示不使用Cookie。
+	description            string                    // 描述。
+}
+
+// 创建调度器参数的容器。其中各参数均为默认值。
+func NewSchedArgs() SchedArgs {
+	return SchedArgs{
+		snapshotInterval: defaultSnapshotInterval,
+		robotsUserAgent:  defaultRobotsUserAgent,
+		robotsTtl:        defaultRobotsTtl,
+		allowedSchemes:   []string{"http", "https"},
+		canonicalizer:    canon.NewCanonicalizer(false),
+		seenSetGenerator: NewExactSeenSet,
+		shutdownTimeout:  defaultShutdownTimeout,
+	}
+}
+
+func (args *SchedArgs) Check() error {
+	if args.frontierDir != "" && args.snapshotInterval <= 0 {
+		return errors.New("The snapshot interval must be greater than 0!\n")
+	}
+	if args.hostMinDelay < 0 {
+		return errors.New("The host min delay can not be negative!\n")
+	}
+	if args.obeyRobots && args.robotsTtl <= 0 {
+		return errors.New("The robots.txt TTL must be greater than 0!\n")
+	}
+	if len(args.allowedSchemes) == 0 {
+		return errors.New("The allowed scheme list can not be empty!\n")
+	}
+	if args.canonicalizer == nil {
+		return errors.New("The URL canonicalizer is invalid!\n")
+	}
+	if args.seenSetGenerator == nil {
+		return errors.New("The seen set generator is invalid!\n")
+	}
+	for i, mw := range args.downloaderMiddlewares {
+		if mw == nil {
+			return errors.New(fmt.Sprintf("The %dth downloader middleware is invalid!\n", i))
+		}
+	}
+	if args.bodyLimits != nil {
+		if err := args.bodyLimits.Check(); err != nil {
+			return err
+		}
+	}
+	if args.headerProfiles != nil {
+		if err := args.headerProfiles.Check(); err != nil {
+			return err
+		}
+	}
+	if args.defaultCharset != "" && charset.Lookup(args.defaultCharset) == "" {
+		errMsg := fmt.Sprintf("Unsupported default charset %q!\n", args.defaultCharset)
+		return errors.New(errMsg)
+	}
+	if args.shutdownTimeout <= 0 {
+		return errors.New("The shutdown timeout must be greater than 0!\n")
+	}
+	return nil
+}
+
+func (args *SchedArgs) String() string {
+	if args.description == "" {
+		args.description =
+			fmt.Sprintf(schedArgsTemplate,
+				args.frontierDir,
+				args.snapshotInterval,
+				typeName(args.prioritizer),
+				args.hostMaxInFlight,
+				args.hostMinDelay,
+				args.politenessByIp,
+				args.obeyRobots,
+				args.robotsUserAgent,
+				args.robotsTtl,
+				args.allowedSchemes,
+				args.schemeInsensitiveDedup,
+				typeName(args.canonicalizer),
+				args.shutdownTimeout,
+				typeName(args.retryPolicy),
+				middlewareNames(args.downloaderMiddlewares),
+				typeName(args.warcWriter),
+				args.bodyLimits,
+				args.decodeCharset,
+				args.defaultCharset,
+				typeName(args.proxyPool),
+				args.headerProfiles,
+				typeName(args.sessionManager))
+	}
+	return args.description
+}
+
+// 获得爬取边界的持久化目录。
+func (args *SchedArgs) FrontierDir() string {
+	return args.frontierDir
+}
+
+// 设置爬取边界的持久化目录。
+// 待处理的请求和已请求的URL会以追加日志和定期快照的形式保存在该目录中。
+func (args *SchedArgs) SetFrontierDir(dir string) {
+	args.frontierDir = dir
+	args.description = ""
+}
+
+// 获得爬取边界快照的间隔时间。
+func (args *SchedArgs) SnapshotInterval() time.Duration {
+	return args.snapshotInterval
+}
+
+// 设置爬取边界快照的间隔时间。
+func (args *SchedArgs) SetSnapshotInterval(interval time.Duration) {
+	args.snapshotInterval = interval
+	args.description = ""
+}
+
+// 获得请求优先级计算器。
+func (args *SchedArgs) Prioritizer() Prioritizer {
+	return args.prioritizer
+}
+
+// 设置请求优先级计算器。若其值为nil，则请求缓存会按照先进先出的顺序调度请求。
+func (args *SchedArgs) SetPrioritizer(prioritizer Prioritizer) {
+	args.prioritizer = prioritizer
+	args.description = ""
+}
+
+// 获得每个主机的最大并发请求数量。
+func (args *SchedArgs) HostMaxInFlight() uint32 {
+	return args.hostMaxInFlight
+}
+
+// 设置每个主机的最大并发请求数量。其值为0时表示不限制。
+func (args *SchedArgs) SetHostMaxInFlight(max uint32) {
+	args.hostMaxInFlight = max
+	args.description = ""
+}
+
+// 获得针对同一主机的相邻两次请求之间的最小间隔。
+func (args *SchedArgs) HostMinDelay() time.Duration {
+	return args.hostMinDelay
+}
+
+// 设置针对同一主机的相邻两次请求之间的最小间隔。
+func (args *SchedArgs) SetHostMinDelay(delay time.Duration) {
+	args.hostMinDelay = delay
+	args.description = ""
+}
+
+// 判断是否按照IP地址施加针对主机的限制。
+func (args *SchedArgs) PolitenessByIp() bool {
+	return args.politenessByIp
+}
+
+// 设置是否按照IP地址施加针对主机的限制。
+// 若其值为true，则解析到同一IP地址的多个主机会共享并发请求数量和最小请求间隔的限制。
+func (args *SchedArgs) SetPolitenessByIp(byIp bool) {
+	args.politenessByIp = byIp
+	args.description = ""
+}
+
+// 判断是否遵守robots.txt。
+func (args *SchedArgs) ObeyRobots() bool {
+	return args.obeyRobots
+}
+
+// 设置是否遵守robots.txt。
+// 若其值为true，则被robots.txt禁止访问的请求会被忽略并被报告到错误通道，
+// 且robots.txt中的Crawl-delay会被作为相应主机的最小请求间隔。
+func (args *SchedArgs) SetObeyRobots(obey bool) {
+	args.obeyRobots = obey
+	args.description = ""
+}
+
+// 获得针对robots.txt的用户代理。
+func (args *SchedArgs) RobotsUserAgent() string {
+	return args.robotsUserAgent
+}
+
+// 设置针对robots.txt的用户代理。它被用来选择robots.txt中的规则组。
+func (args *SchedArgs) SetRobotsUserAgent(userAgent string) {
+	args.robotsUserAgent = userAgent
+	args.description = ""
+}
+
+// 获得robots.txt缓存的有效时间。
+func (args *SchedArgs) RobotsTtl() time.Duration {
+	return args.robotsTtl
+}
+
+// 设置robots.txt缓存的有效时间。
+func (args *SchedArgs) SetRobotsTtl(ttl time.Duration) {
+	args.robotsTtl = ttl
+	args.description = ""
+}
+
+// 获得被允许的URL协议的列表。
+func (args *SchedArgs) AllowedSchemes() []string {
+	return args.allowedSchemes
+}
+
+// 设置被允许的URL协议的列表。协议名称不区分大小写。
+// 协议不在该列表中的请求会被忽略。默认的列表为http和https。
+func (args *SchedArgs) SetAllowedSchemes(schemes ...string) {
+	allowedSchemes := make([]string, 0, len(schemes))
+	for _, scheme := range schemes {
+		allowedSchemes = append(allowedSchemes, strings.ToLower(scheme))
+	}
+	args.allowedSchemes = allowedSchemes
+	args.description = ""
+}
+
+// 判断URL协议是否被允许。
+func (args *SchedArgs) SchemeAllowed(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	for _, allowed := range args.allowedSchemes {
+		if scheme == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断去重时是否将http和https协议的同一URL视为同一网页。
+func (args *SchedArgs) SchemeInsensitiveDedup() bool {
+	return args.schemeInsensitiveDedup
+}
+
+// 设置去重时是否将http和https协议的同一URL视为同一网页。
+// 若其值为true，则“http://a.com/x”和“https://a.com/x”中只有先出现的那个会被请求。
+func (args *SchedArgs) SetSchemeInsensitiveDedup(insensitive bool) {
+	args.schemeInsensitiveDedup = insensitive
+	args.description = ""
+}
+
+// 获得URL规范化器。
+func (args *SchedArgs) Canonicalizer() canon.Canonicalizer {
+	return args.canonicalizer
+}
+
+// 设置URL规范化器。调度器会在去重之前使用它规范化请求的URL。
+// 默认的规范化器不会去掉跟踪参数。若要去掉跟踪参数或添加额外的规范化规则，
+// 可以使用canon.NewCanonicalizer函数创建新的规范化器。
+func (args *SchedArgs) SetCanonicalizer(canonicalizer canon.Canonicalizer) {
+	args.canonicalizer = canonicalizer
+	args.description = ""
+}
+
+// 获得已请求URL集合的生成器。
+func (args *SchedArgs) SeenSetGenerator() GenSeenSet {
+	return args.seenSetGenerator
+}
+
+// 设置已请求URL集合的生成器。调度器在每次启动或恢复时都会用它生成新的集合。
+// 默认生成的是精确的集合（参见NewExactSeenSet），其内存占用会随着已请求的URL的数量增长。
+// 对于大规模的爬取，可以改用生成基于布隆过滤器的集合的函数
+// （如返回NewScalableBloomSeenSet(1000000, 0.001)的函数）。
+// 从爬取边界恢复时，生成的集合的种类必须与被持久化的集合的种类相同。
+func (args *SchedArgs) SetSeenSetGenerator(generator GenSeenSet) {
+	args.seenSetGenerator = generator
+	args.description = ""
+}
+
+// 获得优雅关闭的超时时间。
+func (args *SchedArgs) ShutdownTimeout() time.Duration {
+	return args.shutdownTimeout
+}
+
+// 设置优雅关闭的超时时间。
+// Run方法的上下文被取消后，调度器最多会等待这么长的时间以使进行中的下载、分析和条目处理完成。
+// 超时之后，进行中的工作会被取消。
+func (args *SchedArgs) SetShutdownTimeout(timeout time.Duration) {
+	args.shutdownTimeout = timeout
+	args.description = ""
+}
+
+// 获得下载的重试策略。
+func (args *SchedArgs) RetryPolicy() dl.RetryPolicy {
+	return args.retryPolicy
+}
+
+// 设置下载的重试策略。若其值为nil，则下载失败的请求不会被重试。
+// 可以使用downloader.NewExponentialBackoffPolicy函数创建重试策略。
+func (args *SchedArgs) SetRetryPolicy(policy dl.RetryPolicy) {
+	args.retryPolicy = policy
+	args.description = ""
+}
+
+// 获得下载器中间件的序列。
+func (args *SchedArgs) DownloaderMiddlewares() []dl.DownloaderMiddleware {
+	return args.downloaderMiddlewares
+}
+
+// 设置下载器中间件的序列。每个网页下载器都会按照该顺序调用它们。
+// 各中间件会被所有网页下载器共享。
+func (args *SchedArgs) SetDownloaderMiddlewares(middlewares ...dl.DownloaderMiddleware) {
+	args.downloaderMiddlewares = middlewares
+	args.description = ""
+}
+
+// 获得下载得到的网页的WARC写入器。
+func (args *SchedArgs) WarcWriter() dl.WarcWriter {
+	return args.warcWriter
+}
+
+// 设置下载得到的网页的WARC写入器。若其值不为nil，则每个网页下载器都会在中间件序列的末尾
+// 使用由downloader.NewWarcMiddleware函数创建的中间件，把下载得到的网页写入WARC文件。
+// 调度器停止时会关闭该写入器。
+// 可以使用downloader.NewWarcWriter函数创建WARC写入器。
+func (args *SchedArgs) SetWarcWriter(writer dl.WarcWriter) {
+	args.warcWriter = writer
+	args.description = ""
+}
+
+// 获得响应体限制。
+func (args *SchedArgs) BodyLimits() *dl.BodyLimits {
+	return args.bodyLimits
+}
+
+// 设置响应体限制。若其值不为nil，则每个网页下载器都会在中间件序列的最末尾
+// 使用由downloader.NewBodyLimitMiddleware函数创建的中间件，
+// 以使包括WARC写入器在内的其他中间件读取到的都是受限的响应体。
+// 被拒绝的响应会被当作下载错误报告，且不会被重试。
+func (args *SchedArgs) SetBodyLimits(limits *dl.BodyLimits) {
+	args.bodyLimits = limits
+	args.description = ""
+}
+
+// 判断是否把文本响应体转换为UTF-8编码。
+func (args *SchedArgs) DecodeCharset() bool {
+	return args.decodeCharset
+}
+
+// 设置是否把文本响应体转换为UTF-8编码。若其值为true，则每个网页下载器都会在中间件序列的开头
+// 使用由downloader.NewCharsetMiddleware函数创建的中间件，
+// 以使响应解析函数读到的总是UTF-8编码的响应体。
+func (args *SchedArgs) SetDecodeCharset(decode bool) {
+	args.decodeCharset = decode
+	args.description = ""
+}
+
+// 获得无法判定响应体的字符集时使用的字符集。
+func (args *SchedArgs) DefaultCharset() string {
+	return args.defaultCharset
+}
+
+// 设置无法判定响应体的字符集时使用的字符集。若其值为空，则使用windows-1252。
+// 其值可以是WHATWG Encoding Standard中的任何标签。例如，对于中文网站可以将其设置为gbk，对于日文网站可以设置为shift_jis。
+func (args *SchedArgs) SetDefaultCharset(defaultCharset string) {
+	args.defaultCharset = defaultCharset
+	args.description = ""
+}
+
+// 获得下载时使用的代理池。
+func (args *SchedArgs) ProxyPool() proxypool.ProxyPool {
+	return args.proxyPool
+}
+
+// 设置下载时使用的代理池。若其值不为nil，则网页下载器和robots.txt缓存使用的HTTP客户端的传输器
+// 都会被由proxypool.NewTransport函数创建的传输器包装，以使每个请求都经由代理池选出的代理发送。
+// 这要求HTTP客户端的传输器为nil或*http.Transport类型的值。
+// 各代理的统计信息会出现在调度器的摘要信息中。调度器停止时会关闭该代理池。
+func (args *SchedArgs) SetProxyPool(pool proxypool.ProxyPool) {
+	args.proxyPool = pool
+	args.description = ""
+}
+
+// 获得下载时使用的报头配置的集合。
+func (args *SchedArgs) HeaderProfiles() *dl.HeaderProfiles {
+	return args.headerProfiles
+}
+
+// 设置下载时使用的报头配置的集合。若其值不为nil，则每个网页下载器都会在中间件序列的开头
+// 使用由downloader.NewHeaderProfileMiddleware函数创建的中间件，为请求添加User-Agent等报头。
+// 每个请求使用的报头配置会在其被放入请求缓存时确定，并被记录在请求（以及相应的响应）中。
+// 可以使用downloader.LoadHeaderProfiles函数从配置文件中载入报头配置。
+func (args *SchedArgs) SetHeaderProfiles(profiles *dl.HeaderProfiles) {
+	args.headerProfiles = profiles
+	args.description = ""
+}
+
+// 获得会话管理器。
+func (args *SchedArgs) SessionManager() session.SessionManager {
+	return args.sessionManager
+}
+
+// 设置会话管理器。若其值不为nil，则它会被用作网页下载器和robots.txt缓存使用的HTTP客户端的Cookie容器，
+// 以使每个站点（或具名会话）拥有独立的Cookie，且会话的登录函数会在该会话的第一个请求被下载之前被调用。
+// 调度器停止时会保存各会话的Cookie。
+// 可以使用session.NewSessionManager函数创建会话管理器。
+func (args *SchedArgs) SetSessionManager(sessionManager session.SessionManager) {
+	args.sessionManager = sessionManager
+	args.description = ""
+}
+
+// 获得网页下载器实际使用的下载器中间件的序列。
+// 除了已设置的下载器中间件之外，其中总会包含进行内容编码协商（位于开头）和透明解压（位于末尾）的中间件，
+// 参数transferStats代表后者使用的传输统计。
+func (args *SchedArgs) effectiveMiddlewares(transferStats *dl.TransferStats) []dl.DownloaderMiddleware {
+	middlewares := make([]dl.DownloaderMiddleware, 0, len(args.downloaderMiddlewares)+6)
+	// 内容编码协商必须先于HTTP缓存等用户中间件，以便它们看到最终的Accept-Encoding报头。
+	middlewares = append(middlewares, dl.NewAcceptEncodingMiddleware())
+	if args.headerProfiles != nil {
+		middlewares = append(middlewares, dl.NewHeaderProfileMiddleware(args.headerProfiles))
+	}
+	if args.decodeCharset {
+		middlewares = append(middlewares, dl.NewCharsetMiddleware(args.defaultCharset))
+	}
+	middlewares = append(middlewares, args.downloaderMiddlewares...)
+	if args.warcWriter != nil {
+		middlewares = append(middlewares, dl.NewWarcMiddleware(args.warcWriter))
+	}
+	if args.bodyLimits != nil {
+		middlewares = append(middlewares, dl.NewBodyLimitMiddleware(args.bodyLimits))
+	}
+	return append(middlewares, dl.NewDecompressionMiddleware(transferStats))
+}
+
+// 获得值的类型名称。值为nil时返回"<nil>"。
+func typeName(v interface{}) string {
+	if v == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// 获得各个下载器中间件的类型名称。
+func middlewareNames(middlewares []dl.DownloaderMiddleware) []string {
+	names := make([]string, 0, len(middlewares))
+	for _, mw := range middlewares {
+		names = append(names, typeName(mw))
+	}
+	return names
+}
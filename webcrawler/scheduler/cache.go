@@ -1,8 +1,10 @@
 package scheduler
 
 import (
+	"container/heap"
 	"fmt"
 	"sync"
+	"time"
 	base "webcrawler/base"
 )
 
@@ -13,11 +15,16 @@ var statusMap = map[byte]string{
 }
 
 // 请求缓存的接口类型。
+// 请求缓存会按照队列键（如主机名或IP地址）把请求分别放入不同的队列。
 type requestCache interface {
-	// 将请求放入请求缓存。
-	put(req *base.Request) bool
-	// 从请求缓存获取最早被放入且仍在其中的请求。
-	get() *base.Request
+	// 将请求连同其优先级放入请求缓存。
+	put(req *base.Request, priority float64) bool
+	// 从可被调度的队列中获取优先级最高且仍在其中的请求，同时返回该请求的队列键。
+	// 优先级相同的请求中，最早被放入的请求会被最先获取。
+	// 参数wait被用来判断某个队列当前是否可被调度（参见queueWait）。其值为nil时所有队列均可被调度。
+	get(wait queueWait) (*base.Request, string)
+	// 唤醒因并发请求数量达到上限而被搁置的队列。应在该队列的一个请求处理完毕之后被调用。
+	wake(queueKey string)
 	// 获得请求缓存的容量。
 	capacity() int
 	// 获得请求缓存的实时长度，即：其中的请求的即时数量。
@@ -28,57 +35,261 @@ type requestCache interface {
 	summary() string
 }
 
+// 判断队列当前是否可被调度的函数的类型。
+// 若队列可被调度，则结果值均为零值。若队列需要等待一段时间，则结果值delay代表需要等待的时间。
+// 若队列需要等待其某个请求处理完毕，则结果值blocked为true。
+type queueWait func(queueKey string) (delay time.Duration, blocked bool)
+
 // 创建请求缓存。
-func newRequestCache() requestCache {
-	rc := &reqCacheBySlice{
-		cache: make([]*base.Request, 0),
+// 参数queueKeyOf被用来获得请求所属队列的键。其值为nil时所有请求均属于同一个队列。
+func newRequestCache(queueKeyOf func(req *base.Request) string) requestCache {
+	rc := &reqCacheByHeap{
+		queues:     make(map[string]*reqQueue),
+		queueKeyOf: queueKeyOf,
 	}
 	return rc
 }
 
+// 请求缓存中的条目。
+type reqEntry struct {
+	req      *base.Request // 请求。
+	priority float64       // 优先级。值越大越优先。
+	seq      uint64        // 被放入时的序号。
+}
+
+// 请求条目的堆。堆顶总是优先级最高且最早被放入的条目。
+type reqHeap []*reqEntry
+
+func (h reqHeap) Len() int { return len(h) }
+
+func (h reqHeap) Less(i, j int) bool {
+	return h[i].before(h[j])
+}
+
+func (h reqHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *reqHeap) Push(x interface{}) {
+	*h = append(*h, x.(*reqEntry))
+}
+
+func (h *reqHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return entry
+}
+
+// 判断本条目是否先于另一个条目。
+func (entry *reqEntry) before(other *reqEntry) bool {
+	if entry.priority != other.priority {
+		return entry.priority > other.priority
+	}
+	return entry.seq < other.seq
+}
+
+// 队列的调度状态。
+const (
+	queueReady   = 0 // 可被调度，位于就绪队列的堆中。
+	queueDelayed = 1 // 需要等待一段时间，位于延迟队列的堆中。
+	queueBlocked = 2 // 需要等待其某个请求处理完毕，直到被唤醒为止。
+)
+
+// 请求队列。
+type reqQueue struct {
+	key     string    // 队列键。
+	entries reqHeap   // 请求条目的堆。
+	state   int       // 调度状态。
+	index   int       // 在就绪队列的堆或延迟队列的堆中的位置。
+	readyAt time.Time // 延迟结束的时间。仅在调度状态为queueDelayed时有效。
+}
+
+// 就绪队列的堆。堆顶总是其堆顶条目最先被获取的队列。
+type readyHeap []*reqQueue
+
+func (h readyHeap) Len() int { return len(h) }
+
+func (h readyHeap) Less(i, j int) bool {
+	return h[i].entries[0].before(h[j].entries[0])
+}
+
+func (h readyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *readyHeap) Push(x interface{}) {
+	queue := x.(*reqQueue)
+	queue.index = len(*h)
+	*h = append(*h, queue)
+}
+
+func (h *readyHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	queue := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return queue
+}
+
+// 延迟队列的堆。堆顶总是延迟最先结束的队列。
+type delayedHeap []*reqQueue
+
+func (h delayedHeap) Len() int { return len(h) }
+
+func (h delayedHeap) Less(i, j int) bool {
+	return h[i].readyAt.Before(h[j].readyAt)
+}
+
+func (h delayedHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *delayedHeap) Push(x interface{}) {
+	queue := x.(*reqQueue)
+	queue.index = len(*h)
+	*h = append(*h, queue)
+}
+
+func (h *delayedHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	queue := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return queue
+}
+
 // 请求缓存的实现类型。
-type reqCacheBySlice struct {
-	cache  []*base.Request // 请求的存储介质。
-	mutex  sync.Mutex      // 互斥锁。
-	status byte            // 缓存状态。0表示正在运行，1表示已关闭。
+// 可被调度的队列按照其堆顶条目被索引在就绪队列的堆中，因此获取请求时不必逐个检查所有的队列。
+// 需要等待的队列会被移出该堆，直到延迟结束或被唤醒为止。
+type reqCacheByHeap struct {
+	queues     map[string]*reqQueue           // 各个队列的字典。
+	ready      readyHeap                      // 就绪队列的堆。
+	delayed    delayedHeap                    // 延迟队列的堆。
+	queueKeyOf func(req *base.Request) string // 获得请求所属队列的键的函数。
+	size       int                            // 请求的总数量。
+	seq        uint64                         // 当前的序号。
+	mutex      sync.Mutex                     // 互斥锁。
+	status     byte                           // 缓存状态。0表示正在运行，1表示已关闭。
 }
 
-func (rcache *reqCacheBySlice) put(req *base.Request) bool {
+func (rcache *reqCacheByHeap) put(req *base.Request, priority float64) bool {
 	if req == nil {
 		return false
 	}
 	if rcache.status == 1 {
 		return false
 	}
+	// 获得队列键可能需要解析域名，因此不能在持有锁的情况下进行。
+	var queueKey string
+	if rcache.queueKeyOf != nil {
+		queueKey = rcache.queueKeyOf(req)
+	}
 	rcache.mutex.Lock()
 	defer rcache.mutex.Unlock()
-	rcache.cache = append(rcache.cache, req)
+	rcache.seq++
+	entry := &reqEntry{req: req, priority: priority, seq: rcache.seq}
+	queue, ok := rcache.queues[queueKey]
+	if !ok {
+		queue = &reqQueue{key: queueKey, state: queueReady}
+		rcache.queues[queueKey] = queue
+		heap.Push(&queue.entries, entry)
+		heap.Push(&rcache.ready, queue)
+	} else {
+		heap.Push(&queue.entries, entry)
+		// 堆顶条目可能已经改变。
+		if queue.state == queueReady {
+			heap.Fix(&rcache.ready, queue.index)
+		}
+	}
+	rcache.size++
 	return true
 }
 
-func (rcache *reqCacheBySlice) get() *base.Request {
+func (rcache *reqCacheByHeap) get(wait queueWait) (*base.Request, string) {
 	if rcache.length() == 0 {
-		return nil
+		return nil, ""
 	}
 	if rcache.status == 1 {
-		return nil
+		return nil, ""
 	}
 	rcache.mutex.Lock()
 	defer rcache.mutex.Unlock()
-	req := rcache.cache[0]
-	rcache.cache = rcache.cache[1:]
-	return req
+	now := time.Now()
+	for len(rcache.delayed) > 0 && !rcache.delayed[0].readyAt.After(now) {
+		queue := heap.Pop(&rcache.delayed).(*reqQueue)
+		queue.state = queueReady
+		heap.Push(&rcache.ready, queue)
+	}
+	for len(rcache.ready) > 0 {
+		queue := rcache.ready[0]
+		if wait != nil {
+			if delay, blocked := wait(queue.key); blocked || delay > 0 {
+				heap.Pop(&rcache.ready)
+				if blocked {
+					queue.state = queueBlocked
+				} else {
+					queue.state = queueDelayed
+					queue.readyAt = now.Add(delay)
+					heap.Push(&rcache.delayed, queue)
+				}
+				continue
+			}
+		}
+		entry := heap.Pop(&queue.entries).(*reqEntry)
+		if queue.entries.Len() == 0 {
+			heap.Pop(&rcache.ready)
+			delete(rcache.queues, queue.key)
+		} else {
+			heap.Fix(&rcache.ready, 0)
+		}
+		rcache.size--
+		return entry.req, queue.key
+	}
+	return nil, ""
 }
 
-func (rcache *reqCacheBySlice) capacity() int {
-	return cap(rcache.cache)
+func (rcache *reqCacheByHeap) wake(queueKey string) {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	queue, ok := rcache.queues[queueKey]
+	if !ok || queue.state != queueBlocked {
+		return
+	}
+	queue.state = queueReady
+	heap.Push(&rcache.ready, queue)
+}
+
+func (rcache *reqCacheByHeap) capacity() int {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	var capacity int
+	for _, queue := range rcache.queues {
+		capacity += cap(queue.entries)
+	}
+	return capacity
 }
 
-func (rcache *reqCacheBySlice) length() int {
-	return len(rcache.cache)
+func (rcache *reqCacheByHeap) length() int {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	return rcache.size
+}
+
+// 获得队列的数量。
+func (rcache *reqCacheByHeap) queueNumber() int {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	return len(rcache.queues)
 }
 
-func (rcache *reqCacheBySlice) close() {
+func (rcache *reqCacheByHeap) close() {
 	if rcache.status == 1 {
 		return
 	}
@@ -86,12 +297,13 @@ func (rcache *reqCacheBySlice) close() {
 }
 
 // 摘要信息模板。
-var summaryTemplate = "status: %s, " + "length: %d, " + "capacity: %d"
+var summaryTemplate = "status: %s, " + "length: %d, " + "capacity: %d, " + "queues: %d"
 
-func (rcache *reqCacheBySlice) summary() string {
+func (rcache *reqCacheByHeap) summary() string {
 	summary := fmt.Sprintf(summaryTemplate,
 		statusMap[rcache.status],
 		rcache.length(),
-		rcache.capacity())
+		rcache.capacity(),
+		rcache.queueNumber())
 	return summary
 }
@@ -0,0 +1,237 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/publicsuffix"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	base "webcrawler/base"
+)
+
+// 请求过滤器的接口类型。
+// 调度器在把请求放入请求缓存之前，会依次使用各个请求过滤器对其进行过滤。
+// 只要有一个请求过滤器拒绝了请求，该请求就会被忽略。
+type RequestFilter interface {
+	// 过滤请求。若请求被拒绝，则结果值accepted为false，且reason为拒绝的原因。
+	// 拒绝的原因会作为计数的依据出现在调度器的摘要信息中，因此它应该是简短且固定的。
+	Filter(req *base.Request) (accepted bool, reason string)
+}
+
+// 获得请求的主机名。其中不包含端口号且为小写形式。
+func reqHost(req *base.Request) string {
+	return strings.ToLower(req.HttpReq().URL.Hostname())
+}
+
+// 判断主机名是否属于某个域。
+// 若主机名与域相同或为该域的子域，则结果为true。
+func hostInDomain(host string, domain string) bool {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// 创建基于主机名列表的请求过滤器。
+// 列表中的每一项都会同时匹配相同的主机名及其所有子域。
+// 参数allow代表允许访问的主机名的列表。若其为空，则表示允许访问任何主机。
+// 参数deny代表禁止访问的主机名的列表。它优先于参数allow。
+func NewHostListFilter(allow []string, deny []string) RequestFilter {
+	return &hostListFilter{allow: allow, deny: deny}
+}
+
+// 基于主机名列表的请求过滤器的实现类型。
+type hostListFilter struct {
+	allow []string // 允许访问的主机名的列表。
+	deny  []string // 禁止访问的主机名的列表。
+}
+
+func (filter *hostListFilter) Filter(req *base.Request) (bool, string) {
+	host := reqHost(req)
+	for _, domain := range filter.deny {
+		if hostInDomain(host, domain) {
+			return false, "host denied"
+		}
+	}
+	if len(filter.allow) == 0 {
+		return true, ""
+	}
+	for _, domain := range filter.allow {
+		if hostInDomain(host, domain) {
+			return true, ""
+		}
+	}
+	return false, "host not allowed"
+}
+
+// 创建基于正则表达式的请求过滤器。
+// 参数include代表URL必须匹配的正则表达式的列表。URL只需匹配其中之一即可。若其为空，则不做要求。
+// 参数exclude代表URL不能匹配的正则表达式的列表。它优先于参数include。
+func NewRegexFilter(include []string, exclude []string) (RequestFilter, error) {
+	compile := func(exprs []string) ([]*regexp.Regexp, error) {
+		res := make([]*regexp.Regexp, 0, len(exprs))
+		for _, expr := range exprs {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				errMsg := fmt.Sprintf("Invalid regex '%s': %s", expr, err)
+				return nil, errors.New(errMsg)
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+	includeRes, err := compile(include)
+	if err != nil {
+		return nil, err
+	}
+	excludeRes, err := compile(exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &regexFilter{include: includeRes, exclude: excludeRes}, nil
+}
+
+// 基于正则表达式的请求过滤器的实现类型。
+type regexFilter struct {
+	include []*regexp.Regexp // URL必须匹配的正则表达式的列表。
+	exclude []*regexp.Regexp // URL不能匹配的正则表达式的列表。
+}
+
+func (filter *regexFilter) Filter(req *base.Request) (bool, string) {
+	reqUrl := req.HttpReq().URL.String()
+	for _, re := range filter.exclude {
+		if re.MatchString(reqUrl) {
+			return false, "regex excluded"
+		}
+	}
+	if len(filter.include) == 0 {
+		return true, ""
+	}
+	for _, re := range filter.include {
+		if re.MatchString(reqUrl) {
+			return true, ""
+		}
+	}
+	return false, "regex not included"
+}
+
+// 创建同主机请求过滤器。只有主机名与参数hosts中的某一项完全相同的请求才会被接受。
+func NewSameHostFilter(hosts ...string) RequestFilter {
+	hostMap := make(map[string]bool)
+	for _, host := range hosts {
+		hostMap[strings.ToLower(stripPort(host))] = true
+	}
+	return &sameHostFilter{hosts: hostMap}
+}
+
+// 同主机请求过滤器的实现类型。
+type sameHostFilter struct {
+	hosts map[string]bool // 主机名的字典。
+}
+
+func (filter *sameHostFilter) Filter(req *base.Request) (bool, string) {
+	if filter.hosts[reqHost(req)] {
+		return true, ""
+	}
+	return false, "other host"
+}
+
+// 创建同域请求过滤器。
+// 只有可注册域名（依据公共后缀列表得出，如“www.example.co.uk”的可注册域名为“example.co.uk”）
+// 与参数hosts中的某一项相同的请求才会被接受。IP地址只与其自身相同。
+func NewSameDomainFilter(hosts ...string) RequestFilter {
+	domainMap := make(map[string]bool)
+	for _, host := range hosts {
+		domainMap[registrableDomain(strings.ToLower(stripPort(host)))] = true
+	}
+	return &sameDomainFilter{domains: domainMap}
+}
+
+// 同域请求过滤器的实现类型。
+type sameDomainFilter struct {
+	domains map[string]bool // 可注册域名的字典。
+}
+
+func (filter *sameDomainFilter) Filter(req *base.Request) (bool, string) {
+	if filter.domains[registrableDomain(reqHost(req))] {
+		return true, ""
+	}
+	return false, "other domain"
+}
+
+// 获得主机名的可注册域名。若无法得出，则返回主机名本身。
+func registrableDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// 去掉主机名中的端口号。
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// 创建按主机限制最大深度的请求过滤器。
+// 参数depths的键为主机名（同时匹配其所有子域），值为与之对应的最大深度。
+// 若主机名匹配多个键，则以最长（即最具体）的键为准。未匹配任何键的请求不受限制。
+func NewMaxDepthPerHostFilter(depths map[string]uint32) RequestFilter {
+	innerDepths := make(map[string]uint32)
+	for domain, depth := range depths {
+		innerDepths[strings.TrimPrefix(strings.ToLower(domain), ".")] = depth
+	}
+	return &maxDepthPerHostFilter{depths: innerDepths}
+}
+
+// 按主机限制最大深度的请求过滤器的实现类型。
+type maxDepthPerHostFilter struct {
+	depths map[string]uint32 // 主机名与最大深度的字典。
+}
+
+func (filter *maxDepthPerHostFilter) Filter(req *base.Request) (bool, string) {
+	host := reqHost(req)
+	var matched string
+	var maxDepth uint32
+	for domain, depth := range filter.depths {
+		if hostInDomain(host, domain) && len(domain) > len(matched) {
+			matched = domain
+			maxDepth = depth
+		}
+	}
+	if matched != "" && req.Depth() > maxDepth {
+		return false, "host depth"
+	}
+	return true, ""
+}
+
+// 请求拒绝原因的计数器。
+type rejectCounter struct {
+	counts map[string]uint64 // 各个原因的计数。
+	mutex  sync.Mutex        // 互斥锁。
+}
+
+// 创建请求拒绝原因的计数器。
+func newRejectCounter() *rejectCounter {
+	return &rejectCounter{counts: make(map[string]uint64)}
+}
+
+// 为原因计数。
+func (counter *rejectCounter) count(reason string) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	counter.counts[reason]++
+}
+
+// 获取摘要信息。
+func (counter *rejectCounter) summary() string {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	return fmt.Sprintf("%v", counter.counts)
+}
@@ -0,0 +1,376 @@
+package scheduler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	base "webcrawler/base"
+)
+
+// 爬取边界持久化文件的名称。
+const (
+	FRONTIER_LOG_FILE      = "frontier.log"
+	FRONTIER_SNAPSHOT_FILE = "frontier.snapshot"
+)
+
+// 日志记录的操作类型。
+const (
+	frontierOpPut  = "put"  // 请求被放入请求缓存。
+	frontierOpDone = "done" // 请求已被处理完毕。
+	frontierOpSeen = "seen" // URL已被请求。
+)
+
+// 爬取边界存储的接口类型。
+type frontierStore interface {
+	// 清空存储并记录本次爬取的首次请求。
+	reset(seeds []string) error
+	// 加载存储中的首次请求和待处理的请求，并把已请求的URL还原到参数seen中。
+	load(seen SeenSet) (seeds []string, pending []*base.Request, err error)
+	// 记录被放入请求缓存的请求。
+	put(key string, req *base.Request) error
+	// 记录已处理完毕的请求。
+	done(key string) error
+	// 记录已请求的URL。
+	seen(key string) error
+	// 生成快照并截断追加日志。参数seen代表当前所有已请求的URL。
+	snapshot(seen SeenSet) error
+	// 关闭存储。
+	close() error
+	// 获取摘要信息。
+	summary() string
+}
+
+// 被持久化的请求。
+type persistedRequest struct {
+	Method        string      `json:"method"`
+	Url           string      `json:"url"`
+	Header        http.Header `json:"header,omitempty"`
+	Depth         uint32      `json:"depth"`
+	Attempts      uint32      `json:"attempts,omitempty"`
+	MaxAttempts   uint32      `json:"maxAttempts,omitempty"`
+	HeaderProfile string      `json:"headerProfile,omitempty"`
+	Body          []byte      `json:"body,omitempty"`
+}
+
+// 追加日志中的记录。
+type frontierRecord struct {
+	Op  string            `json:"op"`
+	Key string            `json:"key"`
+	Req *persistedRequest `json:"req,omitempty"`
+}
+
+// 快照的内容。
+type frontierSnapshot struct {
+	Seeds   []string         `json:"seeds"`
+	Pending []frontierRecord `json:"pending"`
+	SeenSet []byte           `json:"seenSet,omitempty"` // 已请求URL集合的序列化形式。
+	Seen    []string         `json:"seen,omitempty"`    // 旧版快照中的已请求的URL。
+}
+
+// 待处理的请求的条目。
+type pendingEntry struct {
+	seq uint64            // 被放入时的序号。
+	req *persistedRequest // 被持久化的请求。
+}
+
+// 创建爬取边界存储。
+func newFrontierStore(dir string) (frontierStore, error) {
+	if dir == "" {
+		return nil, errors.New("The frontier directory is empty!")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &frontierByFile{
+		dir:     dir,
+		pending: make(map[string]*pendingEntry),
+	}, nil
+}
+
+// 基于文件的爬取边界存储的实现类型。
+type frontierByFile struct {
+	dir     string                   // 存储目录。
+	logFile *os.File                 // 追加日志文件。
+	seeds   []string                 // 首次请求的URL。
+	pending map[string]*pendingEntry // 待处理的请求的字典。
+	seq     uint64                   // 当前的序号。
+	logged  uint64                   // 自上次快照以来的日志记录数量。
+	closed  bool                     // 是否已关闭。
+	mutex   sync.Mutex               // 互斥锁。
+}
+
+func (fs *frontierByFile) reset(seeds []string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	fs.seeds = seeds
+	fs.pending = make(map[string]*pendingEntry)
+	fs.seq = 0
+	return fs.writeSnapshot(nil)
+}
+
+func (fs *frontierByFile) load(seen SeenSet) (
+	seeds []string, pending []*base.Request, err error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	var snapshot frontierSnapshot
+	data, err := os.ReadFile(filepath.Join(fs.dir, FRONTIER_SNAPSHOT_FILE))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("No frontier found in directory %q!", fs.dir)
+		}
+		return nil, nil, err
+	}
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return nil, nil, fmt.Errorf("Broken frontier snapshot: %s", err)
+	}
+	fs.seeds = snapshot.Seeds
+	fs.pending = make(map[string]*pendingEntry)
+	if len(snapshot.SeenSet) > 0 {
+		if err = seen.UnmarshalBinary(snapshot.SeenSet); err != nil {
+			return nil, nil, fmt.Errorf("Broken frontier snapshot: %s", err)
+		}
+	}
+	for _, key := range snapshot.Seen {
+		seen.Add(key)
+	}
+	for _, record := range snapshot.Pending {
+		fs.replay(record, seen)
+	}
+	logFile, err := os.Open(filepath.Join(fs.dir, FRONTIER_LOG_FILE))
+	if err == nil {
+		fs.replayLog(logFile, seen)
+		logFile.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	// 将回放的结果落盘，以便从一个干净的日志开始。
+	if err = fs.writeSnapshot(seen); err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range fs.sortedPending() {
+		req, err := entry.req.toRequest()
+		if err != nil {
+			logger.Warnf("Ignore the persisted request! %s (requestUrl=%s)\n",
+				err, entry.req.Url)
+			continue
+		}
+		pending = append(pending, req)
+	}
+	return fs.seeds, pending, nil
+}
+
+// 回放追加日志。日志末尾不完整的记录会被忽略。
+func (fs *frontierByFile) replayLog(r io.Reader, seen SeenSet) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record frontierRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logger.Warnf("Ignore the broken frontier record: %s\n", err)
+			continue
+		}
+		fs.replay(record, seen)
+	}
+}
+
+// 回放一条记录。
+func (fs *frontierByFile) replay(record frontierRecord, seen SeenSet) {
+	switch record.Op {
+	case frontierOpPut:
+		if record.Req == nil {
+			return
+		}
+		fs.seq++
+		fs.pending[record.Key] = &pendingEntry{seq: fs.seq, req: record.Req}
+	case frontierOpDone:
+		delete(fs.pending, record.Key)
+	case frontierOpSeen:
+		seen.Add(record.Key)
+	}
+}
+
+func (fs *frontierByFile) put(key string, req *base.Request) error {
+	preq := newPersistedRequest(req)
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.closed {
+		return errors.New("The frontier store has been closed!")
+	}
+	fs.seq++
+	fs.pending[key] = &pendingEntry{seq: fs.seq, req: preq}
+	return fs.appendRecord(frontierRecord{Op: frontierOpPut, Key: key, Req: preq})
+}
+
+func (fs *frontierByFile) done(key string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.closed {
+		return errors.New("The frontier store has been closed!")
+	}
+	if _, ok := fs.pending[key]; !ok {
+		return nil
+	}
+	delete(fs.pending, key)
+	return fs.appendRecord(frontierRecord{Op: frontierOpDone, Key: key})
+}
+
+func (fs *frontierByFile) seen(key string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.closed {
+		return errors.New("The frontier store has been closed!")
+	}
+	return fs.appendRecord(frontierRecord{Op: frontierOpSeen, Key: key})
+}
+
+func (fs *frontierByFile) snapshot(seen SeenSet) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.closed {
+		return errors.New("The frontier store has been closed!")
+	}
+	return fs.writeSnapshot(seen)
+}
+
+func (fs *frontierByFile) close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.closed {
+		return nil
+	}
+	fs.closed = true
+	if fs.logFile == nil {
+		return nil
+	}
+	return fs.logFile.Close()
+}
+
+var frontierSummaryTemplate = "dir: %s, pending: %d, logged: %d"
+
+func (fs *frontierByFile) summary() string {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fmt.Sprintf(frontierSummaryTemplate, fs.dir, len(fs.pending), fs.logged)
+}
+
+// 追加一条日志记录。调用方需持有互斥锁。
+func (fs *frontierByFile) appendRecord(record frontierRecord) error {
+	if fs.logFile == nil {
+		logFile, err := os.OpenFile(filepath.Join(fs.dir, FRONTIER_LOG_FILE),
+			os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		fs.logFile = logFile
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := fs.logFile.Write(line); err != nil {
+		return err
+	}
+	fs.logged++
+	return nil
+}
+
+// 写入快照并截断追加日志。调用方需持有互斥锁。
+// 快照会先被写入临时文件再被重命名，以保证快照文件总是完整的。
+func (fs *frontierByFile) writeSnapshot(seen SeenSet) error {
+	snapshot := frontierSnapshot{
+		Seeds:   fs.seeds,
+		Pending: make([]frontierRecord, 0, len(fs.pending)),
+	}
+	if seen != nil {
+		seenData, err := seen.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		snapshot.SeenSet = seenData
+	}
+	for _, entry := range fs.sortedPending() {
+		snapshot.Pending = append(snapshot.Pending,
+			frontierRecord{Op: frontierOpPut, Key: entry.key, Req: entry.req})
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	snapshotPath := filepath.Join(fs.dir, FRONTIER_SNAPSHOT_FILE)
+	tempPath := snapshotPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, snapshotPath); err != nil {
+		return err
+	}
+	if fs.logFile != nil {
+		fs.logFile.Close()
+		fs.logFile = nil
+	}
+	err = os.Truncate(filepath.Join(fs.dir, FRONTIER_LOG_FILE), 0)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fs.logged = 0
+	return nil
+}
+
+// 带有键的待处理请求的条目。
+type keyedPendingEntry struct {
+	key string
+	*pendingEntry
+}
+
+// 按照被放入的顺序获得待处理的请求。调用方需持有互斥锁。
+func (fs *frontierByFile) sortedPending() []keyedPendingEntry {
+	entries := make([]keyedPendingEntry, 0, len(fs.pending))
+	for key, entry := range fs.pending {
+		entries = append(entries, keyedPendingEntry{key: key, pendingEntry: entry})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+	return entries
+}
+
+// 创建被持久化的请求。
+func newPersistedRequest(req *base.Request) *persistedRequest {
+	httpReq := req.HttpReq()
+	return &persistedRequest{
+		Method:        httpReq.Method,
+		Url:           httpReq.URL.String(),
+		Header:        httpReq.Header,
+		Depth:         req.Depth(),
+		Attempts:      req.Attempts(),
+		MaxAttempts:   req.MaxAttempts(),
+		HeaderProfile: req.HeaderProfile(),
+		Body:          req.Body(),
+	}
+}
+
+// 还原请求。
+func (preq *persistedRequest) toRequest() (*base.Request, error) {
+	httpReq, err := http.NewRequest(preq.Method, preq.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range preq.Header {
+		httpReq.Header[k] = v
+	}
+	req := base.NewRequest(httpReq, preq.Depth)
+	req.SetMaxAttempts(preq.MaxAttempts)
+	req.SetHeaderProfile(preq.HeaderProfile)
+	if preq.Body != nil {
+		req.SetBody(preq.Body, "")
+	}
+	return req.WithAttempts(preq.Attempts), nil
+}
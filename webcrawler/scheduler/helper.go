@@ -1,15 +1,16 @@
 package scheduler
 
 import (
-	"errors"
 	"fmt"
-	"regexp"
+	"net/http"
 	"strings"
 	anlz "webcrawler/analyzer"
 	base "webcrawler/base"
 	dl "webcrawler/downloader"
 	ipl "webcrawler/itempipeline"
 	mdw "webcrawler/middleware"
+	"webcrawler/proxypool"
+	"webcrawler/session"
 )
 
 func generateChannelManager(channelArgs base.ChannelArgs) mdw.ChannelManager {
@@ -18,11 +19,12 @@ func generateChannelManager(channelArgs base.ChannelArgs) mdw.ChannelManager {
 
 func generatePageDownloaderPool(
 	poolSize uint32,
-	httpClientGenerator GenHttpClient) (dl.PageDownloaderPool, error) {
+	httpClientGenerator GenHttpClient,
+	middlewares []dl.DownloaderMiddleware) (dl.PageDownloaderPool, error) {
 	dlPool, err := dl.NewPageDownloaderPool(
 		poolSize,
 		func() dl.PageDownloader {
-			return dl.NewPageDownloader(httpClientGenerator())
+			return dl.NewPageDownloader(httpClientGenerator(), middlewares...)
 		},
 	)
 	if err != nil {
@@ -31,6 +33,39 @@ func generatePageDownloaderPool(
 	return dlPool, nil
 }
 
+// 生成经由代理池发送请求的HTTP客户端的生成函数。
+// 生成的HTTP客户端是原HTTP客户端的副本，只是其传输器被替换了。
+func generateProxiedHttpClient(
+	httpClientGenerator GenHttpClient,
+	pool proxypool.ProxyPool) (GenHttpClient, error) {
+	// 先行检查传输器的类型，以免在生成网页下载器时才发现问题。
+	if _, err := proxypool.NewTransport(pool, httpClientGenerator().Transport); err != nil {
+		return nil, err
+	}
+	return func() *http.Client {
+		client := *httpClientGenerator()
+		transport, err := proxypool.NewTransport(pool, client.Transport)
+		if err != nil {
+			// 生成函数返回的传输器的类型一般不会变化。
+			panic(err)
+		}
+		client.Transport = transport
+		return &client
+	}, nil
+}
+
+// 生成以会话管理器为Cookie容器的HTTP客户端的生成函数。
+// 生成的HTTP客户端是原HTTP客户端的副本，只是其Cookie容器被替换了。
+func generateSessionHttpClient(
+	httpClientGenerator GenHttpClient,
+	sessionManager session.SessionManager) GenHttpClient {
+	return func() *http.Client {
+		client := *httpClientGenerator()
+		client.Jar = sessionManager
+		return &client
+	}
+}
+
 func generateAnalyzerPool(poolSize uint32) (anlz.AnalyzerPool, error) {
 	analyzerPool, err := anlz.NewAnalyzerPool(
 		poolSize,
@@ -69,57 +104,3 @@ func parseCode(code string) []string {
 	result[1] = id
 	return result
 }
-
-var regexpForIp = regexp.MustCompile(`((?:(?:25[0-5]|2[0-4]\d|[01]?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|[01]?\d?\d))`)
-
-var regexpForDomains = []*regexp.Regexp{
-	// *.xx or *.xxx.xx
-	regexp.MustCompile(`\.(com|com\.\w{2})$`),
-	regexp.MustCompile(`\.(gov|gov\.\w{2})$`),
-	regexp.MustCompile(`\.(net|net\.\w{2})$`),
-	regexp.MustCompile(`\.(org|org\.\w{2})$`),
-	// *.xx
-	regexp.MustCompile(`\.me$`),
-	regexp.MustCompile(`\.biz$`),
-	regexp.MustCompile(`\.info$`),
-	regexp.MustCompile(`\.name$`),
-	regexp.MustCompile(`\.mobi$`),
-	regexp.MustCompile(`\.so$`),
-	regexp.MustCompile(`\.asia$`),
-	regexp.MustCompile(`\.tel$`),
-	regexp.MustCompile(`\.tv$`),
-	regexp.MustCompile(`\.cc$`),
-	regexp.MustCompile(`\.co$`),
-	regexp.MustCompile(`\.\w{2}$`),
-}
-
-func getPrimaryDomain(host string) (string, error) {
-	host = strings.TrimSpace(host)
-	if host == "" {
-		return "", errors.New("The host is empty!")
-	}
-	if regexpForIp.MatchString(host) {
-		return host, nil
-	}
-	var suffixIndex int
-	for _, re := range regexpForDomains {
-		pos := re.FindStringIndex(host)
-		if pos != nil {
-			suffixIndex = pos[0]
-			break
-		}
-	}
-	if suffixIndex > 0 {
-		var pdIndex int
-		firstPart := host[:suffixIndex]
-		index := strings.LastIndex(firstPart, ".")
-		if index < 0 {
-			pdIndex = 0
-		} else {
-			pdIndex = index + 1
-		}
-		return host[pdIndex:], nil
-	} else {
-		return "", errors.New("Unrecognized host!")
-	}
-}
@@ -0,0 +1,274 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	base "webcrawler/base"
+)
+
+// 礼貌性控制器的接口类型。
+// 它会按照队列键（主机名或IP地址）限制并发请求的数量以及相邻两次请求之间的最小间隔。
+type politeness interface {
+	// 获得请求所属队列的键。
+	queueKey(req *base.Request) string
+	// 判断队列当前是否可被调度。其签名与请求缓存所需的queueWait一致。
+	wait(queueKey string) (delay time.Duration, blocked bool)
+	// 记录一次针对队列的调度。参数req代表被调度的请求。
+	acquire(req *base.Request, queueKey string)
+	// 记录一次请求已处理完毕，并返回该请求被调度时所属队列的键。
+	// 该请求必须是曾被传给acquire方法的请求或其副本。
+	release(req *base.Request) string
+	// 设置某个主机的最小请求间隔。只有当其值大于默认的最小请求间隔时才会生效。
+	setHostDelay(host string, delay time.Duration)
+	// 获取摘要信息。
+	summary() string
+}
+
+// 主机名解析结果的有效期。
+const ipCacheTTL = 5 * time.Minute
+
+// 主机名解析失败之后重新解析的间隔。
+const ipRetryInterval = 30 * time.Second
+
+// 解析主机名的超时时间。
+const ipLookupTimeout = 5 * time.Second
+
+// 清理闲置的队列状态的间隔。
+const sweepInterval = time.Minute
+
+// 主机的最小请求间隔在最近一次被设置或使用之后的保留时间。
+const hostDelayTtl = time.Hour
+
+// 创建礼貌性控制器。
+// 参数maxInFlight代表每个队列的最大并发请求数量。其值为0时表示不限制。
+// 参数minDelay代表每个队列相邻两次请求之间的最小间隔。
+// 参数byIp表示是否按照IP地址（而不是主机名）划分队列。
+func newPoliteness(maxInFlight uint32, minDelay time.Duration, byIp bool) politeness {
+	return &myPoliteness{
+		maxInFlight: maxInFlight,
+		minDelay:    minDelay,
+		byIp:        byIp,
+		states:      make(map[string]*hostState),
+		hostDelays:  make(map[string]*hostDelay),
+		pinned:      make(map[*http.Request]string),
+		ipCache:     make(map[string]*ipEntry),
+	}
+}
+
+// 队列的状态。
+type hostState struct {
+	inFlight     uint32    // 正在处理的请求的数量。
+	lastDispatch time.Time // 最近一次调度的时间。
+}
+
+// 主机的最小请求间隔。
+type hostDelay struct {
+	delay    time.Duration // 最小请求间隔。
+	lastUsed time.Time     // 最近一次被设置或被调度使用的时间。
+}
+
+// 主机名的解析结果。
+type ipEntry struct {
+	ip         string        // IP地址。解析失败时为主机名本身。
+	expires    time.Time     // 过期的时间。
+	refreshing bool          // 是否正在后台重新解析。
+	done       chan struct{} // 首次解析完毕时被关闭的通道。首次解析完毕之后为nil。
+}
+
+// 礼貌性控制器的实现类型。
+type myPoliteness struct {
+	maxInFlight uint32                   // 每个队列的最大并发请求数量。
+	minDelay    time.Duration            // 每个队列的默认最小请求间隔。
+	byIp        bool                     // 是否按照IP地址划分队列。
+	states      map[string]*hostState    // 队列状态的字典。
+	hostDelays  map[string]*hostDelay    // 主机的最小请求间隔的字典。
+	pinned      map[*http.Request]string // 正在处理的请求与其被调度时所属队列的键的映射。
+	lastSweep   time.Time                // 最近一次清理的时间。
+	rwmutex     sync.RWMutex             // 读写锁。
+	ipCache     map[string]*ipEntry      // 主机名与其解析结果的映射。
+	ipMutex     sync.Mutex               // 针对ipCache的互斥锁。
+}
+
+func (pl *myPoliteness) queueKey(req *base.Request) string {
+	return pl.hostKey(req.HttpReq().URL.Hostname())
+}
+
+// 获得主机所属队列的键。
+// 按照IP地址划分队列时，主机名的解析结果会被缓存ipCacheTTL的时间。
+// 只有首次解析会阻塞调用方，且解析时不持有任何锁。过期的结果会在后台被重新解析，在此期间仍会使用旧的结果。
+func (pl *myPoliteness) hostKey(host string) string {
+	host = strings.ToLower(host)
+	if !pl.byIp || net.ParseIP(host) != nil {
+		return host
+	}
+	pl.ipMutex.Lock()
+	entry, ok := pl.ipCache[host]
+	if !ok {
+		entry = &ipEntry{ip: host, done: make(chan struct{})}
+		pl.ipCache[host] = entry
+		pl.ipMutex.Unlock()
+		pl.resolve(host, entry)
+		pl.ipMutex.Lock()
+	} else if entry.done != nil {
+		// 等待其他调用方的首次解析。
+		done := entry.done
+		pl.ipMutex.Unlock()
+		<-done
+		pl.ipMutex.Lock()
+	} else if !entry.refreshing && time.Now().After(entry.expires) {
+		entry.refreshing = true
+		go pl.resolve(host, entry)
+	}
+	ip := entry.ip
+	pl.ipMutex.Unlock()
+	return ip
+}
+
+// 解析主机名并更新其解析结果。解析失败时会保留之前的结果。
+func (pl *myPoliteness) resolve(host string, entry *ipEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), ipLookupTimeout)
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	cancel()
+	if err == nil && len(addrs) == 0 {
+		err = errors.New("no addresses")
+	}
+	if err != nil {
+		logger.Warnf("Can not resolve the host '%s': %s\n", host, err)
+	}
+	pl.ipMutex.Lock()
+	defer pl.ipMutex.Unlock()
+	if err == nil {
+		entry.ip = addrs[0].IP.String()
+		entry.expires = time.Now().Add(ipCacheTTL)
+	} else {
+		entry.expires = time.Now().Add(ipRetryInterval)
+	}
+	entry.refreshing = false
+	if entry.done != nil {
+		close(entry.done)
+		entry.done = nil
+	}
+}
+
+func (pl *myPoliteness) wait(queueKey string) (time.Duration, bool) {
+	pl.rwmutex.RLock()
+	defer pl.rwmutex.RUnlock()
+	state, ok := pl.states[queueKey]
+	if !ok {
+		return 0, false
+	}
+	if pl.maxInFlight > 0 && state.inFlight >= pl.maxInFlight {
+		return 0, true
+	}
+	if delay := pl.delay(queueKey) - time.Since(state.lastDispatch); delay > 0 {
+		return delay, false
+	}
+	return 0, false
+}
+
+// 获得队列的最小请求间隔。调用方需持有读锁。
+func (pl *myPoliteness) delay(queueKey string) time.Duration {
+	if hd, ok := pl.hostDelays[queueKey]; ok && hd.delay > pl.minDelay {
+		return hd.delay
+	}
+	return pl.minDelay
+}
+
+func (pl *myPoliteness) acquire(req *base.Request, queueKey string) {
+	pl.rwmutex.Lock()
+	defer pl.rwmutex.Unlock()
+	state, ok := pl.states[queueKey]
+	if !ok {
+		state = &hostState{}
+		pl.states[queueKey] = state
+	}
+	now := time.Now()
+	state.inFlight++
+	state.lastDispatch = now
+	if hd, ok := pl.hostDelays[queueKey]; ok {
+		hd.lastUsed = now
+	}
+	// 主机名的解析结果可能在请求处理完毕之前改变，因此要记下被调度时的队列键。
+	pl.pinned[req.HttpReq()] = queueKey
+	if now.Sub(pl.lastSweep) >= sweepInterval {
+		pl.lastSweep = now
+		pl.sweep(now)
+	}
+}
+
+// 清理闲置的队列状态、主机的最小请求间隔以及主机名的解析结果。调用方需持有写锁。
+// 没有正在处理的请求且已过最小请求间隔的队列的状态会被清除。
+// 没有队列状态且在hostDelayTtl内未被设置或使用的最小请求间隔会被清除。
+// 过期之后在ipCacheTTL内未被使用的解析结果会被清除。
+func (pl *myPoliteness) sweep(now time.Time) {
+	for queueKey, state := range pl.states {
+		if state.inFlight == 0 && now.Sub(state.lastDispatch) >= pl.delay(queueKey) {
+			delete(pl.states, queueKey)
+		}
+	}
+	for queueKey, hd := range pl.hostDelays {
+		if _, ok := pl.states[queueKey]; !ok && now.Sub(hd.lastUsed) >= hostDelayTtl {
+			delete(pl.hostDelays, queueKey)
+		}
+	}
+	pl.ipMutex.Lock()
+	defer pl.ipMutex.Unlock()
+	for host, entry := range pl.ipCache {
+		if entry.done == nil && !entry.refreshing && now.Sub(entry.expires) >= ipCacheTTL {
+			delete(pl.ipCache, host)
+		}
+	}
+}
+
+func (pl *myPoliteness) release(req *base.Request) string {
+	pl.rwmutex.Lock()
+	defer pl.rwmutex.Unlock()
+	queueKey, ok := pl.pinned[req.HttpReq()]
+	if !ok {
+		return ""
+	}
+	delete(pl.pinned, req.HttpReq())
+	state, ok := pl.states[queueKey]
+	if !ok || state.inFlight == 0 {
+		return queueKey
+	}
+	state.inFlight--
+	// 没有正在处理的请求且已过最小请求间隔的队列的状态无需保留。
+	if state.inFlight == 0 && time.Since(state.lastDispatch) >= pl.delay(queueKey) {
+		delete(pl.states, queueKey)
+	}
+	return queueKey
+}
+
+func (pl *myPoliteness) setHostDelay(host string, delay time.Duration) {
+	queueKey := pl.hostKey(host)
+	pl.rwmutex.Lock()
+	defer pl.rwmutex.Unlock()
+	pl.hostDelays[queueKey] = &hostDelay{delay: delay, lastUsed: time.Now()}
+}
+
+var politenessSummaryTemplate = "maxInFlight: %d, minDelay: %s, byIp: %v, " +
+	"activeQueues: %d, inFlight: %d, waitingQueues: %d"
+
+func (pl *myPoliteness) summary() string {
+	pl.rwmutex.RLock()
+	defer pl.rwmutex.RUnlock()
+	var inFlight uint32
+	var waiting int
+	for queueKey, state := range pl.states {
+		inFlight += state.inFlight
+		if (pl.maxInFlight > 0 && state.inFlight >= pl.maxInFlight) ||
+			time.Since(state.lastDispatch) < pl.delay(queueKey) {
+			waiting++
+		}
+	}
+	return fmt.Sprintf(politenessSummaryTemplate,
+		pl.maxInFlight, pl.minDelay, pl.byIp,
+		len(pl.states), inFlight, waiting)
+}
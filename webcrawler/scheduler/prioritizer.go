@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	base "webcrawler/base"
+)
+
+// 请求优先级计算器的接口类型。
+// 调度器在把请求放入请求缓存时会通过它计算请求的优先级。
+// 优先级的值越大，请求就越早被调度。优先级相同的请求会按照先进先出的顺序被调度。
+type Prioritizer interface {
+	// 计算请求的优先级。
+	Priority(req *base.Request) float64
+}
+
+// 创建广度优先的请求优先级计算器。深度越小的请求越优先。
+func NewBfsPrioritizer() Prioritizer {
+	return &bfsPrioritizer{}
+}
+
+// 广度优先的请求优先级计算器的实现类型。
+type bfsPrioritizer struct{}
+
+func (p *bfsPrioritizer) Priority(req *base.Request) float64 {
+	return -float64(req.Depth())
+}
+
+// 创建深度优先的请求优先级计算器。深度越大的请求越优先。
+func NewDfsPrioritizer() Prioritizer {
+	return &dfsPrioritizer{}
+}
+
+// 深度优先的请求优先级计算器的实现类型。
+type dfsPrioritizer struct{}
+
+func (p *dfsPrioritizer) Priority(req *base.Request) float64 {
+	return float64(req.Depth())
+}
+
+// 创建按深度加权的请求优先级计算器。
+// 请求的优先级等于参数inner计算出的优先级减去深度与参数weight的乘积。
+// 参数inner可以为nil，此时其计算出的优先级被视为0。
+func NewDepthWeightedPrioritizer(inner Prioritizer, weight float64) Prioritizer {
+	return &depthWeightedPrioritizer{inner: inner, weight: weight}
+}
+
+// 按深度加权的请求优先级计算器的实现类型。
+type depthWeightedPrioritizer struct {
+	inner  Prioritizer // 内部的请求优先级计算器。
+	weight float64     // 深度的权重。
+}
+
+func (p *depthWeightedPrioritizer) Priority(req *base.Request) float64 {
+	var priority float64
+	if p.inner != nil {
+		priority = p.inner.Priority(req)
+	}
+	return priority - p.weight*float64(req.Depth())
+}
+
+// 创建基于正则表达式评分的请求优先级计算器。
+// 参数scores的键为针对请求URL的正则表达式，值为与之对应的分数。
+// 请求的优先级等于其URL所匹配的所有正则表达式的分数之和。
+// 若URL未匹配任何正则表达式，则其优先级为参数defaultScore的值。
+func NewRegexScorePrioritizer(
+	scores map[string]float64,
+	defaultScore float64) (Prioritizer, error) {
+	if len(scores) == 0 {
+		return nil, errors.New("The regex score list is empty!")
+	}
+	rules := make([]regexScore, 0, len(scores))
+	for expr, score := range scores {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			errMsg := fmt.Sprintf("Invalid regex '%s': %s", expr, err)
+			return nil, errors.New(errMsg)
+		}
+		rules = append(rules, regexScore{re: re, score: score})
+	}
+	return &regexScorePrioritizer{rules: rules, defaultScore: defaultScore}, nil
+}
+
+// 正则表达式及其分数。
+type regexScore struct {
+	re    *regexp.Regexp // 正则表达式。
+	score float64        // 分数。
+}
+
+// 基于正则表达式评分的请求优先级计算器的实现类型。
+type regexScorePrioritizer struct {
+	rules        []regexScore // 正则表达式及其分数的列表。
+	defaultScore float64      // 默认分数。
+}
+
+func (p *regexScorePrioritizer) Priority(req *base.Request) float64 {
+	reqUrl := req.HttpReq().URL.String()
+	var priority float64
+	matched := false
+	for _, rule := range p.rules {
+		if rule.re.MatchString(reqUrl) {
+			priority += rule.score
+			matched = true
+		}
+	}
+	if !matched {
+		return p.defaultScore
+	}
+	return priority
+}
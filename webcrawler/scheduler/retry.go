@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+	base "webcrawler/base"
+)
+
+// 重试计时器。它会在等待时间过后执行重试，并记录重试的计数。
+type retryTimer struct {
+	pending   int64  // 正在等待的重试的数量。
+	scheduled uint64 // 已安排的重试的数量。
+	exhausted uint64 // 因达到最大尝试次数而放弃重试的请求的数量。
+}
+
+// 创建重试计时器。
+func newRetryTimer() *retryTimer {
+	return &retryTimer{}
+}
+
+// 安排一次重试。参数retry会在参数delay代表的时间过后被执行。
+func (rt *retryTimer) schedule(delay time.Duration, retry func()) {
+	atomic.AddInt64(&rt.pending, 1)
+	atomic.AddUint64(&rt.scheduled, 1)
+	time.AfterFunc(delay, func() {
+		defer atomic.AddInt64(&rt.pending, -1)
+		retry()
+	})
+}
+
+// 记录一次放弃的重试。
+func (rt *retryTimer) exhaust() {
+	atomic.AddUint64(&rt.exhausted, 1)
+}
+
+// 获得正在等待的重试的数量。
+func (rt *retryTimer) pendingNumber() int64 {
+	return atomic.LoadInt64(&rt.pending)
+}
+
+var retryTimerSummaryTemplate = "pending: %d, scheduled: %d, exhausted: %d"
+
+// 获取摘要信息。
+func (rt *retryTimer) summary() string {
+	return fmt.Sprintf(retryTimerSummaryTemplate,
+		rt.pendingNumber(),
+		atomic.LoadUint64(&rt.scheduled),
+		atomic.LoadUint64(&rt.exhausted))
+}
+
+// 若下载的结果需要被重试，则安排重试并返回true。
+// 需要重试的请求会在等待时间过后被重新放入请求缓存，且不会再经过过滤和去重。
+// 在此期间，它在爬取边界中仍然是待处理的。
+func (sched *myScheduler) retryIfNeeded(req base.Request, respp *base.Response, err error) bool {
+	policy := sched.schedArgs.RetryPolicy()
+	if policy == nil || sched.ctx.Err() != nil {
+		return false
+	}
+	var httpResp *http.Response
+	if respp != nil {
+		httpResp = respp.HttpResp()
+	}
+	if !policy.ShouldRetry(httpResp, err) {
+		return false
+	}
+	attempts := req.Attempts() + 1
+	maxAttempts := req.MaxAttempts()
+	if maxAttempts == 0 {
+		maxAttempts = policy.MaxAttempts()
+	}
+	reqUrl := req.HttpReq().URL
+	if attempts >= maxAttempts {
+		logger.Warnf("Give up retrying the request after %d attempts. (requestUrl=%s)\n",
+			attempts, reqUrl)
+		sched.retries.exhaust()
+		return false
+	}
+	delay := policy.Backoff(attempts, httpResp)
+	var reason string
+	if err != nil {
+		reason = err.Error()
+	} else {
+		reason = fmt.Sprintf("status code %d", httpResp.StatusCode)
+	}
+	// 被重试的下载的响应（包括伴随着错误的响应）不会被分析，其响应体需要在此被关闭。
+	if httpResp != nil && httpResp.Body != nil {
+		httpResp.Body.Close()
+	}
+	logger.Warnf("Retry the request in %s: %s (attempt=%d/%d, requestUrl=%s)\n",
+		delay, reason, attempts, maxAttempts, reqUrl)
+	retryReq := req.WithAttempts(attempts)
+	sched.retries.schedule(delay, func() {
+		if sched.stopSign.Signed() {
+			sched.stopSign.Deal(SCHEDULER_CODE)
+			return
+		}
+		sched.putReqToCache(retryReq)
+	})
+	return true
+}
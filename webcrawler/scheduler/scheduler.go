@@ -1,10 +1,12 @@
 package scheduler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"net/url"
+	"sync"
 	"sync/atomic"
 	"time"
 	anlz "webcrawler/analyzer"
@@ -12,6 +14,7 @@ import (
 	dl "webcrawler/downloader"
 	ipl "webcrawler/itempipeline"
 	mdw "webcrawler/middleware"
+	"webcrawler/robots"
 	"github.com/Sirupsen/logrus"
 )
 
@@ -21,6 +24,7 @@ const (
 	ANALYZER_CODE     = "analyzer"
 	ITEMPIPELINE_CODE = "item_pipeline"
 	SCHEDULER_CODE    = "scheduler"
+	ROBOTS_CODE       = "robots"
 )
 
 // 日志记录器。
@@ -35,26 +39,72 @@ type Scheduler interface {
 	// 调用该方法会使调度器创建和初始化各个组件。在此之后，调度器会激活爬取流程的执行。
 	// 参数channelArgs代表通道参数的容器。
 	// 参数poolBaseArgs代表池基本参数的容器。
+	// 参数schedArgs代表调度器参数的容器。
 	// 参数crawlDepth代表了需要被爬取的网页的最大深度值。深度大于此值的网页会被忽略。
 	// 参数httpClientGenerator代表的是被用来生成HTTP客户端的函数。
 	// 参数respParsers的值应为分析器所需的被用来解析HTTP响应的函数的序列。
 	// 参数itemProcessors的值应为需要被置入条目处理管道中的条目处理器的序列。
-	// 参数firstHttpReq即代表首次请求。调度器会以此为起始点开始执行爬取流程。
+	// 参数reqFilters的值应为请求过滤器的序列。若其值为nil，则只有与某个种子请求同域的请求才会被接受。
+	// 参数seedHttpReqs代表种子请求（即首次请求）的序列。调度器会以它们为起始点开始执行爬取流程。
+	// 种子请求的深度均为0。它们不会被请求过滤器过滤，但重复的以及被robots.txt禁止访问的种子请求会被忽略。
 	Start(channelArgs base.ChannelArgs,
 		poolBaseArgs base.PoolBaseArgs,
+		schedArgs SchedArgs,
 		crawlDepth uint32,
 		httpClientGenerator GenHttpClient,
 		respParsers []anlz.ParseResponse,
 		itemProcessors []ipl.ProcessItem,
-		firstHttpReq *http.Request) (err error)
+		reqFilters []RequestFilter,
+		seedHttpReqs []*http.Request) (err error)
+	// 从持久化目录中恢复爬取流程。
+	// 调度器会重新加载目录中待处理的请求（包括其深度）和已请求的URL，并从中断之处继续爬取。
+	// 参数dir代表爬取边界的持久化目录。它会覆盖参数schedArgs中的相应设置。
+	// 其余参数的含义与Start方法的同名参数相同。
+	ResumeFrom(dir string,
+		channelArgs base.ChannelArgs,
+		poolBaseArgs base.PoolBaseArgs,
+		schedArgs SchedArgs,
+		crawlDepth uint32,
+		httpClientGenerator GenHttpClient,
+		respParsers []anlz.ParseResponse,
+		itemProcessors []ipl.ProcessItem,
+		reqFilters []RequestFilter) (err error)
+	// 向正在运行的调度器注入请求。
+	// 被注入的请求与分析器得出的请求一样，会经过协议、深度、请求过滤器、robots.txt以及去重的检查。
+	// 未通过检查的请求会被忽略，并被计入摘要信息中的拒绝原因。
+	// 若调度器未在运行或参数中含有无效的请求，则返回非nil的错误值。此时不会有任何请求被注入。
+	AddRequests(reqs ...*base.Request) error
+	// 暂停调度器。
+	// 调度器会停止从请求缓存中调度请求，但已被调度的请求的下载、分析和条目处理会继续进行直至完成。
+	// 在暂停期间产生或被注入的请求会被照常放入请求缓存。
+	// 若调度器未在运行，则返回false。
+	Pause() bool
+	// 恢复被暂停的调度器。调度器会使用原有的请求缓存、爬取边界和已请求URL集合继续调度。
+	// 若调度器未被暂停，则返回false。
+	Resume() bool
 	// 调用该方法会停止调度器的运行。所有处理模块执行的流程都会被中止。
+	// 被暂停的调度器也可以被停止。该方法相当于以一个已被取消的上下文调用Shutdown方法。
 	Stop() bool
-	// 判断调度器是否正在运行。
+	// 运行调度器直至参数ctx被取消。该方法需在调度器被开启之后调用，且会一直阻塞。
+	// 参数ctx被取消后，该方法会以调度器参数中的关闭超时时间调用Shutdown方法，并返回其结果。
+	// 若调度器在此之前已被停止，则返回nil。
+	Run(ctx context.Context) error
+	// 优雅地关闭调度器。
+	// 调度器会立即停止调度新的请求，并等待已被调度的请求的下载、分析和条目处理完成。
+	// 若参数ctx在此之前被取消，则进行中的工作也会被取消，且结果值为ctx.Err()。
+	// 无论如何，通道都只会在这之后被关闭。
+	// 若调度器未在运行（包括已被暂停），则返回非nil的错误值。
+	Shutdown(ctx context.Context) error
+	// 判断调度器是否正在运行。被暂停的调度器不算正在运行。
 	Running() bool
+	// 判断调度器是否已被暂停。
+	Paused() bool
 	// 获得错误通道。调度器以及各个处理模块运行过程中出现的所有错误都会被发送到该通道。
 	// 若该方法的结果值为nil，则说明错误通道不可用或调度器已被停止。
 	ErrorChan() <-chan error
 	// 判断所有处理模块是否都处于空闲状态。
+	// 被暂停的调度器、请求缓存不为空的调度器以及有请求正在等待重试的调度器
+	// 总是被视为非空闲的，因为其爬取流程尚未结束。
 	Idle() bool
 	// 获取摘要信息。
 	Summary(prefix string) SchedSummary
@@ -67,28 +117,46 @@ func NewScheduler() Scheduler {
 
 // 调度器的实现类型。
 type myScheduler struct {
-	channelArgs   base.ChannelArgs      // 通道参数的容器。
-	poolBaseArgs  base.PoolBaseArgs     // 池基本参数的容器。
-	crawlDepth    uint32                // 爬取的最大深度。首次请求的深度为0。
-	primaryDomain string                // 主域名。
-	chanman       mdw.ChannelManager    // 通道管理器。
-	stopSign      mdw.StopSign          // 停止信号。
-	dlpool        dl.PageDownloaderPool // 网页下载器池。
-	analyzerPool  anlz.AnalyzerPool     // 分析器池。
-	itemPipeline  ipl.ItemPipeline      // 条目处理管道。
-	reqCache      requestCache          // 请求缓存。
-	urlMap        map[string]bool       // 已请求的URL的字典。
-	running       uint32                // 运行标记。0表示未运行，1表示已运行，2表示已停止。
+	channelArgs  base.ChannelArgs          // 通道参数的容器。
+	poolBaseArgs base.PoolBaseArgs         // 池基本参数的容器。
+	schedArgs    SchedArgs                 // 调度器参数的容器。
+	crawlDepth   uint32                    // 爬取的最大深度。首次请求的深度为0。
+	reqFilters   []RequestFilter           // 请求过滤器的序列。
+	rejects      *rejectCounter            // 请求拒绝原因的计数器。
+	chanman      mdw.ChannelManager        // 通道管理器。
+	stopSign     mdw.StopSign              // 停止信号。
+	dlpool       dl.PageDownloaderPool     // 网页下载器池。
+	analyzerPool anlz.AnalyzerPool         // 分析器池。
+	itemPipeline ipl.ItemPipeline          // 条目处理管道。
+	reqCache     requestCache              // 请求缓存。
+	politeness   politeness                // 礼貌性控制器。
+	robots       robots.RobotsCache        // robots.txt缓存。若不遵守robots.txt则为nil。
+	seen         SeenSet                   // 已请求的URL的集合。
+	frontier     frontierStore             // 爬取边界存储。若未开启持久化则为nil。
+	respKeys     map[*http.Response]string // 等待分析的响应与其请求的键的映射。只在开启持久化时被使用。
+	respMutex    sync.Mutex                // 针对respKeys的互斥锁。
+	retries      *retryTimer               // 重试计时器。
+	transfer     *dl.TransferStats         // 传输统计。
+	loginClient  *http.Client              // 会话登录时使用的HTTP客户端。若未使用会话管理器则为nil。
+	running      uint32                    // 运行标记。0表示未运行，1表示已运行，2表示已停止，3表示已暂停，4表示正在停止。
+	ctx          context.Context           // 工作上下文。它会被传给下载器、分析器和条目处理管道。
+	cancel       context.CancelFunc        // 工作上下文的取消函数。
+	inFlight     *sync.WaitGroup           // 进行中的工作（已被发送到通道但尚未处理完毕的请求、响应和条目）的计数。
+	chanMutex    sync.RWMutex              // 针对通道发送与关闭的读写锁。
+	scheduleDone chan struct{}             // 调度循环结束的通知通道。
+	stopped      chan struct{}             // 调度器已停止的通知通道。
 }
 
 func (sched *myScheduler) Start(
 	channelArgs base.ChannelArgs,
 	poolBaseArgs base.PoolBaseArgs,
+	schedArgs SchedArgs,
 	crawlDepth uint32,
 	httpClientGenerator GenHttpClient,
 	respParsers []anlz.ParseResponse,
 	itemProcessors []ipl.ProcessItem,
-	firstHttpReq *http.Request) (err error) {
+	reqFilters []RequestFilter,
+	seedHttpReqs []*http.Request) (err error) {
 	defer func() {
 		if p := recover(); p != nil {
 			errMsg := fmt.Sprintf("Fatal Scheduler Error: %s\n", p)
@@ -96,11 +164,129 @@ func (sched *myScheduler) Start(
 			err = errors.New(errMsg)
 		}
 	}()
-	if atomic.LoadUint32(&sched.running) == 1 {
+	if sched.active() || atomic.LoadUint32(&sched.running) == 4 {
 		return errors.New("The scheduler has been started!\n")
 	}
 	atomic.StoreUint32(&sched.running, 1)
 
+	if err := sched.init(channelArgs, poolBaseArgs, schedArgs, crawlDepth,
+		httpClientGenerator, itemProcessors); err != nil {
+		return err
+	}
+	if len(seedHttpReqs) == 0 {
+		return errors.New("The seed HTTP request list is empty!")
+	}
+	seedUrls := make([]*url.URL, 0, len(seedHttpReqs))
+	for i, seedHttpReq := range seedHttpReqs {
+		if seedHttpReq == nil || seedHttpReq.URL == nil {
+			return errors.New(fmt.Sprintf("The %dth seed HTTP request is invalid!", i))
+		}
+		seedUrls = append(seedUrls, seedHttpReq.URL)
+	}
+	if err := sched.setReqFilters(reqFilters, seedUrls); err != nil {
+		return err
+	}
+	if sched.schedArgs.FrontierDir() != "" {
+		frontier, err := newFrontierStore(sched.schedArgs.FrontierDir())
+		if err != nil {
+			return err
+		}
+		seeds := make([]string, 0, len(seedUrls))
+		for _, seedUrl := range seedUrls {
+			seeds = append(seeds, seedUrl.String())
+		}
+		if err := frontier.reset(seeds); err != nil {
+			return err
+		}
+		sched.frontier = frontier
+	}
+	sched.activate(respParsers)
+
+	for _, seedHttpReq := range seedHttpReqs {
+		seedReq := base.NewRequest(seedHttpReq, 0)
+		if !sched.allowedByRobots(seedHttpReq.URL) {
+			continue
+		}
+		if !sched.markSeen(seedReq) {
+			logger.Warnf("Ignore the seed request! It's url is repeated. (requestUrl=%s)\n",
+				seedHttpReq.URL)
+			continue
+		}
+		sched.putReqToCache(seedReq)
+	}
+
+	return nil
+}
+
+func (sched *myScheduler) ResumeFrom(
+	dir string,
+	channelArgs base.ChannelArgs,
+	poolBaseArgs base.PoolBaseArgs,
+	schedArgs SchedArgs,
+	crawlDepth uint32,
+	httpClientGenerator GenHttpClient,
+	respParsers []anlz.ParseResponse,
+	itemProcessors []ipl.ProcessItem,
+	reqFilters []RequestFilter) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			errMsg := fmt.Sprintf("Fatal Scheduler Error: %s\n", p)
+			logger.Fatal(errMsg)
+			err = errors.New(errMsg)
+		}
+	}()
+	if sched.active() || atomic.LoadUint32(&sched.running) == 4 {
+		return errors.New("The scheduler has been started!\n")
+	}
+	atomic.StoreUint32(&sched.running, 1)
+
+	schedArgs.SetFrontierDir(dir)
+	if err := sched.init(channelArgs, poolBaseArgs, schedArgs, crawlDepth,
+		httpClientGenerator, itemProcessors); err != nil {
+		return err
+	}
+	frontier, err := newFrontierStore(dir)
+	if err != nil {
+		return err
+	}
+	seeds, pending, err := frontier.load(sched.seen)
+	if err != nil {
+		return err
+	}
+	if len(seeds) == 0 {
+		return errors.New("The seed HTTP requests are missing in the frontier!")
+	}
+	seedUrls := make([]*url.URL, 0, len(seeds))
+	for _, seed := range seeds {
+		seedUrl, err := url.Parse(seed)
+		if err != nil {
+			return err
+		}
+		seedUrls = append(seedUrls, seedUrl)
+	}
+	if err := sched.setReqFilters(reqFilters, seedUrls); err != nil {
+		return err
+	}
+	// 待处理的请求已被记录在爬取边界存储中，因此直接放入请求缓存即可。
+	for _, req := range pending {
+		sched.assignHeaderProfile(req)
+		sched.reqCache.put(req, sched.priority(req))
+	}
+	sched.frontier = frontier
+	sched.activate(respParsers)
+	logger.Infof("Resume the crawl from %s. (pending=%d, seen=%d)\n",
+		dir, len(pending), sched.seen.Count())
+	return nil
+}
+
+// 检查参数并创建和初始化各个组件。
+func (sched *myScheduler) init(
+	channelArgs base.ChannelArgs,
+	poolBaseArgs base.PoolBaseArgs,
+	schedArgs SchedArgs,
+	crawlDepth uint32,
+	httpClientGenerator GenHttpClient,
+	itemProcessors []ipl.ProcessItem) error {
 	if err := channelArgs.Check(); err != nil {
 		return err
 	}
@@ -109,16 +295,36 @@ func (sched *myScheduler) Start(
 		return err
 	}
 	sched.poolBaseArgs = poolBaseArgs
+	if err := schedArgs.Check(); err != nil {
+		return err
+	}
+	sched.schedArgs = schedArgs
 	sched.crawlDepth = crawlDepth
 
 	sched.chanman = generateChannelManager(sched.channelArgs)
+	sched.transfer = dl.NewTransferStats()
 	if httpClientGenerator == nil {
 		return errors.New("The HTTP client generator list is invalid!")
 	}
+	if pool := sched.schedArgs.ProxyPool(); pool != nil {
+		proxiedHttpClientGenerator, err := generateProxiedHttpClient(httpClientGenerator, pool)
+		if err != nil {
+			errMsg :=
+				fmt.Sprintf("Occur error when apply proxy pool: %s\n", err)
+			return errors.New(errMsg)
+		}
+		httpClientGenerator = proxiedHttpClientGenerator
+	}
+	sched.loginClient = nil
+	if sessionManager := sched.schedArgs.SessionManager(); sessionManager != nil {
+		httpClientGenerator = generateSessionHttpClient(httpClientGenerator, sessionManager)
+		sched.loginClient = httpClientGenerator()
+	}
 	dlpool, err :=
 		generatePageDownloaderPool(
 			sched.poolBaseArgs.PageDownloaderPoolSize(),
-			httpClientGenerator)
+			httpClientGenerator,
+			sched.schedArgs.effectiveMiddlewares(sched.transfer))
 	if err != nil {
 		errMsg :=
 			fmt.Sprintf("Occur error when get page downloader pool: %s\n", err)
@@ -149,44 +355,209 @@ func (sched *myScheduler) Start(
 		sched.stopSign.Reset()
 	}
 
-	sched.reqCache = newRequestCache()
-	sched.urlMap = make(map[string]bool)
+	sched.politeness = newPoliteness(
+		sched.schedArgs.HostMaxInFlight(),
+		sched.schedArgs.HostMinDelay(),
+		sched.schedArgs.PolitenessByIp())
+	sched.reqCache = newRequestCache(sched.politeness.queueKey)
+	sched.robots = nil
+	if sched.schedArgs.ObeyRobots() {
+		sched.robots = robots.NewRobotsCache(
+			httpClientGenerator(),
+			sched.schedArgs.RobotsUserAgent(),
+			sched.schedArgs.RobotsTtl())
+	}
+	sched.seen = sched.schedArgs.SeenSetGenerator()()
+	if sched.seen == nil {
+		return errors.New("The generated seen set is invalid!")
+	}
+	sched.rejects = newRejectCounter()
+	sched.retries = newRetryTimer()
+	sched.frontier = nil
+	sched.respKeys = make(map[*http.Response]string)
+	sched.ctx, sched.cancel = context.WithCancel(context.Background())
+	sched.inFlight = &sync.WaitGroup{}
+	sched.scheduleDone = make(chan struct{})
+	sched.stopped = make(chan struct{})
+	return nil
+}
+
+// 设置请求过滤器的序列。
+// 若参数reqFilters的值为nil，则使用只接受与某个种子请求同域的请求的过滤器。
+func (sched *myScheduler) setReqFilters(reqFilters []RequestFilter, seedUrls []*url.URL) error {
+	for i, filter := range reqFilters {
+		if filter == nil {
+			return errors.New(fmt.Sprintf("The %dth request filter is invalid!", i))
+		}
+	}
+	if reqFilters == nil {
+		hosts := make([]string, 0, len(seedUrls))
+		for _, seedUrl := range seedUrls {
+			hosts = append(hosts, seedUrl.Host)
+		}
+		reqFilters = []RequestFilter{NewSameDomainFilter(hosts...)}
+	}
+	sched.reqFilters = reqFilters
+	return nil
+}
 
+// 激活爬取流程。
+func (sched *myScheduler) activate(respParsers []anlz.ParseResponse) {
 	sched.startDownloading()
 	sched.activateAnalyzers(respParsers)
 	sched.openItemPipeline()
 	sched.schedule(10 * time.Millisecond)
+	if sched.frontier != nil {
+		sched.persistFrontier(sched.schedArgs.SnapshotInterval())
+	}
+}
 
-	if firstHttpReq == nil {
-		return errors.New("The first HTTP request is invalid!")
+func (sched *myScheduler) AddRequests(reqs ...*base.Request) error {
+	if !sched.active() {
+		return errors.New("The scheduler is not running!")
 	}
-	pd, err := getPrimaryDomain(firstHttpReq.Host)
-	if err != nil {
-		return err
+	for i, req := range reqs {
+		if req == nil || !req.Valid() {
+			return errors.New(fmt.Sprintf("The %dth request is invalid!", i))
+		}
 	}
-	sched.primaryDomain = pd
+	for _, req := range reqs {
+		sched.saveReqToCache(*req, SCHEDULER_CODE)
+	}
+	return nil
+}
 
-	firstReq := base.NewRequest(firstHttpReq, 0)
-	sched.reqCache.put(firstReq)
+func (sched *myScheduler) Pause() bool {
+	if !atomic.CompareAndSwapUint32(&sched.running, 1, 3) {
+		return false
+	}
+	logger.Infoln("The scheduler has been paused.")
+	return true
+}
 
-	return nil
+func (sched *myScheduler) Resume() bool {
+	if !atomic.CompareAndSwapUint32(&sched.running, 3, 1) {
+		return false
+	}
+	logger.Infoln("The scheduler has been resumed.")
+	return true
 }
 
 func (sched *myScheduler) Stop() bool {
-	if atomic.LoadUint32(&sched.running) != 1 {
-		return false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stopped, _ := sched.shutdown(ctx)
+	return stopped
+}
+
+func (sched *myScheduler) Run(ctx context.Context) error {
+	if !sched.active() {
+		return errors.New("The scheduler is not running!")
+	}
+	select {
+	case <-ctx.Done():
+	case <-sched.stopped:
+		return nil
+	}
+	shutdownCtx, cancel :=
+		context.WithTimeout(context.Background(), sched.schedArgs.ShutdownTimeout())
+	defer cancel()
+	return sched.Shutdown(shutdownCtx)
+}
+
+func (sched *myScheduler) Shutdown(ctx context.Context) error {
+	stopped, err := sched.shutdown(ctx)
+	if !stopped {
+		return errors.New("The scheduler is not running!")
+	}
+	if err != nil {
+		logger.Warnf("The in-flight work has been cancelled: %s\n", err)
+	}
+	return err
+}
+
+// 关闭调度器。若调度器未在运行，则结果值stopped为false。
+// 若进行中的工作未能在参数ctx被取消之前完成，则结果值err为ctx.Err()。
+func (sched *myScheduler) shutdown(ctx context.Context) (stopped bool, err error) {
+	for {
+		running := atomic.LoadUint32(&sched.running)
+		if running == 4 {
+			// 已有其他的关闭操作在进行中，促使其尽快完成。
+			sched.cancel()
+			return false, nil
+		}
+		if running != 1 && running != 3 {
+			return false, nil
+		}
+		if atomic.CompareAndSwapUint32(&sched.running, running, 4) {
+			break
+		}
 	}
+	// 停止调度新的请求。
 	sched.stopSign.Sign()
+	select {
+	case <-sched.scheduleDone:
+	case <-ctx.Done():
+	case <-sched.ctx.Done():
+	}
+	// 等待进行中的工作完成。调度循环结束后，进行中的工作的计数只会在其不为0时增加。
+	if ctx.Err() == nil && sched.ctx.Err() == nil {
+		drained := make(chan struct{})
+		go func() {
+			sched.inFlight.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+		case <-sched.ctx.Done():
+		}
+	}
+	err = ctx.Err()
+	// 取消进行中的工作，并使阻塞在通道上的发送操作放弃发送，然后才关闭通道。
+	sched.cancel()
+	sched.chanMutex.Lock()
 	sched.chanman.Close()
+	sched.chanMutex.Unlock()
 	sched.reqCache.close()
+	if sched.frontier != nil {
+		if err := sched.frontier.snapshot(sched.seen); err != nil {
+			logger.Errorf("Frontier snapshot error: %s\n", err)
+		}
+		sched.frontier.close()
+	}
+	if warcWriter := sched.schedArgs.WarcWriter(); warcWriter != nil {
+		if err := warcWriter.Close(); err != nil {
+			logger.Errorf("WARC writer closing error: %s\n", err)
+		}
+	}
+	if pool := sched.schedArgs.ProxyPool(); pool != nil {
+		pool.Close()
+	}
+	if sessionManager := sched.schedArgs.SessionManager(); sessionManager != nil {
+		if err := sessionManager.Save(); err != nil {
+			logger.Errorf("Session saving error: %s\n", err)
+		}
+	}
 	atomic.StoreUint32(&sched.running, 2)
-	return true
+	close(sched.stopped)
+	return true, err
 }
 
 func (sched *myScheduler) Running() bool {
 	return atomic.LoadUint32(&sched.running) == 1
 }
 
+func (sched *myScheduler) Paused() bool {
+	return atomic.LoadUint32(&sched.running) == 3
+}
+
+// 判断调度器是否处于已运行或已暂停的状态。
+func (sched *myScheduler) active() bool {
+	running := atomic.LoadUint32(&sched.running)
+	return running == 1 || running == 3
+}
+
 func (sched *myScheduler) ErrorChan() <-chan error {
 	if sched.chanman.Status() != mdw.CHANNEL_MANAGER_STATUS_INITIALIZED {
 		return nil
@@ -195,10 +566,16 @@ func (sched *myScheduler) ErrorChan() <-chan error {
 }
 
 func (sched *myScheduler) Idle() bool {
+	if sched.Paused() {
+		return false
+	}
 	idleDlPool := sched.dlpool.Used() == 0
 	idleAnalyzerPool := sched.analyzerPool.Used() == 0
 	idleItemPipeline := sched.itemPipeline.ProcessingNumber() == 0
-	if idleDlPool && idleAnalyzerPool && idleItemPipeline {
+	// 请求缓存中的请求（例如因礼貌性限制而正在等待的请求）和正在等待重试的请求
+	// 都意味着爬取流程尚未结束。
+	idleReqCache := sched.reqCache.length() == 0 && sched.retries.pendingNumber() == 0
+	if idleDlPool && idleAnalyzerPool && idleItemPipeline && idleReqCache {
 		return true
 	}
 	return false
@@ -210,12 +587,9 @@ func (sched *myScheduler) Summary(prefix string) SchedSummary {
 
 // 开始下载。
 func (sched *myScheduler) startDownloading() {
+	reqChan := sched.getReqChan()
 	go func() {
-		for {
-			req, ok := <-sched.getReqChan()
-			if !ok {
-				break
-			}
+		for req := range reqChan {
 			go sched.download(req)
 		}
 	}()
@@ -223,6 +597,7 @@ func (sched *myScheduler) startDownloading() {
 
 // 下载。
 func (sched *myScheduler) download(req base.Request) {
+	defer sched.inFlight.Done()
 	defer func() {
 		if p := recover(); p != nil {
 			errMsg := fmt.Sprintf("Fatal Download Error: %s\n", p)
@@ -243,9 +618,36 @@ func (sched *myScheduler) download(req base.Request) {
 		}
 	}()
 	code := generateCode(DOWNLOADER_CODE, downloader.Id())
-	respp, err := downloader.Download(req)
+	if sessionManager := sched.schedArgs.SessionManager(); sessionManager != nil {
+		// 登录失败时仍会继续下载，以免整个站点的请求都被丢弃。
+		err := sessionManager.EnsureLogin(sched.ctx, sched.loginClient, req.HttpReq().URL)
+		if err != nil {
+			sched.sendError(err, code)
+		}
+	}
+	respp, err := downloader.Download(sched.ctx, req)
+	sched.reqCache.wake(sched.politeness.release(&req))
+	if errors.Is(err, dl.ErrRequestDropped) {
+		logger.Infof("The request has been dropped by a downloader middleware. (requestUrl=%s)\n",
+			req.HttpReq().URL)
+		sched.rejects.count("dropped")
+		if sched.frontier != nil {
+			sched.frontier.done(sched.reqKey(&req))
+		}
+		return
+	}
+	if sched.retryIfNeeded(req, respp, err) {
+		return
+	}
 	if respp != nil {
-		sched.sendResp(*respp, code)
+		// 有响应的请求要等到其响应被分析完毕之后才会被标记为已完成，以免其中的链接在中断后丢失。
+		sched.trackResp(respp, &req)
+		if !sched.sendResp(*respp, code) {
+			sched.finishResp(respp)
+		}
+	} else if sched.frontier != nil && sched.ctx.Err() == nil {
+		// 因关闭而被取消的请求仍会留在爬取边界中，以便在恢复爬取时被重新下载。
+		sched.frontier.done(sched.reqKey(&req))
 	}
 	if err != nil {
 		sched.sendError(err, code)
@@ -254,12 +656,9 @@ func (sched *myScheduler) download(req base.Request) {
 
 // 激活分析器。
 func (sched *myScheduler) activateAnalyzers(respParsers []anlz.ParseResponse) {
+	respChan := sched.getRespChan()
 	go func() {
-		for {
-			resp, ok := <-sched.getRespChan()
-			if !ok {
-				break
-			}
+		for resp := range respChan {
 			go sched.analyze(respParsers, resp)
 		}
 	}()
@@ -267,6 +666,7 @@ func (sched *myScheduler) activateAnalyzers(respParsers []anlz.ParseResponse) {
 
 // 分析。
 func (sched *myScheduler) analyze(respParsers []anlz.ParseResponse, resp base.Response) {
+	defer sched.inFlight.Done()
 	defer func() {
 		if p := recover(); p != nil {
 			errMsg := fmt.Sprintf("Fatal Analysis Error: %s\n", p)
@@ -287,7 +687,7 @@ func (sched *myScheduler) analyze(respParsers []anlz.ParseResponse, resp base.Re
 		}
 	}()
 	code := generateCode(ANALYZER_CODE, analyzer.Id())
-	dataList, errs := analyzer.Analyze(respParsers, resp)
+	dataList, errs := analyzer.Analyze(sched.ctx, respParsers, resp)
 	if dataList != nil {
 		for _, data := range dataList {
 			if data == nil {
@@ -309,22 +709,50 @@ func (sched *myScheduler) analyze(respParsers []anlz.ParseResponse, resp base.Re
 			sched.sendError(err, code)
 		}
 	}
+	sched.finishResp(&resp)
+}
+
+// 记录响应所对应的请求的键，以便在响应被分析完毕之后把该请求标记为已完成。只在开启持久化时有效。
+func (sched *myScheduler) trackResp(resp *base.Response, req *base.Request) {
+	if sched.frontier == nil {
+		return
+	}
+	sched.respMutex.Lock()
+	defer sched.respMutex.Unlock()
+	sched.respKeys[resp.HttpResp()] = sched.reqKey(req)
+}
+
+// 把响应所对应的请求标记为已完成。
+// 若工作上下文已被取消（即正在关闭），则该请求仍会留在爬取边界中，以便在恢复爬取时被重新下载和分析。
+func (sched *myScheduler) finishResp(resp *base.Response) {
+	if sched.frontier == nil {
+		return
+	}
+	sched.respMutex.Lock()
+	key, ok := sched.respKeys[resp.HttpResp()]
+	delete(sched.respKeys, resp.HttpResp())
+	sched.respMutex.Unlock()
+	if ok && sched.ctx.Err() == nil {
+		sched.frontier.done(key)
+	}
 }
 
 // 打开条目处理管道。
 func (sched *myScheduler) openItemPipeline() {
+	itemChan := sched.getItemChan()
 	go func() {
 		sched.itemPipeline.SetFailFast(true)
 		code := ITEMPIPELINE_CODE
-		for item := range sched.getItemChan() {
+		for item := range itemChan {
 			go func(item base.Item) {
+				defer sched.inFlight.Done()
 				defer func() {
 					if p := recover(); p != nil {
 						errMsg := fmt.Sprintf("Fatal Item Processing Error: %s\n", p)
 						logger.Fatal(errMsg)
 					}
 				}()
-				errs := sched.itemPipeline.Send(item)
+				errs := sched.itemPipeline.Send(sched.ctx, item)
 				if errs != nil {
 					for _, err := range errs {
 						sched.sendError(err, code)
@@ -347,54 +775,198 @@ func (sched *myScheduler) saveReqToCache(req base.Request, code string) bool {
 		logger.Warnln("Ignore the request! It's url is is invalid!")
 		return false
 	}
-	if strings.ToLower(reqUrl.Scheme) != "http" {
-		logger.Warnf("Ignore the request! It's url scheme '%s', but should be 'http'!\n", reqUrl.Scheme)
-		return false
-	}
-	if _, ok := sched.urlMap[reqUrl.String()]; ok {
-		logger.Warnf("Ignore the request! It's url is repeated. (requestUrl=%s)\n", reqUrl)
-		return false
-	}
-	if pd, _ := getPrimaryDomain(httpReq.Host); pd != sched.primaryDomain {
-		logger.Warnf("Ignore the request! It's host '%s' not in primary domain '%s'. (requestUrl=%s)\n",
-			httpReq.Host, sched.primaryDomain, reqUrl)
+	if !sched.schedArgs.SchemeAllowed(reqUrl.Scheme) {
+		logger.Warnf("Ignore the request! It's url scheme '%s', but should be one of %v!\n",
+			reqUrl.Scheme, sched.schedArgs.AllowedSchemes())
+		sched.rejects.count("scheme")
 		return false
 	}
 	if req.Depth() > sched.crawlDepth {
 		logger.Warnf("Ignore the request! It's depth %d greater than %d. (requestUrl=%s)\n",
 			req.Depth(), sched.crawlDepth, reqUrl)
+		sched.rejects.count("depth")
 		return false
 	}
-	if sched.stopSign.Signed() {
+	for _, filter := range sched.reqFilters {
+		if accepted, reason := filter.Filter(&req); !accepted {
+			logger.Warnf("Ignore the request! It's rejected by filter: %s. (requestUrl=%s)\n",
+				reason, reqUrl)
+			sched.rejects.count(reason)
+			return false
+		}
+	}
+	// 在关闭期间，若开启了持久化，则新的请求仍会被记录到爬取边界中，以便在恢复爬取时被处理。
+	if sched.stopSign.Signed() &&
+		(sched.frontier == nil || atomic.LoadUint32(&sched.running) != 4) {
 		sched.stopSign.Deal(code)
 		return false
 	}
-	sched.reqCache.put(&req)
-	sched.urlMap[reqUrl.String()] = true
+	if !sched.allowedByRobots(reqUrl) {
+		return false
+	}
+	if !sched.markSeen(&req) {
+		logger.Warnf("Ignore the request! It's url is repeated. (requestUrl=%s)\n", reqUrl)
+		sched.rejects.count("repeated")
+		return false
+	}
+	sched.putReqToCache(&req)
+	return true
+}
+
+// 把请求记录为已请求的。若其URL此前已被请求，则返回false。
+func (sched *myScheduler) markSeen(req *base.Request) bool {
+	key := sched.reqKey(req)
+	if !sched.seen.Add(key) {
+		return false
+	}
+	if sched.frontier != nil {
+		if err := sched.frontier.seen(key); err != nil {
+			logger.Errorf("Frontier log error: %s\n", err)
+		}
+	}
+	return true
+}
+
+// 判断URL是否被robots.txt允许访问。被禁止访问的URL会被计数并被报告到错误通道。
+// robots.txt中的Crawl-delay会被作为相应主机的最小请求间隔。
+func (sched *myScheduler) allowedByRobots(reqUrl *url.URL) bool {
+	if sched.robots == nil {
+		return true
+	}
+	if !sched.robots.Allowed(sched.ctx, reqUrl) {
+		sched.rejects.count("robots")
+		errMsg := fmt.Sprintf("The request is disallowed by robots.txt. (requestUrl=%s)", reqUrl)
+		sched.sendError(errors.New(errMsg), ROBOTS_CODE)
+		return false
+	}
+	if delay := sched.robots.CrawlDelay(sched.ctx, reqUrl); delay > 0 {
+		sched.politeness.setHostDelay(reqUrl.Hostname(), delay)
+	}
 	return true
 }
 
+// 把请求放入请求缓存，并在开启持久化时记录下来。
+func (sched *myScheduler) putReqToCache(req *base.Request) bool {
+	sched.assignHeaderProfile(req)
+	if sched.frontier != nil {
+		if err := sched.frontier.put(sched.reqKey(req), req); err != nil {
+			logger.Errorf("Frontier log error: %s\n", err)
+		}
+	}
+	return sched.reqCache.put(req, sched.priority(req))
+}
+
+// 在设置了报头配置时为请求确定报头配置，以使其名称被记录在请求中。
+func (sched *myScheduler) assignHeaderProfile(req *base.Request) {
+	if profiles := sched.schedArgs.HeaderProfiles(); profiles != nil {
+		profiles.Assign(req)
+	}
+}
+
+// 计算请求的优先级。
+func (sched *myScheduler) priority(req *base.Request) float64 {
+	prioritizer := sched.schedArgs.Prioritizer()
+	if prioritizer == nil {
+		return 0
+	}
+	return prioritizer.Priority(req)
+}
+
+// 获得请求的键。该键被用于请求的去重和持久化。
+// 请求的URL会先被规范化，因此指向同一网页的不同写法的URL会得到相同的键。
+// 非GET请求的键还包含请求方法和请求体的摘要，因此向同一URL提交的不同表单不会被视为重复的。
+func (sched *myScheduler) reqKey(req *base.Request) string {
+	keyUrl := sched.schedArgs.Canonicalizer().Canonicalize(req.HttpReq().URL)
+	if sched.schedArgs.SchemeInsensitiveDedup() && keyUrl.Scheme == "https" {
+		keyUrl.Scheme = "http"
+	}
+	// GET请求的键只包含URL，以便与已有的爬取边界兼容。
+	method := req.Method()
+	if method == http.MethodGet {
+		return keyUrl.String()
+	}
+	key := method + " " + keyUrl.String()
+	if digest := req.BodyDigest(); digest != "" {
+		key += " " + digest
+	}
+	return key
+}
+
+// 定期为爬取边界生成快照。
+func (sched *myScheduler) persistFrontier(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			if sched.stopSign.Signed() {
+				sched.stopSign.Deal(SCHEDULER_CODE)
+				return
+			}
+			if err := sched.frontier.snapshot(sched.seen); err != nil {
+				logger.Errorf("Frontier snapshot error: %s\n", err)
+			}
+		}
+	}()
+}
+
 // 发送响应。
+// 停止信号发出之后，响应仍会被发送，以使进行中的工作得以完成，直至通道被关闭为止。
 func (sched *myScheduler) sendResp(resp base.Response, code string) bool {
-	if sched.stopSign.Signed() {
+	sched.inFlight.Add(1)
+	sent := sched.guardSend(func(chanman mdw.ChannelManager) bool {
+		respChan, err := chanman.RespChan()
+		if err != nil {
+			return false
+		}
+		select {
+		case respChan <- resp:
+			return true
+		case <-sched.ctx.Done():
+			return false
+		}
+	})
+	if !sent {
+		sched.inFlight.Done()
 		sched.stopSign.Deal(code)
-		return false
 	}
-	sched.getRespChan() <- resp
-	return true
+	return sent
 }
 
 // 发送条目。
+// 停止信号发出之后，条目仍会被发送，以使进行中的工作得以完成，直至通道被关闭为止。
 func (sched *myScheduler) sendItem(item base.Item, code string) bool {
-	if sched.stopSign.Signed() {
+	sched.inFlight.Add(1)
+	sent := sched.guardSend(func(chanman mdw.ChannelManager) bool {
+		itemChan, err := chanman.ItemChan()
+		if err != nil {
+			return false
+		}
+		select {
+		case itemChan <- item:
+			return true
+		case <-sched.ctx.Done():
+			return false
+		}
+	})
+	if !sent {
+		sched.inFlight.Done()
 		sched.stopSign.Deal(code)
+	}
+	return sent
+}
+
+// 在通道未被关闭时执行发送操作。发送操作应在工作上下文被取消时放弃发送。
+// 关闭通道的一方会先取消工作上下文再获取写锁，因此不会与发送操作发生竞争。
+func (sched *myScheduler) guardSend(send func(chanman mdw.ChannelManager) bool) bool {
+	sched.chanMutex.RLock()
+	defer sched.chanMutex.RUnlock()
+	if sched.chanman.Status() != mdw.CHANNEL_MANAGER_STATUS_INITIALIZED {
 		return false
 	}
-	sched.getItemChan() <- item
-	return true
+	return send(sched.chanman)
 }
 
 // 发送错误。
+// 与条目一样，在调度器正在停止时，进行中的工作产生的错误仍会被发送，直至通道被关闭为止。
 func (sched *myScheduler) sendError(err error, code string) bool {
 	if err == nil {
 		return false
@@ -408,30 +980,52 @@ func (sched *myScheduler) sendError(err error, code string) bool {
 		errorType = base.ANALYZER_ERROR
 	case ITEMPIPELINE_CODE:
 		errorType = base.ITEM_PROCESSOR_ERROR
+	case ROBOTS_CODE:
+		errorType = base.ROBOTS_ERROR
 	}
 	cError := base.NewCrawlerError(errorType, err.Error())
 	if sched.stopSign.Signed() {
 		sched.stopSign.Deal(code)
-		return false
+		if atomic.LoadUint32(&sched.running) != 4 {
+			return false
+		}
 	}
-	go func() {
-		sched.getErrorChan() <- cError
-	}()
+	go sched.guardSend(func(chanman mdw.ChannelManager) bool {
+		errorChan, err := chanman.ErrorChan()
+		if err != nil {
+			return false
+		}
+		select {
+		case errorChan <- cError:
+			return true
+		case <-sched.ctx.Done():
+			return false
+		}
+	})
 	return true
 }
 
 // 调度。适当的搬运请求缓存中的请求到请求通道。
 func (sched *myScheduler) schedule(interval time.Duration) {
+	reqChan := sched.getReqChan()
 	go func() {
+		defer close(sched.scheduleDone)
 		for {
 			if sched.stopSign.Signed() {
 				sched.stopSign.Deal(SCHEDULER_CODE)
 				return
 			}
-			remainder := cap(sched.getReqChan()) - len(sched.getReqChan())
+			// 暂停期间不调度任何请求。
+			if sched.Paused() {
+				time.Sleep(interval)
+				continue
+			}
+			remainder := cap(reqChan) - len(reqChan)
 			var temp *base.Request
+			var queueKey string
 			for remainder > 0 {
-				temp = sched.reqCache.get()
+				// 正在等待的主机的请求会被跳过，以使其他主机的请求能够继续被调度。
+				temp, queueKey = sched.reqCache.get(sched.politeness.wait)
 				if temp == nil {
 					break
 				}
@@ -439,7 +1033,12 @@ func (sched *myScheduler) schedule(interval time.Duration) {
 					sched.stopSign.Deal(SCHEDULER_CODE)
 					return
 				}
-				sched.getReqChan() <- *temp
+				sched.politeness.acquire(temp, queueKey)
+				if !sched.sendReq(*temp) {
+					sched.reqCache.wake(sched.politeness.release(temp))
+					sched.stopSign.Deal(SCHEDULER_CODE)
+					return
+				}
 				remainder--
 			}
 			time.Sleep(interval)
@@ -447,6 +1046,27 @@ func (sched *myScheduler) schedule(interval time.Duration) {
 	}()
 }
 
+// 发送请求。只有调度循环会调用该方法。
+func (sched *myScheduler) sendReq(req base.Request) bool {
+	sched.inFlight.Add(1)
+	sent := sched.guardSend(func(chanman mdw.ChannelManager) bool {
+		reqChan, err := chanman.ReqChan()
+		if err != nil {
+			return false
+		}
+		select {
+		case reqChan <- req:
+			return true
+		case <-sched.ctx.Done():
+			return false
+		}
+	})
+	if !sent {
+		sched.inFlight.Done()
+	}
+	return sent
+}
+
 // 获取通道管理器持有的请求通道。
 func (sched *myScheduler) getReqChan() chan base.Request {
 	reqChan, err := sched.chanman.ReqChan()
@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	base "webcrawler/base"
+	dl "webcrawler/downloader"
+)
+
+func TestReqKey(t *testing.T) {
+	sched := &myScheduler{schedArgs: NewSchedArgs()}
+	newReq := func(method string, rawUrl string, body string) *base.Request {
+		req, err := base.NewRequestWithBody(method, rawUrl, []byte(body), "application/x-www-form-urlencoded", 0)
+		if err != nil {
+			t.Fatalf("NewRequestWithBody() error: %s", err)
+		}
+		return req
+	}
+	get := sched.reqKey(newReq(http.MethodGet, "HTTP://Example.com:80/a?b=2&a=1#x", ""))
+	// GET请求的键只包含规范化之后的URL，以便与已有的爬取边界兼容。
+	if get != "http://example.com/a?a=1&b=2" {
+		t.Errorf("Unexpected key of a GET request: %q", get)
+	}
+	post := sched.reqKey(newReq(http.MethodPost, "http://example.com/a?a=1&b=2", "q=1"))
+	cases := []struct {
+		name string
+		req  *base.Request
+		same bool
+	}{
+		{"same body, equivalent url", newReq(http.MethodPost, "http://EXAMPLE.com/a?b=2&a=1", "q=1"), true},
+		{"different body", newReq(http.MethodPost, "http://example.com/a?a=1&b=2", "q=2"), false},
+		{"different method", newReq(http.MethodPut, "http://example.com/a?a=1&b=2", "q=1"), false},
+		{"no body", newReq(http.MethodPost, "http://example.com/a?a=1&b=2", ""), false},
+	}
+	for _, c := range cases {
+		key := sched.reqKey(c.req)
+		if (key == post) != c.same {
+			t.Errorf("%s: key %q, POST key %q, want same=%v", c.name, key, post, c.same)
+		}
+		if key == get {
+			t.Errorf("%s: the key equals the key of the GET request", c.name)
+		}
+	}
+	if key := sched.reqKey(newReq(http.MethodPost, "http://example.com/", "")); key != "POST http://example.com/" {
+		t.Errorf("Unexpected key of a POST request without body: %q", key)
+	}
+
+	// 协议不敏感的去重把https当作http。
+	httpsReq := newReq(http.MethodPost, "https://example.com/a?a=1&b=2", "q=1")
+	if sched.reqKey(httpsReq) == post {
+		t.Error("The https request should differ from the http request by default")
+	}
+	sched.schedArgs.SetSchemeInsensitiveDedup(true)
+	if sched.reqKey(httpsReq) != post {
+		t.Error("The https request should equal the http request with scheme-insensitive dedup")
+	}
+}
+
+// 记录是否被关闭的响应体。
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (body *trackedBody) Close() error {
+	body.closed = true
+	return nil
+}
+
+func TestRetryClosesResponseBody(t *testing.T) {
+	args := NewSchedArgs()
+	// 等待时间足够长，以使被安排的重试在测试期间不会被执行。
+	policy, err := dl.NewExponentialBackoffPolicy(3, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("NewExponentialBackoffPolicy() error: %s", err)
+	}
+	args.SetRetryPolicy(policy)
+	sched := &myScheduler{schedArgs: args, ctx: context.Background(), retries: newRetryTimer()}
+	httpReq, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req := *base.NewRequest(httpReq, 0)
+	cases := []struct {
+		name string
+		code int
+		err  error
+	}{
+		{"retryable status code", http.StatusServiceUnavailable, nil},
+		// 读取响应体时出错的下载同时带有响应和错误。
+		{"error with a response", http.StatusOK, io.ErrUnexpectedEOF},
+	}
+	for _, c := range cases {
+		body := &trackedBody{Reader: strings.NewReader("partial")}
+		resp := base.NewResponse(&http.Response{StatusCode: c.code, Header: http.Header{}, Body: body}, 0)
+		if !sched.retryIfNeeded(req, resp, c.err) {
+			t.Errorf("%s: the download was not retried", c.name)
+		}
+		if !body.closed {
+			t.Errorf("%s: the response body was not closed", c.name)
+		}
+	}
+	if pending := sched.retries.pendingNumber(); pending != int64(len(cases)) {
+		t.Errorf("Got %d pending retries, want %d", pending, len(cases))
+	}
+}
@@ -0,0 +1,454 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+)
+
+// 已请求URL集合的接口类型。
+// 调度器会用它记录已请求的URL（更确切地说，是请求的键）并据此去重。
+// 实现类型必须是并发安全的。
+type SeenSet interface {
+	// 添加键。若键此前已在集合中（对于概率型的实现来说，是可能已在集合中），则返回false。
+	Add(key string) bool
+	// 判断键是否在集合中。概率型的实现可能会误判，但不会漏判。
+	Contains(key string) bool
+	// 获得被成功添加的键的数量。
+	Count() uint64
+	// 获得估算的误判率。精确的实现总会返回0。
+	FalsePositiveRate() float64
+	// 获得估算的内存占用，单位：字节。
+	MemoryUsage() uint64
+	// 把集合序列化为二进制形式。爬取边界的快照会用到它。
+	MarshalBinary() ([]byte, error)
+	// 从二进制形式还原集合。
+	UnmarshalBinary(data []byte) error
+}
+
+// 被用来生成已请求URL集合的函数类型。
+type GenSeenSet func() SeenSet
+
+// 可枚举的已请求URL集合的接口类型。只有精确的实现才是可枚举的。
+type enumerableSeenSet interface {
+	// 获得集合中所有的键。
+	Keys() []string
+}
+
+// 各种已请求URL集合的序列化形式的前缀。
+const (
+	exactSeenSetMagic         = "exact\n"
+	bloomSeenSetMagic         = "bloom\n"
+	scalableBloomSeenSetMagic = "sbloom\n"
+)
+
+// 检查并去掉序列化形式的前缀。
+func trimSeenSetMagic(data []byte, magic string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, errors.New(fmt.Sprintf(
+			"The serialized seen set is not of the expected kind '%s'!", magic[:len(magic)-1]))
+	}
+	return data[len(magic):], nil
+}
+
+// 创建精确的已请求URL集合。它基于字典实现，内存占用会随着键的数量无限增长。
+func NewExactSeenSet() SeenSet {
+	return &exactSeenSet{keys: make(map[string]struct{})}
+}
+
+// 精确的已请求URL集合的实现类型。
+type exactSeenSet struct {
+	keys     map[string]struct{} // 键的字典。
+	keyBytes uint64              // 所有键的总长度。
+	rwmutex  sync.RWMutex        // 读写锁。
+}
+
+// 字典中每个条目的估算的额外内存占用，单位：字节。
+const exactSeenSetEntryOverhead = 48
+
+func (set *exactSeenSet) Add(key string) bool {
+	set.rwmutex.Lock()
+	defer set.rwmutex.Unlock()
+	if _, ok := set.keys[key]; ok {
+		return false
+	}
+	set.keys[key] = struct{}{}
+	set.keyBytes += uint64(len(key))
+	return true
+}
+
+func (set *exactSeenSet) Contains(key string) bool {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	_, ok := set.keys[key]
+	return ok
+}
+
+func (set *exactSeenSet) Count() uint64 {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	return uint64(len(set.keys))
+}
+
+func (set *exactSeenSet) FalsePositiveRate() float64 {
+	return 0
+}
+
+func (set *exactSeenSet) MemoryUsage() uint64 {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	return set.keyBytes + uint64(len(set.keys))*exactSeenSetEntryOverhead
+}
+
+func (set *exactSeenSet) Keys() []string {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	keys := make([]string, 0, len(set.keys))
+	for key := range set.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (set *exactSeenSet) MarshalBinary() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(exactSeenSetMagic)
+	for _, key := range set.Keys() {
+		buffer.WriteString(key)
+		buffer.WriteByte('\n')
+	}
+	return buffer.Bytes(), nil
+}
+
+func (set *exactSeenSet) UnmarshalBinary(data []byte) error {
+	data, err := trimSeenSetMagic(data, exactSeenSetMagic)
+	if err != nil {
+		return err
+	}
+	for _, key := range bytes.Split(data, []byte{'\n'}) {
+		if len(key) > 0 {
+			set.Add(string(key))
+		}
+	}
+	return nil
+}
+
+// 布隆过滤器。它本身不是并发安全的。
+type bloomFilter struct {
+	bits   []uint64 // 位数组。
+	m      uint64   // 位数。
+	k      uint64   // 哈希函数的数量。
+	count  uint64   // 被添加的键的数量。
+	limit  uint64   // 设计容量。
+	fpRate float64  // 设计误判率。
+}
+
+// 创建布隆过滤器。参数capacity代表设计容量，参数fpRate代表在达到设计容量时的误判率。
+func newBloomFilter(capacity uint64, fpRate float64) *bloomFilter {
+	if capacity == 0 {
+		capacity = 1
+	}
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits:   make([]uint64, (m+63)/64),
+		m:      m,
+		k:      k,
+		limit:  capacity,
+		fpRate: fpRate,
+	}
+}
+
+// 计算键的两个基础哈希值。各个位置由双重哈希法（h1 + i*h2）得出。
+func bloomHashes(key string) (uint64, uint64) {
+	h1 := fnv.New64a()
+	h1.Write([]byte(key))
+	h2 := fnv.New64()
+	h2.Write([]byte(key))
+	return h1.Sum64(), h2.Sum64() | 1
+}
+
+// 添加键。若键可能已在过滤器中，则返回false。
+func (bf *bloomFilter) add(h1, h2 uint64) bool {
+	added := false
+	for i := uint64(0); i < bf.k; i++ {
+		pos := (h1 + i*h2) % bf.m
+		mask := uint64(1) << (pos % 64)
+		if bf.bits[pos/64]&mask == 0 {
+			bf.bits[pos/64] |= mask
+			added = true
+		}
+	}
+	if added {
+		bf.count++
+	}
+	return added
+}
+
+// 判断键是否可能在过滤器中。
+func (bf *bloomFilter) contains(h1, h2 uint64) bool {
+	for i := uint64(0); i < bf.k; i++ {
+		pos := (h1 + i*h2) % bf.m
+		if bf.bits[pos/64]&(uint64(1)<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 估算当前的误判率。
+func (bf *bloomFilter) estimatedFpRate() float64 {
+	return math.Pow(1-math.Exp(-float64(bf.k)*float64(bf.count)/float64(bf.m)), float64(bf.k))
+}
+
+// 把过滤器写入缓冲区。
+func (bf *bloomFilter) writeTo(buffer *bytes.Buffer) {
+	header := []uint64{bf.m, bf.k, bf.count, bf.limit, math.Float64bits(bf.fpRate)}
+	binary.Write(buffer, binary.BigEndian, header)
+	binary.Write(buffer, binary.BigEndian, bf.bits)
+}
+
+// 从读取器中还原过滤器。
+func readBloomFilter(reader *bytes.Reader) (*bloomFilter, error) {
+	header := make([]uint64, 5)
+	if err := binary.Read(reader, binary.BigEndian, header); err != nil {
+		return nil, err
+	}
+	bf := &bloomFilter{
+		m:      header[0],
+		k:      header[1],
+		count:  header[2],
+		limit:  header[3],
+		fpRate: math.Float64frombits(header[4]),
+	}
+	if bf.m == 0 || bf.k == 0 || (bf.m+63)/64 > uint64(reader.Len())/8 {
+		return nil, errors.New("The serialized bloom filter is broken!")
+	}
+	bf.bits = make([]uint64, (bf.m+63)/64)
+	if err := binary.Read(reader, binary.BigEndian, bf.bits); err != nil {
+		return nil, err
+	}
+	return bf, nil
+}
+
+// 检查布隆过滤器的参数。
+func checkBloomArgs(capacity uint64, fpRate float64) {
+	if capacity == 0 {
+		panic(errors.New("The capacity of bloom filter can not be 0!"))
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		panic(errors.New(fmt.Sprintf(
+			"The false positive rate of bloom filter must be in (0, 1)! (fpRate=%f)", fpRate)))
+	}
+}
+
+// 创建基于布隆过滤器的已请求URL集合。
+// 参数capacity代表预计的键的数量，参数fpRate代表在达到该数量时的误判率。
+// 其内存占用是固定的。键的数量超出预计之后，误判率会迅速上升。
+// 被误判的URL会被当作已请求的URL而被忽略。
+func NewBloomSeenSet(capacity uint64, fpRate float64) SeenSet {
+	checkBloomArgs(capacity, fpRate)
+	return &bloomSeenSet{filter: newBloomFilter(capacity, fpRate)}
+}
+
+// 基于布隆过滤器的已请求URL集合的实现类型。
+type bloomSeenSet struct {
+	filter  *bloomFilter // 布隆过滤器。
+	rwmutex sync.RWMutex // 读写锁。
+}
+
+func (set *bloomSeenSet) Add(key string) bool {
+	h1, h2 := bloomHashes(key)
+	set.rwmutex.Lock()
+	defer set.rwmutex.Unlock()
+	return set.filter.add(h1, h2)
+}
+
+func (set *bloomSeenSet) Contains(key string) bool {
+	h1, h2 := bloomHashes(key)
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	return set.filter.contains(h1, h2)
+}
+
+func (set *bloomSeenSet) Count() uint64 {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	return set.filter.count
+}
+
+func (set *bloomSeenSet) FalsePositiveRate() float64 {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	return set.filter.estimatedFpRate()
+}
+
+func (set *bloomSeenSet) MemoryUsage() uint64 {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	return uint64(len(set.filter.bits)) * 8
+}
+
+func (set *bloomSeenSet) MarshalBinary() ([]byte, error) {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	var buffer bytes.Buffer
+	buffer.WriteString(bloomSeenSetMagic)
+	set.filter.writeTo(&buffer)
+	return buffer.Bytes(), nil
+}
+
+func (set *bloomSeenSet) UnmarshalBinary(data []byte) error {
+	data, err := trimSeenSetMagic(data, bloomSeenSetMagic)
+	if err != nil {
+		return err
+	}
+	filter, err := readBloomFilter(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	set.rwmutex.Lock()
+	defer set.rwmutex.Unlock()
+	set.filter = filter
+	return nil
+}
+
+// 可扩展布隆过滤器的参数。
+const (
+	scalableBloomGrowth     = 2   // 新的布隆过滤器的容量相对于上一个的倍数。
+	scalableBloomTightening = 0.8 // 新的布隆过滤器的误判率相对于上一个的比例。
+)
+
+// 创建基于可扩展布隆过滤器的已请求URL集合。
+// 参数initialCapacity代表第一个布隆过滤器的容量，参数fpRate代表整体的误判率上限。
+// 每当最新的布隆过滤器达到其容量时，集合都会添加一个容量更大且误判率更低的布隆过滤器，
+// 因此整体的误判率总会低于参数fpRate，而内存占用则会随着键的数量按需增长。
+func NewScalableBloomSeenSet(initialCapacity uint64, fpRate float64) SeenSet {
+	checkBloomArgs(initialCapacity, fpRate)
+	// 各个布隆过滤器的误判率构成等比数列，其和不超过整体的误判率上限。
+	firstFpRate := fpRate * (1 - scalableBloomTightening)
+	return &scalableBloomSeenSet{
+		fpRate:  fpRate,
+		filters: []*bloomFilter{newBloomFilter(initialCapacity, firstFpRate)},
+	}
+}
+
+// 基于可扩展布隆过滤器的已请求URL集合的实现类型。
+type scalableBloomSeenSet struct {
+	fpRate  float64        // 整体的误判率上限。
+	filters []*bloomFilter // 布隆过滤器的列表。
+	count   uint64         // 被成功添加的键的数量。
+	rwmutex sync.RWMutex   // 读写锁。
+}
+
+func (set *scalableBloomSeenSet) Add(key string) bool {
+	h1, h2 := bloomHashes(key)
+	set.rwmutex.Lock()
+	defer set.rwmutex.Unlock()
+	for _, filter := range set.filters {
+		if filter.contains(h1, h2) {
+			return false
+		}
+	}
+	last := set.filters[len(set.filters)-1]
+	if last.count >= last.limit {
+		last = newBloomFilter(last.limit*scalableBloomGrowth,
+			last.fpRate*scalableBloomTightening)
+		set.filters = append(set.filters, last)
+	}
+	last.add(h1, h2)
+	set.count++
+	return true
+}
+
+func (set *scalableBloomSeenSet) Contains(key string) bool {
+	h1, h2 := bloomHashes(key)
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	for _, filter := range set.filters {
+		if filter.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (set *scalableBloomSeenSet) Count() uint64 {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	return set.count
+}
+
+func (set *scalableBloomSeenSet) FalsePositiveRate() float64 {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	notFalse := 1.0
+	for _, filter := range set.filters {
+		notFalse *= 1 - filter.estimatedFpRate()
+	}
+	return 1 - notFalse
+}
+
+func (set *scalableBloomSeenSet) MemoryUsage() uint64 {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	var usage uint64
+	for _, filter := range set.filters {
+		usage += uint64(len(filter.bits)) * 8
+	}
+	return usage
+}
+
+func (set *scalableBloomSeenSet) MarshalBinary() ([]byte, error) {
+	set.rwmutex.RLock()
+	defer set.rwmutex.RUnlock()
+	var buffer bytes.Buffer
+	buffer.WriteString(scalableBloomSeenSetMagic)
+	header := []uint64{math.Float64bits(set.fpRate), set.count, uint64(len(set.filters))}
+	binary.Write(&buffer, binary.BigEndian, header)
+	for _, filter := range set.filters {
+		filter.writeTo(&buffer)
+	}
+	return buffer.Bytes(), nil
+}
+
+func (set *scalableBloomSeenSet) UnmarshalBinary(data []byte) error {
+	data, err := trimSeenSetMagic(data, scalableBloomSeenSetMagic)
+	if err != nil {
+		return err
+	}
+	reader := bytes.NewReader(data)
+	header := make([]uint64, 3)
+	if err := binary.Read(reader, binary.BigEndian, header); err != nil {
+		return err
+	}
+	if header[2] == 0 {
+		return errors.New("The serialized scalable bloom filter is broken!")
+	}
+	filters := make([]*bloomFilter, 0, header[2])
+	for i := uint64(0); i < header[2]; i++ {
+		filter, err := readBloomFilter(reader)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, filter)
+	}
+	set.rwmutex.Lock()
+	defer set.rwmutex.Unlock()
+	set.fpRate = math.Float64frombits(header[0])
+	set.count = header[1]
+	set.filters = filters
+	return nil
+}
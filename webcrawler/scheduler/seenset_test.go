@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+// 测试用的键。它们与真实的请求键类似，彼此之间只有很小的差别。
+func seenSetKey(prefix string, i int) string {
+	return fmt.Sprintf("http://example.com/%s/page?id=%d", prefix, i)
+}
+
+// 添加键并检查它们均可被找到，然后返回从未添加过的键的实际误判率。
+func measureFpRate(t *testing.T, set SeenSet, added int, probes int) float64 {
+	for i := 0; i < added; i++ {
+		set.Add(seenSetKey("added", i))
+	}
+	for i := 0; i < added; i++ {
+		if key := seenSetKey("added", i); !set.Contains(key) {
+			t.Fatalf("The set does not contain the added key %q", key)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < probes; i++ {
+		if set.Contains(seenSetKey("absent", i)) {
+			falsePositives++
+		}
+	}
+	return float64(falsePositives) / float64(probes)
+}
+
+func TestExactSeenSet(t *testing.T) {
+	set := NewExactSeenSet()
+	if !set.Add("a") || !set.Add("b") || set.Add("a") {
+		t.Error("Unexpected result of Add()")
+	}
+	if !set.Contains("a") || set.Contains("c") || set.Count() != 2 || set.FalsePositiveRate() != 0 {
+		t.Errorf("Unexpected set: count=%d", set.Count())
+	}
+	if set.MemoryUsage() != 2+2*exactSeenSetEntryOverhead {
+		t.Errorf("Unexpected memory usage %d", set.MemoryUsage())
+	}
+	data, _ := set.MarshalBinary()
+	restored := NewExactSeenSet()
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error: %s", err)
+	}
+	if restored.Count() != 2 || !restored.Contains("b") {
+		t.Errorf("Unexpected restored set: count=%d", restored.Count())
+	}
+	if err := restored.UnmarshalBinary([]byte("bloom\n")); err == nil {
+		t.Error("Data of another kind of set should be rejected")
+	}
+}
+
+func TestBloomSeenSetFalsePositiveRate(t *testing.T) {
+	const capacity = 20000
+	const fpRate = 0.01
+	set := NewBloomSeenSet(capacity, fpRate)
+	actual := measureFpRate(t, set, capacity, 50000)
+	// 达到设计容量时，实际的误判率应与设计误判率相近。
+	if actual > fpRate*2 {
+		t.Errorf("The actual false positive rate %f is far above %f", actual, fpRate)
+	}
+	if estimated := set.FalsePositiveRate(); estimated < fpRate/2 || estimated > fpRate*2 {
+		t.Errorf("The estimated false positive rate %f is far from %f", estimated, fpRate)
+	}
+	if count := set.Count(); count > capacity || count < capacity*99/100 {
+		t.Errorf("Count() = %d, want about %d", count, capacity)
+	}
+	// 内存占用是固定的：约为每个键9.6位。
+	memory := set.MemoryUsage()
+	if memory < capacity*9/8 || memory > capacity*11/8 {
+		t.Errorf("Unexpected memory usage %d", memory)
+	}
+	data, _ := set.MarshalBinary()
+	restored := NewBloomSeenSet(1, 0.5)
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error: %s", err)
+	}
+	if restored.Count() != set.Count() || !restored.Contains(seenSetKey("added", 42)) {
+		t.Error("The restored set differs from the original set")
+	}
+	if err := restored.UnmarshalBinary(data[:len(data)-8]); err == nil {
+		t.Error("Truncated data should be rejected")
+	}
+}
+
+func TestScalableBloomSeenSetGrows(t *testing.T) {
+	const initialCapacity = 1000
+	const fpRate = 0.01
+	set := NewScalableBloomSeenSet(initialCapacity, fpRate)
+	initialMemory := set.MemoryUsage()
+	// 键的数量远超初始容量时，集合会不断添加布隆过滤器，误判率仍不超过上限。
+	const added = initialCapacity * 20
+	actual := measureFpRate(t, set, added, 50000)
+	if actual > fpRate {
+		t.Errorf("The actual false positive rate %f is above the limit %f", actual, fpRate)
+	}
+	if estimated := set.FalsePositiveRate(); estimated > fpRate {
+		t.Errorf("The estimated false positive rate %f is above the limit %f", estimated, fpRate)
+	}
+	filters := set.(*scalableBloomSeenSet).filters
+	// 容量依次为1000、2000、4000、8000和16000的5个过滤器足以容纳20000个键。
+	if len(filters) != 5 {
+		t.Errorf("Got %d filters, want 5", len(filters))
+	}
+	for i := 1; i < len(filters); i++ {
+		if filters[i].limit != filters[i-1].limit*scalableBloomGrowth || filters[i].fpRate >= filters[i-1].fpRate {
+			t.Errorf("Filter %d: capacity %d, fpRate %f", i, filters[i].limit, filters[i].fpRate)
+		}
+	}
+	if count := set.Count(); count > added || count < added*99/100 {
+		t.Errorf("Count() = %d, want about %d", count, added)
+	}
+	if set.MemoryUsage() <= initialMemory*10 {
+		t.Errorf("The memory usage %d did not grow with the keys (initially %d)", set.MemoryUsage(), initialMemory)
+	}
+	if set.Add(seenSetKey("added", 0)) {
+		t.Error("Adding an existing key should return false")
+	}
+
+	data, _ := set.MarshalBinary()
+	restored := NewScalableBloomSeenSet(1, 0.5)
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error: %s", err)
+	}
+	if restored.Count() != set.Count() || restored.MemoryUsage() != set.MemoryUsage() ||
+		!restored.Contains(seenSetKey("added", added-1)) {
+		t.Error("The restored set differs from the original set")
+	}
+	if err := restored.UnmarshalBinary(data[:20]); err == nil {
+		t.Error("Truncated data should be rejected")
+	}
+}
+
+func TestBloomSeenSetArgs(t *testing.T) {
+	cases := []struct {
+		capacity uint64
+		fpRate   float64
+	}{
+		{0, 0.01},
+		{100, 0},
+		{100, 1},
+		{100, -0.1},
+	}
+	for _, c := range cases {
+		for _, gen := range []func(uint64, float64) SeenSet{NewBloomSeenSet, NewScalableBloomSeenSet} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("Creating a set with capacity %d and fpRate %f should panic", c.capacity, c.fpRate)
+					}
+				}()
+				gen(c.capacity, c.fpRate)
+			}()
+		}
+	}
+}
@@ -18,56 +18,84 @@ func NewSchedSummary(sched *myScheduler, prefix string) SchedSummary {
 	if sched == nil {
 		return nil
 	}
-	urlCount := len(sched.urlMap)
-	var urlDetail string
-	if urlCount > 0 {
-		var buffer bytes.Buffer
-		buffer.WriteByte('\n')
-		for k, _ := range sched.urlMap {
-			buffer.WriteString(prefix)
-			buffer.WriteString(prefix)
-			buffer.WriteString(k)
-			buffer.WriteByte('\n')
-		}
-		urlDetail = buffer.String()
-	} else {
-		urlDetail = "\n"
+	robotsSummary := "<disabled>"
+	if sched.robots != nil {
+		robotsSummary = sched.robots.Summary()
+	}
+	frontierSummary := "<disabled>"
+	if sched.frontier != nil {
+		frontierSummary = sched.frontier.summary()
+	}
+	proxySummary := "<disabled>"
+	if pool := sched.schedArgs.ProxyPool(); pool != nil {
+		proxySummary = pool.Summary()
 	}
+	sessionSummary := "<disabled>"
+	if sessionManager := sched.schedArgs.SessionManager(); sessionManager != nil {
+		sessionSummary = sessionManager.Summary()
+	}
+	seenSetSummary := fmt.Sprintf(seenSetSummaryTemplate,
+		typeName(sched.seen),
+		sched.seen.FalsePositiveRate(),
+		sched.seen.MemoryUsage())
 	return &mySchedSummary{
 		prefix:              prefix,
 		running:             sched.running,
 		channelArgs:         sched.channelArgs,
 		poolBaseArgs:        sched.poolBaseArgs,
+		schedArgs:           sched.schedArgs,
 		crawlDepth:          sched.crawlDepth,
 		chanmanSummary:      sched.chanman.Summary(),
 		reqCacheSummary:     sched.reqCache.summary(),
+		frontierSummary:     frontierSummary,
+		politenessSummary:   sched.politeness.summary(),
+		robotsSummary:       robotsSummary,
+		rejectSummary:       sched.rejects.summary(),
+		retrySummary:        sched.retries.summary(),
+		transferSummary:     sched.transfer.Summary(),
+		proxySummary:        proxySummary,
+		sessionSummary:      sessionSummary,
 		dlPoolLen:           sched.dlpool.Used(),
 		dlPoolCap:           sched.dlpool.Total(),
 		analyzerPoolLen:     sched.analyzerPool.Used(),
 		analyzerPoolCap:     sched.analyzerPool.Total(),
 		itemPipelineSummary: sched.itemPipeline.Summary(),
-		urlCount:            urlCount,
-		urlDetail:           urlDetail,
+		seen:                sched.seen,
+		urlCount:            sched.seen.Count(),
+		seenSetSummary:      seenSetSummary,
 		stopSignSummary:     sched.stopSign.Summary(),
 	}
 }
 
+// 已请求URL集合的摘要信息的模板。
+var seenSetSummaryTemplate = "type: %s, falsePositiveRate: %g, memoryUsage: %d"
+
 // 调度器摘要信息的实现类型。
 type mySchedSummary struct {
 	prefix              string            // 前缀。
 	running             uint32            // 运行标记。
 	channelArgs         base.ChannelArgs  // 通道参数的容器。
 	poolBaseArgs        base.PoolBaseArgs // 池基本参数的容器。
+	schedArgs           SchedArgs         // 调度器参数的容器。
 	crawlDepth          uint32            // 爬取的最大深度。
 	chanmanSummary      string            // 通道管理器的摘要信息。
 	reqCacheSummary     string            // 请求缓存的摘要信息。
+	frontierSummary     string            // 爬取边界存储的摘要信息。
+	politenessSummary   string            // 礼貌性控制器的摘要信息。
+	robotsSummary       string            // robots.txt缓存的摘要信息。
+	rejectSummary       string            // 请求拒绝原因的计数的摘要信息。
+	retrySummary        string            // 重试计时器的摘要信息。
+	transferSummary     string            // 传输统计的摘要信息。
+	proxySummary        string            // 代理池的摘要信息。
+	sessionSummary      string            // 会话管理器的摘要信息。
 	dlPoolLen           uint32            // 网页下载器池的长度。
 	dlPoolCap           uint32            // 网页下载器池的容量。
 	analyzerPoolLen     uint32            // 分析器池的长度。
 	analyzerPoolCap     uint32            // 分析器池的容量。
 	itemPipelineSummary string            // 条目处理管道的摘要信息。
-	urlCount            int               // 已请求的URL的计数。
-	urlDetail           string            // 已请求的URL的详细信息。
+	seen                SeenSet           // 已请求的URL的集合。仅被用于生成详细信息。
+	urlCount            uint64            // 已请求的URL的计数。
+	seenSetSummary      string            // 已请求URL集合的摘要信息。
 	stopSignSummary     string            // 停止信号的摘要信息。
 }
 
@@ -83,32 +111,56 @@ func (ss *mySchedSummary) Detail() string {
 func (ss *mySchedSummary) getSummary(detail bool) string {
 	prefix := ss.prefix
 	template := prefix + "Running: %v \n" +
+		prefix + "Paused: %v \n" +
 		prefix + "Channel args: %s \n" +
 		prefix + "Pool base args: %s \n" +
+		prefix + "Scheduler args: %s \n" +
 		prefix + "Crawl depth: %d \n" +
 		prefix + "Channels manager: %s \n" +
 		prefix + "Request cache: %s\n" +
+		prefix + "Frontier: %s\n" +
+		prefix + "Politeness: %s\n" +
+		prefix + "Robots: %s\n" +
+		prefix + "Rejected requests: %s\n" +
+		prefix + "Retries: %s\n" +
+		prefix + "Transfer: %s\n" +
+		prefix + "Proxies: %s\n" +
+		prefix + "Sessions: %s\n" +
 		prefix + "Downloader pool: %d/%d\n" +
 		prefix + "Analyzer pool: %d/%d\n" +
 		prefix + "Item pipeline: %s\n" +
+		prefix + "Seen set: %s\n" +
 		prefix + "Urls(%d): %s" +
 		prefix + "Stop sign: %s\n"
 	return fmt.Sprintf(template,
 		func() bool {
 			return ss.running == 1
 		}(),
+		func() bool {
+			return ss.running == 3
+		}(),
 		ss.channelArgs.String(),
 		ss.poolBaseArgs.String(),
+		ss.schedArgs.String(),
 		ss.crawlDepth,
 		ss.chanmanSummary,
 		ss.reqCacheSummary,
+		ss.frontierSummary,
+		ss.politenessSummary,
+		ss.robotsSummary,
+		ss.rejectSummary,
+		ss.retrySummary,
+		ss.transferSummary,
+		ss.proxySummary,
+		ss.sessionSummary,
 		ss.dlPoolLen, ss.dlPoolCap,
 		ss.analyzerPoolLen, ss.analyzerPoolCap,
 		ss.itemPipelineSummary,
+		ss.seenSetSummary,
 		ss.urlCount,
 		func() string {
 			if detail {
-				return ss.urlDetail
+				return ss.getUrlDetail()
 			} else {
 				return "<concealed>\n"
 			}
@@ -116,6 +168,28 @@ func (ss *mySchedSummary) getSummary(detail bool) string {
 		ss.stopSignSummary)
 }
 
+// 获取已请求的URL的详细信息。
+// 只有精确的集合才能列出其中的URL，概率型的集合只会给出提示。
+func (ss *mySchedSummary) getUrlDetail() string {
+	enumerable, ok := ss.seen.(enumerableSeenSet)
+	if !ok {
+		return "<not enumerable>\n"
+	}
+	urls := enumerable.Keys()
+	if len(urls) == 0 {
+		return "\n"
+	}
+	var buffer bytes.Buffer
+	buffer.WriteByte('\n')
+	for _, k := range urls {
+		buffer.WriteString(ss.prefix)
+		buffer.WriteString(ss.prefix)
+		buffer.WriteString(k)
+		buffer.WriteByte('\n')
+	}
+	return buffer.String()
+}
+
 func (ss *mySchedSummary) Same(other SchedSummary) bool {
 	if other == nil {
 		return false
@@ -131,8 +205,18 @@ func (ss *mySchedSummary) Same(other SchedSummary) bool {
 		ss.analyzerPoolLen != otherSs.analyzerPoolLen ||
 		ss.analyzerPoolCap != otherSs.analyzerPoolCap ||
 		ss.urlCount != otherSs.urlCount ||
+		ss.seenSetSummary != otherSs.seenSetSummary ||
 		ss.stopSignSummary != otherSs.stopSignSummary ||
 		ss.reqCacheSummary != otherSs.reqCacheSummary ||
+		ss.frontierSummary != otherSs.frontierSummary ||
+		ss.politenessSummary != otherSs.politenessSummary ||
+		ss.robotsSummary != otherSs.robotsSummary ||
+		ss.rejectSummary != otherSs.rejectSummary ||
+		ss.retrySummary != otherSs.retrySummary ||
+		ss.transferSummary != otherSs.transferSummary ||
+		ss.proxySummary != otherSs.proxySummary ||
+		ss.sessionSummary != otherSs.sessionSummary ||
+		ss.schedArgs.String() != otherSs.schedArgs.String() ||
 		ss.poolBaseArgs.String() != otherSs.poolBaseArgs.String() ||
 		ss.channelArgs.String() != otherSs.channelArgs.String() ||
 		ss.itemPipelineSummary != otherSs.itemPipelineSummary ||
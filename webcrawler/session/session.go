@@ -0,0 +1,343 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/publicsuffix"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	base "webcrawler/base"
+	"webcrawler/tool/cookie"
+)
+
+// 日志记录器。
+var logger *logrus.Logger = base.NewLogger()
+
+// 登录函数的类型。参数client代表使用会话的Cookie容器的HTTP客户端。
+type Login func(ctx context.Context, client *http.Client) error
+
+// 创建依次发送参数reqs代表的请求的登录函数。
+// 只要有一个请求出错或得到了状态码不小于400的响应，登录就被视为失败。
+// 带有请求体的请求（如提交登录表单的POST请求）需要能够通过GetBody字段重新获得请求体，
+// 由http.NewRequest函数以*bytes.Reader、*bytes.Buffer或*strings.Reader为请求体创建的请求均满足此条件。
+func NewRequestSequence(reqs ...*http.Request) Login {
+	return func(ctx context.Context, client *http.Client) error {
+		for _, req := range reqs {
+			httpReq := req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return err
+				}
+				httpReq.Body = body
+			}
+			httpResp, err := client.Do(httpReq)
+			if err != nil {
+				return err
+			}
+			io.Copy(io.Discard, httpResp.Body)
+			httpResp.Body.Close()
+			if httpResp.StatusCode >= 400 {
+				errMsg := fmt.Sprintf("Unexpected login response status %d! (url=%s)",
+					httpResp.StatusCode, req.URL)
+				return errors.New(errMsg)
+			}
+		}
+		return nil
+	}
+}
+
+// 会话管理器的接口类型。
+// 它会为每个站点（即可注册域名，如“example.com”）或每个具名会话提供独立的Cookie容器。
+// 它本身也是一个Cookie容器，会把对Cookie的存取分派给URL所属的会话的Cookie容器。
+// 其实现必须是并发安全的。
+type SessionManager interface {
+	http.CookieJar
+	// 获得URL所属的会话的名称。
+	SessionName(u *url.URL) string
+	// 把域名（及其子域名）绑定到具名会话上。被绑定到同一会话上的域名会共享Cookie。
+	Bind(domain string, name string)
+	// 获得会话的Cookie容器。若其不存在，则会被创建（并从持久化目录中载入）。
+	Jar(name string) (cookie.Jar, error)
+	// 设置会话的登录函数。它会在该会话的第一个请求被下载之前被调用。
+	SetLogin(name string, login Login)
+	// 若URL所属的会话有登录函数且尚未登录，则使用参数client代表的HTTP客户端的副本进行登录。
+	// 同一会话的并发调用会等待登录完成。每个会话只会尝试登录一次，失败时只有第一次调用会返回错误。
+	EnsureLogin(ctx context.Context, client *http.Client, u *url.URL) error
+	// 把Cookie条目按照其域名分派到各会话的Cookie容器中。
+	Import(entries ...cookie.Entry) error
+	// 从Netscape格式的Cookie文件（即cookies.txt）中导入Cookie。
+	ImportNetscape(path string) error
+	// 把各会话的Cookie保存到持久化目录中。若未指定持久化目录，则不做任何事。
+	Save() error
+	// 获取摘要信息。
+	Summary() string
+}
+
+// 创建会话管理器。
+// 参数dir代表持久化目录。每个会话的Cookie会被保存在该目录下以会话名称命名的文件中。
+// 为空则表示不进行持久化。
+func NewSessionManager(dir string) (SessionManager, error) {
+	if dir != "" {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		dir = absDir
+	}
+	return &mySessionManager{
+		dir:      dir,
+		bindings: make(map[string]string),
+		sessions: make(map[string]*session),
+	}, nil
+}
+
+// 会话。
+type session struct {
+	jar       cookie.Jar // Cookie容器。
+	login     Login      // 登录函数。
+	attempted bool       // 是否已尝试登录。
+	loginErr  error      // 登录的错误。
+	mutex     sync.Mutex // 登录的互斥锁。
+}
+
+// 会话管理器的实现类型。
+type mySessionManager struct {
+	dir      string              // 持久化目录。
+	bindings map[string]string   // 域名与具名会话的名称的映射。
+	sessions map[string]*session // 会话的字典。
+	rwmutex  sync.RWMutex        // 读写锁。
+}
+
+func (sm *mySessionManager) SessionName(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	sm.rwmutex.RLock()
+	defer sm.rwmutex.RUnlock()
+	// 与主机名匹配的最长的已绑定域名优先。
+	for domain := host; domain != ""; {
+		if name, ok := sm.bindings[domain]; ok {
+			return name
+		}
+		index := strings.Index(domain, ".")
+		if index < 0 {
+			break
+		}
+		domain = domain[index+1:]
+	}
+	// IP地址以及公共后缀本身会被当作独立的站点。
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	site, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return site
+}
+
+func (sm *mySessionManager) Bind(domain string, name string) {
+	sm.rwmutex.Lock()
+	defer sm.rwmutex.Unlock()
+	sm.bindings[strings.ToLower(strings.TrimPrefix(domain, "."))] = name
+}
+
+func (sm *mySessionManager) Jar(name string) (cookie.Jar, error) {
+	s, err := sm.session(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.jar, nil
+}
+
+// 获得会话。若其不存在，则创建它。
+func (sm *mySessionManager) session(name string) (*session, error) {
+	if name == "" {
+		return nil, errors.New("The session name is empty!")
+	}
+	sm.rwmutex.RLock()
+	s, ok := sm.sessions[name]
+	sm.rwmutex.RUnlock()
+	if ok && s.jar != nil {
+		return s, nil
+	}
+	sm.rwmutex.Lock()
+	defer sm.rwmutex.Unlock()
+	s, ok = sm.sessions[name]
+	if !ok {
+		s = &session{}
+		sm.sessions[name] = s
+	}
+	if s.jar == nil {
+		var file string
+		if sm.dir != "" {
+			file = filepath.Join(sm.dir, url.PathEscape(name)+".json")
+		}
+		jar, err := cookie.NewPersistentCookiejar(file)
+		if err != nil {
+			return nil, err
+		}
+		s.jar = jar
+	}
+	return s, nil
+}
+
+func (sm *mySessionManager) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	jar, err := sm.Jar(sm.SessionName(u))
+	if err != nil {
+		logger.Errorf("Session error: %s (url=%s)\n", err, u)
+		return
+	}
+	jar.SetCookies(u, cookies)
+}
+
+func (sm *mySessionManager) Cookies(u *url.URL) []*http.Cookie {
+	jar, err := sm.Jar(sm.SessionName(u))
+	if err != nil {
+		logger.Errorf("Session error: %s (url=%s)\n", err, u)
+		return nil
+	}
+	return jar.Cookies(u)
+}
+
+func (sm *mySessionManager) SetLogin(name string, login Login) {
+	sm.rwmutex.Lock()
+	defer sm.rwmutex.Unlock()
+	s, ok := sm.sessions[name]
+	if !ok {
+		s = &session{}
+		sm.sessions[name] = s
+	}
+	s.mutex.Lock()
+	s.login = login
+	s.mutex.Unlock()
+}
+
+func (sm *mySessionManager) EnsureLogin(ctx context.Context, client *http.Client, u *url.URL) error {
+	name := sm.SessionName(u)
+	sm.rwmutex.RLock()
+	_, ok := sm.sessions[name]
+	sm.rwmutex.RUnlock()
+	if !ok {
+		return nil
+	}
+	s, err := sm.session(name)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.login == nil || s.attempted {
+		return nil
+	}
+	loginClient := &http.Client{}
+	if client != nil {
+		*loginClient = *client
+	}
+	loginClient.Jar = s.jar
+	logger.Infof("Log in the session %q...\n", name)
+	err = s.login(ctx, loginClient)
+	if err != nil && ctx.Err() != nil {
+		// 因关闭而被取消的登录会在下次被重新尝试。
+		return err
+	}
+	s.attempted = true
+	if err != nil {
+		s.loginErr = err
+		errMsg := fmt.Sprintf("Login error: %s (session=%s)", err, name)
+		return errors.New(errMsg)
+	}
+	return nil
+}
+
+func (sm *mySessionManager) Import(entries ...cookie.Entry) error {
+	grouped := make(map[string][]cookie.Entry)
+	for _, entry := range entries {
+		host := strings.TrimPrefix(entry.Domain, ".")
+		name := sm.SessionName(&url.URL{Host: host})
+		grouped[name] = append(grouped[name], entry)
+	}
+	for name, group := range grouped {
+		jar, err := sm.Jar(name)
+		if err != nil {
+			return err
+		}
+		jar.AddEntries(group...)
+	}
+	return nil
+}
+
+func (sm *mySessionManager) ImportNetscape(path string) error {
+	entries, err := cookie.LoadNetscape(path)
+	if err != nil {
+		return err
+	}
+	return sm.Import(entries...)
+}
+
+func (sm *mySessionManager) Save() error {
+	var firstErr error
+	_, jars := sm.snapshot()
+	for _, jar := range jars {
+		if err := jar.Save(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// 获得会话的字典以及已创建的Cookie容器的字典的副本。
+func (sm *mySessionManager) snapshot() (map[string]*session, map[string]cookie.Jar) {
+	sm.rwmutex.RLock()
+	defer sm.rwmutex.RUnlock()
+	sessions := make(map[string]*session, len(sm.sessions))
+	jars := make(map[string]cookie.Jar, len(sm.sessions))
+	for name, s := range sm.sessions {
+		sessions[name] = s
+		if s.jar != nil {
+			jars[name] = s.jar
+		}
+	}
+	return sessions, jars
+}
+
+var sessionSummaryTemplate = "%s{cookies: %d, login: %s}"
+
+func (sm *mySessionManager) Summary() string {
+	sessions, jars := sm.snapshot()
+	names := make([]string, 0, len(sessions))
+	for name := range sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	summaries := make([]string, 0, len(names))
+	for _, name := range names {
+		s := sessions[name]
+		cookies := 0
+		if jar, ok := jars[name]; ok {
+			cookies = jar.Len()
+		}
+		s.mutex.Lock()
+		login := "none"
+		switch {
+		case s.login == nil:
+		case !s.attempted:
+			login = "pending"
+		case s.loginErr != nil:
+			login = "failed"
+		default:
+			login = "done"
+		}
+		s.mutex.Unlock()
+		summaries = append(summaries, fmt.Sprintf(sessionSummaryTemplate, name, cookies, login))
+	}
+	return fmt.Sprintf("sessions: %d, persistent: %v, [%s]",
+		len(names), sm.dir != "", strings.Join(summaries, ", "))
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"webcrawler/tool/cookie"
+)
+
+func mustParseUrl(t *testing.T, rawUrl string) *url.URL {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatalf("url.Parse(%q) error: %s", rawUrl, err)
+	}
+	return u
+}
+
+func TestSessionName(t *testing.T) {
+	sm, err := NewSessionManager("")
+	if err != nil {
+		t.Fatalf("NewSessionManager() error: %s", err)
+	}
+	sm.Bind(".Example.com", "shop")
+	sm.Bind("api.example.com", "api")
+	sm.Bind("other.org", "shop")
+	cases := []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/", "shop"},
+		{"https://WWW.example.com:8443/a", "shop"},
+		// 与主机名匹配的最长的已绑定域名优先。
+		{"http://api.example.com/", "api"},
+		{"http://v1.api.example.com/", "api"},
+		{"http://www.other.org/", "shop"},
+		// 未绑定的主机按照站点（可注册域名）划分会话。
+		{"http://www.example.net/", "example.net"},
+		{"http://a.b.example.co.uk/", "example.co.uk"},
+		{"http://notexample.com/", "notexample.com"},
+		{"http://127.0.0.1:8080/", "127.0.0.1"},
+		{"http://[::1]:8080/", "::1"},
+		{"http://co.uk/", "co.uk"},
+		{"http://localhost/", "localhost"},
+	}
+	for _, c := range cases {
+		if got := sm.SessionName(mustParseUrl(t, c.url)); got != c.want {
+			t.Errorf("SessionName(%s) = %q, want %q", c.url, got, c.want)
+		}
+	}
+}
+
+func TestSessionRouting(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager() error: %s", err)
+	}
+	sm.Bind("example.org", "shared")
+	sm.Bind("example.net", "shared")
+	sm.SetCookies(mustParseUrl(t, "http://www.example.com/"), []*http.Cookie{{Name: "a", Value: "1", Domain: "example.com"}})
+	sm.SetCookies(mustParseUrl(t, "http://example.org/"), []*http.Cookie{{Name: "b", Value: "2"}})
+	err = sm.Import(
+		cookie.Entry{Name: "c", Value: "3", Domain: ".example.net", Path: "/"},
+		cookie.Entry{Name: "d", Value: "4", Domain: "sub.example.com", Path: "/", HostOnly: true},
+	)
+	if err != nil {
+		t.Fatalf("Import() error: %s", err)
+	}
+	// 不同会话的Cookie互不可见；被绑定到同一会话上的各站点共享Cookie容器，但Cookie仍只被发送给与其域名匹配的主机。
+	cases := []struct {
+		url  string
+		want []string
+	}{
+		{"http://example.com/", []string{"a=1"}},
+		{"http://sub.example.com/", []string{"a=1", "d=4"}},
+		{"http://example.org/", []string{"b=2"}},
+		{"http://www.example.net/", []string{"c=3"}},
+		{"http://example.info/", nil},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, ck := range sm.Cookies(mustParseUrl(t, c.url)) {
+			got = append(got, ck.Name+"="+ck.Value)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Cookies(%s) = %q, want %q", c.url, got, c.want)
+		}
+	}
+	shared, err := sm.Jar("shared")
+	if err != nil || shared.Len() != 2 {
+		t.Errorf("The shared session should hold 2 cookies: %v", err)
+	}
+	if _, err := sm.Jar(""); err == nil {
+		t.Error("Jar(\"\") should fail")
+	}
+
+	if err := sm.Save(); err != nil {
+		t.Fatalf("Save() error: %s", err)
+	}
+	for _, name := range []string{"example.com", "shared"} {
+		if _, err := os.Stat(filepath.Join(dir, name+".json")); err != nil {
+			t.Errorf("The cookie file of session %q was not saved: %s", name, err)
+		}
+	}
+	reloaded, _ := NewSessionManager(dir)
+	reloaded.Bind("example.net", "shared")
+	if got := reloaded.Cookies(mustParseUrl(t, "http://example.net/")); len(got) != 1 || got[0].Value != "3" {
+		t.Errorf("Unexpected cookies after reloading: %v", got)
+	}
+}
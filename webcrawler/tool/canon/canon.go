@@ -0,0 +1,280 @@
+package canon
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 规范化规则的函数类型。它会直接修改作为参数的URL。
+type NormalizeRule func(u *url.URL)
+
+// URL规范化器的接口类型。
+// 经过规范化之后，指向同一网页的不同写法的URL会得到相同的结果。
+type Canonicalizer interface {
+	// 规范化URL。参数u不会被修改，结果值是一个新的URL。
+	Canonicalize(u *url.URL) *url.URL
+	// 规范化URL并返回其字符串形式。该形式适合被用作去重和缓存的键。
+	Key(u *url.URL) string
+}
+
+// 默认的跟踪参数的名称的列表。以“*”结尾的名称表示前缀。
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"gclid",
+	"fbclid",
+	"msclkid",
+	"yclid",
+	"_ga",
+	"jsessionid",
+	"phpsessid",
+	"aspsessionid",
+	"sid",
+	"sessionid",
+	"session_id",
+}
+
+// 匹配路径中的会话ID参数（如“;jsessionid=...”）的正则表达式。
+var regexpForPathSessionId = regexp.MustCompile(`(?i);(jsessionid|phpsessid|sid)=[^/;]*`)
+
+// 协议与默认端口号的映射。
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// 创建URL规范化器。
+// 规范化器总会把协议和主机名转换为小写形式，去掉默认端口号和片段，
+// 解析路径中的“.”和“..”，统一百分号编码，并对查询参数进行排序。
+// 参数stripTracking表示是否去掉跟踪参数（参见DefaultTrackingParams）。
+// 参数extraRules代表额外的规范化规则。它们会在上述步骤之后被依次应用。
+func NewCanonicalizer(stripTracking bool, extraRules ...NormalizeRule) Canonicalizer {
+	var trackingParams []string
+	if stripTracking {
+		trackingParams = DefaultTrackingParams
+	}
+	return &myCanonicalizer{
+		trackingParams: trackingParams,
+		extraRules:     extraRules,
+	}
+}
+
+// 创建去掉指定查询参数的规范化规则。以“*”结尾的名称表示前缀。名称不区分大小写。
+func NewStripParamsRule(names ...string) NormalizeRule {
+	return func(u *url.URL) {
+		u.RawQuery = stripParams(u.RawQuery, names)
+	}
+}
+
+// URL规范化器的实现类型。
+type myCanonicalizer struct {
+	trackingParams []string        // 需要被去掉的跟踪参数的名称的列表。
+	extraRules     []NormalizeRule // 额外的规范化规则的列表。
+}
+
+func (c *myCanonicalizer) Canonicalize(u *url.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+	cu := *u
+	if u.User != nil {
+		user := *u.User
+		cu.User = &user
+	}
+	cu.Scheme = strings.ToLower(cu.Scheme)
+	cu.Host = normalizeHost(cu.Scheme, cu.Host)
+	cu.Fragment = ""
+	cu.RawFragment = ""
+	if cu.Opaque == "" {
+		// 先解码非保留字符，以使“%2E%2E”等编码形式的点段也能被解析。
+		escapedPath := removeDotSegments(normalizeEscapes(cu.EscapedPath()))
+		if len(c.trackingParams) > 0 {
+			escapedPath = regexpForPathSessionId.ReplaceAllString(escapedPath, "")
+		}
+		if escapedPath == "" && cu.Host != "" {
+			escapedPath = "/"
+		}
+		if path, err := url.PathUnescape(escapedPath); err == nil {
+			cu.Path = path
+			cu.RawPath = ""
+			// 只有当默认的转义结果与规范化后的路径不同时，才需要保留RawPath。
+			if cu.EscapedPath() != escapedPath {
+				cu.RawPath = escapedPath
+			}
+		}
+	}
+	cu.RawQuery = normalizeQuery(cu.RawQuery, c.trackingParams)
+	cu.ForceQuery = false
+	for _, rule := range c.extraRules {
+		if rule != nil {
+			rule(&cu)
+		}
+	}
+	return &cu
+}
+
+func (c *myCanonicalizer) Key(u *url.URL) string {
+	cu := c.Canonicalize(u)
+	if cu == nil {
+		return ""
+	}
+	return cu.String()
+}
+
+// 规范化主机。转换为小写形式，去掉末尾的“.”以及与协议对应的默认端口号。
+func normalizeHost(scheme string, host string) string {
+	host = strings.ToLower(host)
+	hostname, port := host, ""
+	if index := strings.LastIndex(host, ":"); index >= 0 && !strings.HasSuffix(host, "]") {
+		hostname, port = host[:index], host[index+1:]
+	}
+	hostname = strings.TrimSuffix(hostname, ".")
+	if port == "" || port == defaultPorts[scheme] {
+		return hostname
+	}
+	return hostname + ":" + port
+}
+
+// 按照RFC 3986第5.2.4节解析路径中的“.”和“..”。
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			// 第一个元素为空代表绝对路径的根，不能被移除。
+			if len(output) > 1 || (len(output) == 1 && output[0] != "") {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+	result := strings.Join(output, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+// 统一百分号编码。十六进制数字会被转换为大写形式，非保留字符的编码会被解码。
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				builder.WriteByte(c)
+			} else {
+				builder.WriteByte('%')
+				builder.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		builder.WriteByte(s[i])
+	}
+	return builder.String()
+}
+
+// 规范化查询字符串。参数会按照名称和值排序，空参数和跟踪参数会被去掉。
+func normalizeQuery(rawQuery string, trackingParams []string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	rawQuery = stripParams(rawQuery, trackingParams)
+	params := strings.Split(rawQuery, "&")
+	result := make([]string, 0, len(params))
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+		result = append(result, normalizeEscapes(param))
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		ki, kj := paramName(result[i]), paramName(result[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return result[i] < result[j]
+	})
+	return strings.Join(result, "&")
+}
+
+// 从查询字符串中去掉指定的参数。以“*”结尾的名称表示前缀。名称不区分大小写。
+func stripParams(rawQuery string, names []string) string {
+	if rawQuery == "" || len(names) == 0 {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	result := make([]string, 0, len(params))
+	for _, param := range params {
+		name := strings.ToLower(paramName(param))
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !matchParamName(name, names) {
+			result = append(result, param)
+		}
+	}
+	return strings.Join(result, "&")
+}
+
+// 判断参数名称是否与名称列表中的某一项匹配。
+func matchParamName(name string, names []string) bool {
+	for _, pattern := range names {
+		pattern = strings.ToLower(pattern)
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// 获得查询参数的名称。
+func paramName(param string) string {
+	if index := strings.Index(param, "="); index >= 0 {
+		return param[:index]
+	}
+	return param
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// 判断字符是否为RFC 3986中的非保留字符。
+func isUnreserved(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,126 @@
+package charset
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 常用字符集的规范名称（参见WHATWG Encoding Standard）。
+// 其他字符集（如shift_jis、euc-kr、iso-8859-2、koi8-r）同样被支持，其规范名称可以通过Lookup函数获得。
+const (
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	WINDOWS1252 = "windows-1252"
+	GBK         = "gbk"
+	GB18030     = "gb18030"
+	BIG5        = "big5"
+)
+
+// 判定字符集时最多检查的内容的长度。
+const PrescanLength = 1024
+
+// 匹配XML声明中的编码的正则表达式。
+var regexpForXmlEncoding = regexp.MustCompile(`^<\?xml[^>]*\sencoding\s*=\s*["']([^"']+)["']`)
+
+// 获得字符集标签对应的规范名称。标签不区分大小写。若标签未知，则返回空字符串。
+func Lookup(label string) string {
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return ""
+	}
+	name, err := htmlindex.Name(enc)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// 判定内容的字符集。
+// 依次依据字节顺序标记、参数contentType（Content-Type报头的值）中的charset参数、
+// 内容开头处的<meta>标签（参见golang.org/x/net/html/charset包的DetermineEncoding函数）或XML声明进行判定。
+// 若均未给出字符集，则合法的UTF-8内容被判定为UTF-8，否则被判定为参数defaultCharset代表的字符集。
+// 参数content只需包含内容的开头部分（参见PrescanLength）。
+// 结果值certain表示字符集是否来源于字节顺序标记或Content-Type报头。
+func DetermineCharset(content []byte, contentType string, defaultCharset string) (name string, certain bool) {
+	if len(content) > PrescanLength {
+		content = content[:PrescanLength]
+	}
+	enc, name, certain := charset.DetermineEncoding(content, contentType)
+	if certain {
+		return name, true
+	}
+	if match := regexpForXmlEncoding.FindSubmatch(content); match != nil {
+		if name := Lookup(string(match[1])); name != "" {
+			// 与HTML标准一致，声明为UTF-16的内容会被当作UTF-8。
+			if strings.HasPrefix(name, "utf-16") {
+				name = UTF8
+			}
+			return name, false
+		}
+	}
+	// 未找到字符集声明时，DetermineEncoding函数会返回encoding.Nop（内容是含有非ASCII字符的合法UTF-8）
+	// 或charmap.Windows1252。其他结果均来源于<meta>标签。
+	if enc != encoding.Nop && enc != charmap.Windows1252 {
+		return name, false
+	}
+	if enc == encoding.Nop || isASCII(trimPartialRune(content)) {
+		return UTF8, false
+	}
+	if name = Lookup(defaultCharset); name != "" {
+		return name, false
+	}
+	return WINDOWS1252, false
+}
+
+// 去掉内容末尾不完整的字符。
+func trimPartialRune(content []byte) []byte {
+	for i := len(content) - 1; i >= 0 && i > len(content)-utf8.UTFMax; i-- {
+		if content[i] < utf8.RuneSelf {
+			break
+		}
+		if utf8.RuneStart(content[i]) {
+			if !utf8.FullRune(content[i:]) {
+				return content[:i]
+			}
+			break
+		}
+	}
+	return content
+}
+
+// 判断内容是否只包含ASCII字符。
+func isASCII(content []byte) bool {
+	for _, b := range content {
+		if b >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// 创建把以参数charset代表的字符集编码的内容转换为UTF-8编码的读取器。
+// 与WHATWG Encoding Standard的decode算法一致，内容开头处的字节顺序标记会被去掉，
+// 且会优先于参数charset决定所用的Unicode编码。无法解码的字节会被替换为U+FFFD。
+func NewReader(r io.Reader, charset string) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Unsupported charset %q!", charset))
+	}
+	// 与WHATWG Encoding Standard一致，GBK（包括GB2312）使用GB18030的解码器，以便解码四字节的字符。
+	if enc == simplifiedchinese.GBK {
+		enc = simplifiedchinese.GB18030
+	}
+	return transform.NewReader(r, unicode.BOMOverride(enc.NewDecoder())), nil
+}
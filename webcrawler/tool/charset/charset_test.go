@@ -0,0 +1,171 @@
+package charset
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDetermineCharset(t *testing.T) {
+	cases := []struct {
+		name           string
+		content        string
+		contentType    string
+		defaultCharset string
+		want           string
+		wantCertain    bool
+	}{
+		{"utf-8 bom", "\xEF\xBB\xBF<html>", "text/html; charset=gbk", "", UTF8, true},
+		{"utf-16le bom", "\xFF\xFE<\x00", "", "", UTF16LE, true},
+		{"utf-16be bom", "\xFE\xFF\x00<", "", "", UTF16BE, true},
+		{"content type", "<html>", "text/html; charset=GB2312", "", GBK, true},
+		{"content type over meta", `<meta charset="big5">`, "text/html; charset=gb18030", "", GB18030, true},
+		{"unknown content type charset", `<meta charset="big5">`, "text/html; charset=x-unknown", "", BIG5, false},
+		{"meta charset", `<html><head><meta charset="Big5"></head>`, "text/html", "", BIG5, false},
+		{"meta http-equiv", `<meta http-equiv="Content-Type" content="text/html; charset=gbk">`, "", "", GBK, false},
+		{"xml declaration", `<?xml version="1.0" encoding="GB18030"?><rss>`, "", "", GB18030, false},
+		{"meta utf-16 as utf-8", `<meta charset="utf-16">`, "", "", UTF8, false},
+		{"valid utf-8", "<p>\xE4\xB8\xAD\xE6\x96\x87</p>", "", GBK, UTF8, false},
+		{"truncated utf-8 at end", "<p>\xE4\xB8", "", GBK, UTF8, false},
+		{"invalid utf-8 uses default", "<p>\xD6\xD0\xCE\xC4</p>", "", "gb2312", GBK, false},
+		{"unknown default", "<p>\xD6\xD0\xCE\xC4</p>", "", "x-unknown", WINDOWS1252, false},
+		{"meta shift_jis", `<meta charset="Shift_JIS">`, "", "", "shift_jis", false},
+		{"meta http-equiv euc-kr", `<meta http-equiv="content-type" content="text/html; charset=euc-kr">`, "", "", "euc-kr", false},
+		{"content type koi8-r", "<html>", "text/html; charset=KOI8-R", "", "koi8-r", true},
+		{"content type iso-8859-2", "<html>", "text/html; charset=latin2", "", "iso-8859-2", true},
+		{"default euc-jp", "<p>\xC6\xFC\xCB\xDC</p>", "", "EUC-JP", "euc-jp", false},
+		{"meta beyond prescan", strings.Repeat(" ", PrescanLength) + `<meta charset="big5">`, "", "", UTF8, false},
+	}
+	for _, c := range cases {
+		name, certain := DetermineCharset([]byte(c.content), c.contentType, c.defaultCharset)
+		if name != c.want || certain != c.wantCertain {
+			t.Errorf("%s: DetermineCharset() = (%q, %v), want (%q, %v)",
+				c.name, name, certain, c.want, c.wantCertain)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	cases := []struct {
+		name    string
+		charset string
+		input   string
+		want    string
+	}{
+		{"utf-8", "utf8", "\xE4\xB8\xAD\xE6\x96\x87", "中文"},
+		{"utf-8 bom", "utf-8", "\xEF\xBB\xBFa\xE4\xB8\xAD", "a中"},
+		{"utf-8 invalid", "utf-8", "a\xFFb", "a�b"},
+		{"utf-8 truncated", "utf-8", "a\xE4\xB8", "a�"},
+		{"utf-16le", "utf-16", "\xFF\xFE\x2D\x4E\x87\x65", "中文"},
+		{"utf-16be", "utf-16be", "\x4E\x2D\x65\x87", "中文"},
+		{"utf-16le surrogate pair", "utf-16le", "\x40\xD8\x00\xDC", "\U00020000"},
+		{"utf-16le odd length", "utf-16le", "\x2D\x4E\x41", "中�"},
+		{"windows-1252", "latin1", "caf\xE9 \x80", "café €"},
+		{"gbk", "gbk", "\xD6\xD0\xCE\xC4", "中文"},
+		{"gb2312", "GB2312", "<p>\xC4\xE3\xBA\xC3</p>", "<p>你好</p>"},
+		{"gbk euro", "gbk", "\x80", "€"},
+		{"gbk ideographic space", "gbk", "\xA1\xA1", "　"},
+		{"gb18030 four-byte bmp", "gb18030", "\x81\x30\x81\x30", "\u0080"},
+		{"gb18030 four-byte supplementary", "gb18030", "\x95\x32\x82\x36", "\U00020000"},
+		{"gbk four-byte", "gbk", "a\x81\x30\x81\x30b", "a\u0080b"},
+		{"gb18030 invalid lead", "gb18030", "a\xFFb", "a�b"},
+		{"gb18030 truncated", "gb18030", "a\xD6", "a�"},
+		{"big5", "big5", "\xA4\xA4\xA4\xE5", "中文"},
+		{"big5 ideographic space", "big5", "\xA1\x40", "　"},
+		{"shift_jis", "sjis", "\x93\xFA\x96\x7B\x8C\xEA", "日本語"},
+		{"euc-jp", "euc-jp", "\xC6\xFC\xCB\xDC", "日本"},
+		{"iso-2022-jp", "csiso2022jp", "\x1B\x24\x42\x46\x7C\x4B\x5C\x1B\x28\x42", "日本"},
+		{"euc-kr", "ks_c_5601-1987", "\xC7\xD1\xB1\xB9", "한국"},
+		{"iso-8859-2", "iso-8859-2", "\xA3\xF3\x64\xBC", "Łódź"},
+		{"koi8-r", "koi8-r", "\xF0\xD2\xC9\xD7\xC5\xD4", "Привет"},
+		{"bom overrides label", "gbk", "\xEF\xBB\xBF\xE4\xB8\xAD", "中"},
+		{"big5 x-x-big5 label", "x-x-big5", "<b>\xA5\x78\xC6\x57</b>", "<b>台灣</b>"},
+	}
+	readers := []struct {
+		name string
+		wrap func(r io.Reader) io.Reader
+	}{
+		{"whole", func(r io.Reader) io.Reader { return r }},
+		{"one byte", iotest.OneByteReader},
+		{"half", iotest.HalfReader},
+		{"data err", iotest.DataErrReader},
+	}
+	for _, c := range cases {
+		for _, rd := range readers {
+			reader, err := NewReader(rd.wrap(strings.NewReader(c.input)), c.charset)
+			if err != nil {
+				t.Fatalf("%s (%s): NewReader() error: %s", c.name, rd.name, err)
+			}
+			got, err := io.ReadAll(iotest.OneByteReader(reader))
+			if err != nil {
+				t.Errorf("%s (%s): read error: %s", c.name, rd.name, err)
+				continue
+			}
+			if string(got) != c.want {
+				t.Errorf("%s (%s): got %q, want %q", c.name, rd.name, got, c.want)
+			}
+		}
+	}
+}
+
+// 多字节字符被原读取器的一次读取分割开时，应当在下一次读取之后被完整地解码。
+func TestNewReaderSplitCharacter(t *testing.T) {
+	cases := []struct {
+		charset string
+		input   string
+		want    string
+	}{
+		{"utf-8", "\xE4\xB8\xAD\xE6\x96\x87\xF0\xA0\x80\x80", "中文\U00020000"},
+		{"utf-16le", "\xFF\xFE\x2D\x4E\x40\xD8\x00\xDC", "中\U00020000"},
+		{"gbk", "\xD6\xD0\xCE\xC4", "中文"},
+		{"gb18030", "\xD6\xD0\x95\x32\x82\x36", "中\U00020000"},
+		{"big5", "\xA4\xA4\xA4\xE5", "中文"},
+	}
+	for _, c := range cases {
+		// 在每个可能的位置把内容分割为两次读取。
+		for i := 1; i < len(c.input); i++ {
+			src := io.MultiReader(strings.NewReader(c.input[:i]), strings.NewReader(c.input[i:]))
+			reader, err := NewReader(src, c.charset)
+			if err != nil {
+				t.Fatalf("%s: NewReader() error: %s", c.charset, err)
+			}
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Errorf("%s (split at %d): read error: %s", c.charset, i, err)
+				continue
+			}
+			if string(got) != c.want {
+				t.Errorf("%s (split at %d): got %q, want %q", c.charset, i, got, c.want)
+			}
+		}
+	}
+}
+
+func TestNewReaderUnsupportedCharset(t *testing.T) {
+	if _, err := NewReader(strings.NewReader(""), "x-unknown"); err == nil {
+		t.Error("NewReader() with an unknown charset should fail")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	cases := map[string]string{
+		" GB2312 ":   GBK,
+		"x-gbk":      GBK,
+		"GB18030":    GB18030,
+		"big5-hkscs": BIG5,
+		"ISO-8859-1": WINDOWS1252,
+		"UTF8":       UTF8,
+		"Shift_JIS":  "shift_jis",
+		"x-euc-jp":   "euc-jp",
+		"korean":     "euc-kr",
+		"latin2":     "iso-8859-2",
+		"koi8":       "koi8-r",
+		"x-unknown":  "",
+	}
+	for label, want := range cases {
+		if got := Lookup(label); got != want {
+			t.Errorf("Lookup(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
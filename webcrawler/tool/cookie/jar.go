@@ -0,0 +1,260 @@
+package cookie
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie条目。它包含了还原一个Cookie所需的全部信息。
+type Entry struct {
+	Name     string    `json:"name"`               // 名称。
+	Value    string    `json:"value"`              // 值。
+	Domain   string    `json:"domain"`             // 域名。不含开头的“.”。
+	Path     string    `json:"path"`               // 路径。
+	HostOnly bool      `json:"hostOnly,omitempty"` // 是否只发送给与域名完全相同的主机（而不包括其子域名）。
+	Secure   bool      `json:"secure,omitempty"`   // 是否只通过HTTPS发送。
+	HttpOnly bool      `json:"httpOnly,omitempty"` // 是否为HttpOnly的。
+	Expires  time.Time `json:"expires"`            // 过期时间。零值表示会话Cookie。
+}
+
+// 获得条目的键。域名、路径和名称均相同的条目代表同一个Cookie。
+func (entry Entry) key() string {
+	return entry.Domain + ";" + entry.Path + ";" + entry.Name
+}
+
+// 判断条目在参数now代表的时刻是否已过期。
+func (entry Entry) expired(now time.Time) bool {
+	return !entry.Expires.IsZero() && !entry.Expires.After(now)
+}
+
+// 可以列出和持久化其中的Cookie的Cookie容器的接口类型。其实现必须是并发安全的。
+type Jar interface {
+	http.CookieJar
+	// 获得所有未过期的Cookie条目。
+	Entries() []Entry
+	// 添加Cookie条目。已过期的条目会被忽略。
+	AddEntries(entries ...Entry)
+	// 获得未过期的Cookie条目的数量。
+	Len() int
+	// 把Cookie条目（包括会话Cookie）保存到文件中。若未指定文件，则不做任何事。
+	Save() error
+}
+
+// 创建可持久化的Cookie容器。
+// 参数file代表持久化文件的路径。若该文件已存在，则其中的Cookie会被载入。为空则表示不进行持久化。
+func NewPersistentCookiejar(file string) (Jar, error) {
+	cj, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: &myPublicSuffixList{}})
+	if err != nil {
+		return nil, err
+	}
+	jar := &myJar{
+		jar:     cj,
+		file:    file,
+		entries: make(map[string]Entry),
+	}
+	if file == "" {
+		return jar, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return jar, nil
+		}
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		errMsg := fmt.Sprintf("Invalid cookie file %q: %s", file, err)
+		return nil, errors.New(errMsg)
+	}
+	jar.AddEntries(entries...)
+	return jar, nil
+}
+
+// 可持久化的Cookie容器的实现类型。
+// 由于标准库的Cookie容器无法列出其中的Cookie，它会另行记录被设置的Cookie的属性。
+// 但被记录的只是底层容器确实会返回的Cookie：域名、公共后缀以及是否只发送给同一主机等规则均由底层容器判定，
+// 以免被持久化的条目与实际发送的Cookie不一致。
+type myJar struct {
+	jar     *cookiejar.Jar   // 实际存取Cookie的容器。
+	file    string           // 持久化文件的路径。
+	entries map[string]Entry // Cookie条目的字典。
+	mutex   sync.Mutex       // 互斥锁。
+}
+
+func (jar *myJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	jar.jar.SetCookies(u, cookies)
+	now := time.Now()
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	for _, c := range cookies {
+		jar.record(newEntry(u, c, now))
+	}
+}
+
+func (jar *myJar) Cookies(u *url.URL) []*http.Cookie {
+	return jar.jar.Cookies(u)
+}
+
+func (jar *myJar) Entries() []Entry {
+	now := time.Now()
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	keys := make([]string, 0, len(jar.entries))
+	for key, entry := range jar.entries {
+		// 底层容器已不再返回的Cookie（如已过期的或已被替换的）会被去掉。
+		if entry.expired(now) || !jar.returns(entry, entry.Domain) {
+			delete(jar.entries, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]Entry, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, jar.entries[key])
+	}
+	return entries
+}
+
+func (jar *myJar) AddEntries(entries ...Entry) {
+	now := time.Now()
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	for _, entry := range entries {
+		entry.Domain = strings.ToLower(strings.TrimPrefix(entry.Domain, "."))
+		if entry.Domain == "" || entry.expired(now) {
+			continue
+		}
+		if !strings.HasPrefix(entry.Path, "/") {
+			entry.Path = "/"
+		}
+		c := &http.Cookie{
+			Name:     entry.Name,
+			Value:    entry.Value,
+			Path:     entry.Path,
+			Secure:   entry.Secure,
+			HttpOnly: entry.HttpOnly,
+			Expires:  entry.Expires,
+		}
+		if !entry.HostOnly {
+			c.Domain = entry.Domain
+		}
+		jar.jar.SetCookies(probeUrl(entry.Domain, entry.Path), []*http.Cookie{c})
+		jar.record(entry)
+	}
+}
+
+// 依据底层容器的实际内容记录Cookie条目。调用方必须持有互斥锁。
+// 若底层容器接受了该条目代表的Cookie，则记录它，且其是否只发送给同一主机以底层容器的判定为准。
+// 否则，若底层容器拒绝了它（如域名不合法）而仍保留着同一Cookie的旧值，则旧的条目会被保留，
+// 若底层容器已删除了同一Cookie（如新的Cookie已过期），则旧的条目会被去掉。
+func (jar *myJar) record(entry Entry) {
+	key := entry.key()
+	if jar.returns(entry, entry.Domain) {
+		// 对于IP地址，底层容器总是只把Cookie发送给同一主机。
+		entry.HostOnly = net.ParseIP(entry.Domain) != nil ||
+			!jar.returns(entry, "subdomain."+entry.Domain)
+		jar.entries[key] = entry
+		return
+	}
+	if old, ok := jar.entries[key]; ok && !jar.returns(old, old.Domain) {
+		delete(jar.entries, key)
+	}
+}
+
+// 判断底层容器是否会把与条目的名称和值都相同的Cookie发送给参数host代表的主机上的条目的路径。
+func (jar *myJar) returns(entry Entry, host string) bool {
+	for _, c := range jar.jar.Cookies(probeUrl(host, entry.Path)) {
+		if c.Name == entry.Name && c.Value == entry.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// 获得用于存取主机上的路径的Cookie的URL。
+// 它使用HTTPS，以便包含只通过HTTPS发送的Cookie。
+func probeUrl(host string, path string) *url.URL {
+	// 底层容器只会去掉带有端口号的IPv6地址两侧的方括号，所以需要为IPv6地址加上端口号。
+	if strings.Contains(host, ":") {
+		host = net.JoinHostPort(host, "443")
+	}
+	return &url.URL{Scheme: "https", Host: host, Path: path}
+}
+
+func (jar *myJar) Len() int {
+	return len(jar.Entries())
+}
+
+func (jar *myJar) Save() error {
+	if jar.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(jar.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(jar.file), 0755); err != nil {
+		return err
+	}
+	// 先写入临时文件再重命名，以免中途出错时破坏原有的文件。
+	tmpFile := jar.file + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, jar.file)
+}
+
+// 依据响应的URL和其中的Cookie创建Cookie条目。
+// 条目的域名取自Cookie的Domain属性或URL中的主机名，它是否合法由底层容器判定（参见record方法）。
+func newEntry(u *url.URL, c *http.Cookie, now time.Time) Entry {
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	if domain == "" {
+		domain = strings.ToLower(u.Hostname())
+	}
+	entry := Entry{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   domain,
+		Path:     c.Path,
+		HostOnly: c.Domain == "",
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+	if !strings.HasPrefix(entry.Path, "/") {
+		entry.Path = defaultPath(u.Path)
+	}
+	switch {
+	case c.MaxAge < 0:
+		entry.Expires = now
+	case c.MaxAge > 0:
+		entry.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+	case !c.Expires.IsZero():
+		entry.Expires = c.Expires
+	}
+	return entry
+}
+
+// 获得Cookie的默认路径（参见RFC 6265的5.1.4节）。
+func defaultPath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/"
+	}
+	index := strings.LastIndex(path, "/")
+	if index == 0 {
+		return "/"
+	}
+	return path[:index]
+}
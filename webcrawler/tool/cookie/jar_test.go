@@ -0,0 +1,167 @@
+package cookie
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func mustParseUrl(t *testing.T, rawUrl string) *url.URL {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatalf("url.Parse(%q) error: %s", rawUrl, err)
+	}
+	return u
+}
+
+// 获得发送给URL的Cookie的“名称=值”形式的字符串。
+func cookieStrings(jar http.CookieJar, u *url.URL) []string {
+	var strs []string
+	for _, c := range jar.Cookies(u) {
+		strs = append(strs, c.Name+"="+c.Value)
+	}
+	return strs
+}
+
+// 去掉条目的过期时间中的单调时钟读数和时区，以便比较。
+func normalizeExpires(entries []Entry) []Entry {
+	for i := range entries {
+		entries[i].Expires = entries[i].Expires.Round(0).UTC()
+	}
+	return entries
+}
+
+func TestJarEntries(t *testing.T) {
+	jar, err := NewPersistentCookiejar("")
+	if err != nil {
+		t.Fatalf("NewPersistentCookiejar() error: %s", err)
+	}
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	jar.SetCookies(mustParseUrl(t, "http://www.example.com/app/page"), []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".Example.com", Path: "/", Expires: expires},
+		{Name: "secure", Value: "3", Path: "/", Secure: true, HttpOnly: true},
+		// 以下Cookie均会被底层容器拒绝。
+		{Name: "suffix", Value: "4", Domain: "com"},
+		{Name: "foreign", Value: "5", Domain: "other.com"},
+		{Name: "expired", Value: "6", MaxAge: -1},
+	})
+	// 主机为IP地址时，带有Domain属性的Cookie也只会被发送给同一主机。
+	jar.SetCookies(mustParseUrl(t, "http://127.0.0.1:8080/"), []*http.Cookie{
+		{Name: "ip", Value: "7", Domain: "127.0.0.1"},
+		{Name: "otherIp", Value: "8", Domain: "127.0.0.2"},
+	})
+	want := []Entry{
+		{Name: "ip", Value: "7", Domain: "127.0.0.1", Path: "/", HostOnly: true},
+		{Name: "domain", Value: "2", Domain: "example.com", Path: "/", Expires: expires},
+		{Name: "secure", Value: "3", Domain: "www.example.com", Path: "/", HostOnly: true, Secure: true, HttpOnly: true},
+		{Name: "host", Value: "1", Domain: "www.example.com", Path: "/app", HostOnly: true},
+	}
+	if entries := jar.Entries(); !reflect.DeepEqual(entries, want) {
+		t.Errorf("Unexpected entries:\n got %+v\nwant %+v", entries, want)
+	}
+	if jar.Len() != len(want) {
+		t.Errorf("Len() = %d, want %d", jar.Len(), len(want))
+	}
+
+	// 被拒绝的删除不影响原有的条目，被接受的删除会去掉它。
+	jar.SetCookies(mustParseUrl(t, "http://other.com/"), []*http.Cookie{
+		{Name: "domain", Value: "", Domain: "example.com", Path: "/", MaxAge: -1},
+	})
+	if jar.Len() != len(want) {
+		t.Errorf("A rejected deletion changed the entries: %+v", jar.Entries())
+	}
+	jar.SetCookies(mustParseUrl(t, "http://example.com/"), []*http.Cookie{
+		{Name: "domain", Value: "", Domain: "example.com", Path: "/", MaxAge: -1},
+		{Name: "host", Value: "9", Path: "/app"},
+	})
+	want = []Entry{
+		want[0],
+		{Name: "host", Value: "9", Domain: "example.com", Path: "/app", HostOnly: true},
+		want[2], want[3],
+	}
+	if entries := jar.Entries(); !reflect.DeepEqual(entries, want) {
+		t.Errorf("Unexpected entries after the update:\n got %+v\nwant %+v", entries, want)
+	}
+}
+
+func TestPersistentCookiejarSaveAndReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sessions", "example.json")
+	jar, err := NewPersistentCookiejar(file)
+	if err != nil {
+		t.Fatalf("NewPersistentCookiejar() error: %s", err)
+	}
+	jar.SetCookies(mustParseUrl(t, "https://www.example.com/"), []*http.Cookie{
+		{Name: "session", Value: "s"},
+		{Name: "domain", Value: "d", Domain: "example.com", MaxAge: 3600},
+		{Name: "secure", Value: "x", Secure: true},
+	})
+	jar.SetCookies(mustParseUrl(t, "http://[::1]:8080/"), []*http.Cookie{{Name: "ip6", Value: "6"}})
+	if err := jar.Save(); err != nil {
+		t.Fatalf("Save() error: %s", err)
+	}
+	if _, err := os.Stat(file + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("The temporary file was not renamed: %v", err)
+	}
+	reloaded, err := NewPersistentCookiejar(file)
+	if err != nil {
+		t.Fatalf("Reloading error: %s", err)
+	}
+	if saved, loaded := normalizeExpires(jar.Entries()), normalizeExpires(reloaded.Entries()); !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("Reloaded entries differ:\n got %+v\nwant %+v", loaded, saved)
+	}
+	cases := []struct {
+		url  string
+		want []string
+	}{
+		{"https://www.example.com/", []string{"domain=d", "secure=x", "session=s"}},
+		{"http://www.example.com/", []string{"domain=d", "session=s"}},
+		{"http://sub.example.com/", []string{"domain=d"}},
+		{"http://[::1]:8080/", []string{"ip6=6"}},
+	}
+	for _, c := range cases {
+		got := cookieStrings(reloaded, mustParseUrl(t, c.url))
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Cookies(%s) = %q, want %q", c.url, got, c.want)
+		}
+	}
+
+	if err := os.WriteFile(file, []byte("not json"), 0600); err != nil {
+		t.Fatalf("WriteFile() error: %s", err)
+	}
+	if _, err := NewPersistentCookiejar(file); err == nil {
+		t.Error("An invalid cookie file should be rejected")
+	}
+	if jar, err := NewPersistentCookiejar(""); err != nil || jar.Save() != nil {
+		t.Errorf("A jar without a file should not fail to save: %v", err)
+	}
+}
+
+func TestAddEntries(t *testing.T) {
+	jar, _ := NewPersistentCookiejar("")
+	jar.AddEntries(
+		Entry{Name: "a", Value: "1", Domain: ".example.com"},
+		Entry{Name: "b", Value: "2", Domain: "www.example.com", Path: "x", HostOnly: true},
+		Entry{Name: "old", Value: "3", Domain: "example.com", Expires: time.Now().Add(-time.Hour)},
+		Entry{Name: "nodomain", Value: "4"},
+		// 底层容器会把公共后缀本身上的Cookie当作只发送给该主机的Cookie。
+		Entry{Name: "suffix", Value: "5", Domain: "co.uk"},
+	)
+	want := []Entry{
+		{Name: "suffix", Value: "5", Domain: "co.uk", Path: "/", HostOnly: true},
+		{Name: "a", Value: "1", Domain: "example.com", Path: "/"},
+		{Name: "b", Value: "2", Domain: "www.example.com", Path: "/", HostOnly: true},
+	}
+	if entries := jar.Entries(); !reflect.DeepEqual(entries, want) {
+		t.Errorf("Unexpected entries:\n got %+v\nwant %+v", entries, want)
+	}
+	if got := cookieStrings(jar, mustParseUrl(t, "http://api.example.com/")); !reflect.DeepEqual(got, []string{"a=1"}) {
+		t.Errorf("Unexpected cookies of a subdomain: %q", got)
+	}
+}
@@ -0,0 +1,78 @@
+package cookie
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Netscape格式中HttpOnly的Cookie所在行的前缀。
+const httpOnlyPrefix = "#HttpOnly_"
+
+// 从Netscape格式的Cookie文件（即浏览器扩展和curl等工具导出的cookies.txt）中载入Cookie条目。
+func LoadNetscape(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseNetscape(file)
+}
+
+// 解析Netscape格式的Cookie文件的内容。
+// 每行代表一个Cookie，依次包含以制表符分隔的域名、是否包含子域名（TRUE或FALSE）、路径、
+// 是否只通过HTTPS发送、过期时间（Unix时间戳，0代表会话Cookie）、名称和值。
+// 以“#”开始的行（以“#HttpOnly_”开始的除外）和空行会被忽略。
+func ParseNetscape(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, httpOnlyPrefix) {
+			line = line[len(httpOnlyPrefix):]
+			httpOnly = true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		// 值为空时，某些工具会省略最后一个字段。
+		if len(fields) == 6 {
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			errMsg := fmt.Sprintf("Invalid cookie line %d: %d fields", lineNumber, len(fields))
+			return nil, errors.New(errMsg)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			errMsg := fmt.Sprintf("Invalid expiration time in cookie line %d: %q", lineNumber, fields[4])
+			return nil, errors.New(errMsg)
+		}
+		entry := Entry{
+			Name:     fields[5],
+			Value:    fields[6],
+			Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			Path:     fields[2],
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			entry.Expires = time.Unix(expires, 0)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
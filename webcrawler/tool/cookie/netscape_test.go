@@ -0,0 +1,42 @@
+package cookie
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNetscape(t *testing.T) {
+	content := "# Netscape HTTP Cookie File\n" +
+		"\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tsid\tabc\n" +
+		"#HttpOnly_www.example.com\tFALSE\t/app\tTRUE\t2000000000\ttoken\tx=y\r\n" +
+		"Example.org\tfalse\t/\ttrue\t0\tempty\n"
+	entries, err := ParseNetscape(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ParseNetscape() error: %s", err)
+	}
+	want := []Entry{
+		{Name: "sid", Value: "abc", Domain: "example.com", Path: "/"},
+		{Name: "token", Value: "x=y", Domain: "www.example.com", Path: "/app",
+			HostOnly: true, Secure: true, HttpOnly: true, Expires: time.Unix(2000000000, 0)},
+		{Name: "empty", Domain: "example.org", Path: "/", HostOnly: true, Secure: true},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Unexpected entries:\n got %+v\nwant %+v", entries, want)
+	}
+}
+
+func TestParseNetscapeErrors(t *testing.T) {
+	cases := map[string]string{
+		"too few fields":     "example.com\tTRUE\t/\tFALSE\t0\n",
+		"too many fields":    "example.com\tTRUE\t/\tFALSE\t0\ta\tb\tc\n",
+		"invalid expiration": "example.com\tTRUE\t/\tFALSE\tsoon\ta\tb\n",
+	}
+	for name, content := range cases {
+		if _, err := ParseNetscape(strings.NewReader(content)); err == nil {
+			t.Errorf("%s: ParseNetscape() should fail", name)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package form
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	base "webcrawler/base"
+)
+
+// 表单的编码方式。
+const (
+	ENCTYPE_URLENCODED = "application/x-www-form-urlencoded" // 默认的编码方式。
+	ENCTYPE_MULTIPART  = "multipart/form-data"               // 多部分的编码方式。
+	ENCTYPE_TEXT_PLAIN = "text/plain"                        // 纯文本的编码方式。
+)
+
+// 表单字段。
+type Field struct {
+	Name  string // 名称。
+	Value string // 值。
+}
+
+// HTML表单。它包含了提交表单所需的全部信息，且其字段的默认值与浏览器的行为一致。
+type Form struct {
+	Action  *url.URL // 提交的目标URL。它已被解析为绝对URL。
+	Method  string   // 提交方法，即GET或POST。
+	Enctype string   // 编码方式。
+	Fields  []Field  // 会被提交的字段。它们保持其在文档中的顺序。
+	Submits []Field  // 带有名称的提交按钮。只有被点击（参见Click方法）的按钮才会被提交。
+}
+
+// 查找文档中的所有表单。参数baseUrl代表文档的URL，表单的相对目标URL会据此被解析。
+// 参数doc可以是html.Parse函数的结果，也可以是goquery文档的Nodes字段中的节点。
+func Find(doc *html.Node, baseUrl *url.URL) []*Form {
+	var forms []*Form
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.DataAtom == atom.Form {
+			if form, err := Parse(node, baseUrl); err == nil {
+				forms = append(forms, form)
+			}
+			return
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(doc)
+	return forms
+}
+
+// 解析表单元素。参数baseUrl代表文档的URL，表单的相对目标URL会据此被解析。
+// 被禁用的控件、未被选中的复选框和单选按钮以及没有名称的控件都不会被提交。
+func Parse(formNode *html.Node, baseUrl *url.URL) (*Form, error) {
+	if formNode == nil || formNode.Type != html.ElementNode || formNode.DataAtom != atom.Form {
+		return nil, errors.New("The node is not a form element!")
+	}
+	if baseUrl == nil {
+		return nil, errors.New("The base URL is nil!")
+	}
+	action := baseUrl
+	if rawAction := strings.TrimSpace(attr(formNode, "action")); rawAction != "" {
+		actionUrl, err := url.Parse(rawAction)
+		if err != nil {
+			return nil, err
+		}
+		action = baseUrl.ResolveReference(actionUrl)
+	}
+	form := &Form{
+		Action:  action,
+		Method:  http.MethodGet,
+		Enctype: ENCTYPE_URLENCODED,
+	}
+	if strings.EqualFold(attr(formNode, "method"), "post") {
+		form.Method = http.MethodPost
+	}
+	switch enctype := strings.ToLower(attr(formNode, "enctype")); enctype {
+	case ENCTYPE_MULTIPART, ENCTYPE_TEXT_PLAIN:
+		form.Enctype = enctype
+	}
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			// 被禁用的fieldset元素中的控件也都是被禁用的。
+			if hasAttr(child, "disabled") {
+				continue
+			}
+			name := attr(child, "name")
+			switch child.DataAtom {
+			case atom.Input, atom.Button, atom.Textarea, atom.Select:
+				if name == "" {
+					continue
+				}
+			}
+			switch child.DataAtom {
+			case atom.Input:
+				form.addInput(child, name)
+			case atom.Button:
+				// 按钮的默认类型是submit。
+				buttonType := strings.ToLower(attr(child, "type"))
+				if buttonType == "" || buttonType == "submit" {
+					form.Submits = append(form.Submits, Field{Name: name, Value: attr(child, "value")})
+				}
+			case atom.Textarea:
+				// 紧跟在开始标签之后的换行符已被HTML解析器忽略，其后的换行符则属于默认值。
+				form.Fields = append(form.Fields, Field{Name: name, Value: text(child)})
+			case atom.Select:
+				for _, value := range selectedOptions(child) {
+					form.Fields = append(form.Fields, Field{Name: name, Value: value})
+				}
+			default:
+				visit(child)
+			}
+		}
+	}
+	visit(formNode)
+	return form, nil
+}
+
+// 添加输入控件对应的字段。
+func (form *Form) addInput(node *html.Node, name string) {
+	value := attr(node, "value")
+	switch strings.ToLower(attr(node, "type")) {
+	case "checkbox", "radio":
+		if !hasAttr(node, "checked") {
+			return
+		}
+		if !hasAttr(node, "value") {
+			value = "on"
+		}
+	case "submit":
+		form.Submits = append(form.Submits, Field{Name: name, Value: value})
+		return
+	case "image", "button", "reset":
+		return
+	case "file":
+		// 无法提交文件内容，只能提交空的文件名。
+		value = ""
+	}
+	form.Fields = append(form.Fields, Field{Name: name, Value: value})
+}
+
+// 获得下拉列表中被选中的选项的值。
+// 若没有选项被选中，则单选的下拉列表的第一个未被禁用的选项会被视为被选中的。
+func selectedOptions(selectNode *html.Node) []string {
+	var values []string
+	var first *html.Node
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.DataAtom {
+			case atom.Option:
+				if hasAttr(child, "disabled") {
+					continue
+				}
+				if first == nil {
+					first = child
+				}
+				if hasAttr(child, "selected") {
+					values = append(values, optionValue(child))
+				}
+			case atom.Optgroup:
+				if !hasAttr(child, "disabled") {
+					visit(child)
+				}
+			}
+		}
+	}
+	visit(selectNode)
+	if len(values) == 0 && first != nil && !hasAttr(selectNode, "multiple") {
+		values = append(values, optionValue(first))
+	}
+	if len(values) > 1 && !hasAttr(selectNode, "multiple") {
+		values = values[len(values)-1:]
+	}
+	return values
+}
+
+// 获得选项的值。若其没有value属性，则使用其文本。
+func optionValue(option *html.Node) string {
+	if value, ok := lookupAttr(option, "value"); ok {
+		return value
+	}
+	return strings.Join(strings.Fields(text(option)), " ")
+}
+
+// 获得字段的第一个值。若字段不存在，则返回空字符串。
+func (form *Form) Get(name string) string {
+	for _, field := range form.Fields {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// 设置字段的值。已有的同名字段会被替换（位于第一个同名字段的位置），不存在时则被追加到末尾。
+// 参数values为空时，相当于调用Del方法。
+func (form *Form) Set(name string, values ...string) {
+	fields := make([]Field, 0, len(form.Fields)+len(values))
+	inserted := false
+	for _, field := range form.Fields {
+		if field.Name != name {
+			fields = append(fields, field)
+			continue
+		}
+		if !inserted {
+			for _, value := range values {
+				fields = append(fields, Field{Name: name, Value: value})
+			}
+			inserted = true
+		}
+	}
+	if !inserted {
+		for _, value := range values {
+			fields = append(fields, Field{Name: name, Value: value})
+		}
+	}
+	form.Fields = fields
+}
+
+// 追加字段。
+func (form *Form) Add(name string, value string) {
+	form.Fields = append(form.Fields, Field{Name: name, Value: value})
+}
+
+// 删除字段。
+func (form *Form) Del(name string) {
+	form.Set(name)
+}
+
+// 点击提交按钮，即把该按钮对应的字段追加到会被提交的字段中。
+// 参数name代表按钮的名称。若其为空，则点击第一个提交按钮。
+func (form *Form) Click(name string) error {
+	for _, submit := range form.Submits {
+		if name == "" || submit.Name == name {
+			form.Fields = append(form.Fields, submit)
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprintf("No such submit button %q!", name))
+}
+
+// 获得会被提交的字段的值的字典。
+func (form *Form) Values() url.Values {
+	values := make(url.Values)
+	for _, field := range form.Fields {
+		values.Add(field.Name, field.Value)
+	}
+	return values
+}
+
+// 按照编码方式对字段进行编码。它返回编码之后的内容以及相应的Content-Type报头的值。
+func (form *Form) Encode() ([]byte, string, error) {
+	switch form.Enctype {
+	case ENCTYPE_MULTIPART:
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		// 使用由字段决定的分隔符，以使同样的表单总会被编码为同样的请求体，从而可以被去重。
+		sum := sha1.Sum([]byte(encodeFields(form.Fields)))
+		if err := writer.SetBoundary("WebcrawlerFormBoundary" + hex.EncodeToString(sum[:8])); err != nil {
+			return nil, "", err
+		}
+		for _, field := range form.Fields {
+			if err := writer.WriteField(field.Name, field.Value); err != nil {
+				return nil, "", err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), writer.FormDataContentType(), nil
+	case ENCTYPE_TEXT_PLAIN:
+		var buf bytes.Buffer
+		for _, field := range form.Fields {
+			buf.WriteString(field.Name + "=" + field.Value + "\r\n")
+		}
+		return buf.Bytes(), ENCTYPE_TEXT_PLAIN, nil
+	default:
+		return []byte(encodeFields(form.Fields)), ENCTYPE_URLENCODED, nil
+	}
+}
+
+// 以URL编码的形式对字段进行编码。与url.Values的Encode方法不同，它会保持字段的顺序。
+func encodeFields(fields []Field) string {
+	pairs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		pairs = append(pairs, url.QueryEscape(field.Name)+"="+url.QueryEscape(field.Value))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// 创建提交表单的请求。参数overrides中的字段会覆盖表单中的同名字段（参见Set方法）。
+// GET表单的字段会替换目标URL中的查询参数；POST表单的字段则会按照编码方式被编码为请求体。
+// 参数depth代表请求的深度。
+func (form *Form) NewRequest(overrides url.Values, depth uint32) (*base.Request, error) {
+	if form.Action == nil {
+		return nil, errors.New("The form action is nil!")
+	}
+	submitted := *form
+	submitted.Fields = append([]Field(nil), form.Fields...)
+	for name, values := range overrides {
+		submitted.Set(name, values...)
+	}
+	target := *form.Action
+	target.Fragment = ""
+	if submitted.Method != http.MethodPost {
+		target.RawQuery = encodeFields(submitted.Fields)
+		httpReq, err := http.NewRequest(http.MethodGet, target.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		return base.NewRequest(httpReq, depth), nil
+	}
+	body, contentType, err := submitted.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return base.NewRequestWithBody(http.MethodPost, target.String(), body, contentType, depth)
+}
+
+// 获得元素的属性值。
+func attr(node *html.Node, key string) string {
+	value, _ := lookupAttr(node, key)
+	return value
+}
+
+// 查找元素的属性。
+func lookupAttr(node *html.Node, key string) (string, bool) {
+	for _, a := range node.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// 判断元素是否带有某个属性。
+func hasAttr(node *html.Node, key string) bool {
+	_, ok := lookupAttr(node, key)
+	return ok
+}
+
+// 获得节点中的文本。
+func text(node *html.Node) string {
+	var buf strings.Builder
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			buf.WriteString(node.Data)
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(node)
+	return buf.String()
+}
@@ -0,0 +1,224 @@
+package form
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const formPage = `<html><body>
+<form id="login" action="/login?next=1#top" method="POST">
+  <input name="user" value="alice">
+  <input type="password" name="pass">
+  <input type="hidden" name="csrf" value="t0k">
+  <input type="checkbox" name="remember" checked>
+  <input type="checkbox" name="newsletter" value="yes">
+  <input type="checkbox" name="terms" value="agreed" checked>
+  <input type="radio" name="plan" value="free">
+  <input type="radio" name="plan" value="pro" checked>
+  <input type="radio" name="mode" checked>
+  <input type="text" value="no name">
+  <input type="file" name="avatar" value="ignored.png">
+  <input type="image" name="img" src="x.png">
+  <input type="reset" name="reset">
+  <input type="button" name="btn" value="b">
+  <input name="off" value="x" disabled>
+  <fieldset disabled><input name="inFieldset" value="x"><select name="selInFieldset"><option>a</option></select></fieldset>
+  <fieldset><input name="inEnabledFieldset" value="y"></fieldset>
+  <textarea name="bio">
+Hello
+world</textarea>
+  <textarea name="blank">
+
+second line</textarea>
+  <select name="country"><option disabled>--</option><option value="cn">China</option><option value="us">USA</option></select>
+  <select name="lang"><option value="go">Go</option><option value="rust" selected>Rust</option></select>
+  <select name="multi" multiple><option value="a">A</option><option value="b">B</option></select>
+  <select name="tags" multiple><option selected>  x   y </option><optgroup><option value="z" selected>Z</option></optgroup><optgroup disabled><option value="w" selected>W</option></optgroup></select>
+  <select name="empty"></select>
+  <button name="go" value="1">Go</button>
+  <button>Unnamed</button>
+  <button type="button" name="noop">Noop</button>
+  <input type="submit" name="save" value="Save">
+</form>
+<form action="search"><input name="q" value="a b"></form>
+</body></html>`
+
+func parseForms(t *testing.T) []*Form {
+	doc, err := html.Parse(strings.NewReader(formPage))
+	if err != nil {
+		t.Fatalf("html.Parse() error: %s", err)
+	}
+	baseUrl, _ := url.Parse("http://example.com/account/page.html")
+	forms := Find(doc, baseUrl)
+	if len(forms) != 2 {
+		t.Fatalf("Found %d forms, want 2", len(forms))
+	}
+	return forms
+}
+
+func TestParse(t *testing.T) {
+	forms := parseForms(t)
+	form := forms[0]
+	if form.Action.String() != "http://example.com/login?next=1#top" ||
+		form.Method != http.MethodPost || form.Enctype != ENCTYPE_URLENCODED {
+		t.Errorf("Unexpected form: action=%s, method=%s, enctype=%s", form.Action, form.Method, form.Enctype)
+	}
+	wantFields := []Field{
+		{"user", "alice"},
+		{"pass", ""},
+		{"csrf", "t0k"},
+		// 没有value属性的复选框和单选按钮的值为“on”。
+		{"remember", "on"},
+		{"terms", "agreed"},
+		{"plan", "pro"},
+		{"mode", "on"},
+		{"avatar", ""},
+		{"inEnabledFieldset", "y"},
+		// 紧跟在开始标签之后的一个换行符会被忽略。
+		{"bio", "Hello\nworld"},
+		{"blank", "\nsecond line"},
+		// 单选的下拉列表在没有选项被选中时选择第一个未被禁用的选项。
+		{"country", "cn"},
+		{"lang", "rust"},
+		{"tags", "x y"},
+		{"tags", "z"},
+	}
+	if !reflect.DeepEqual(form.Fields, wantFields) {
+		t.Errorf("Unexpected fields:\n got %v\nwant %v", form.Fields, wantFields)
+	}
+	wantSubmits := []Field{{"go", "1"}, {"save", "Save"}}
+	if !reflect.DeepEqual(form.Submits, wantSubmits) {
+		t.Errorf("Unexpected submits: %v", form.Submits)
+	}
+
+	search := forms[1]
+	if search.Action.String() != "http://example.com/account/search" || search.Method != http.MethodGet {
+		t.Errorf("Unexpected search form: action=%s, method=%s", search.Action, search.Method)
+	}
+	if _, err := Parse(&html.Node{Type: html.ElementNode, Data: "div"}, search.Action); err == nil {
+		t.Error("Parse() of a non-form element should fail")
+	}
+}
+
+func TestFieldOperations(t *testing.T) {
+	form := &Form{Fields: []Field{{"a", "1"}, {"b", "2"}, {"a", "3"}}}
+	form.Set("a", "x", "y")
+	form.Add("c", "4")
+	want := []Field{{"a", "x"}, {"a", "y"}, {"b", "2"}, {"c", "4"}}
+	if !reflect.DeepEqual(form.Fields, want) {
+		t.Errorf("Unexpected fields after Set and Add: %v", form.Fields)
+	}
+	form.Del("a")
+	form.Set("d", "5")
+	if form.Get("a") != "" || form.Get("d") != "5" || len(form.Fields) != 3 {
+		t.Errorf("Unexpected fields after Del and Set: %v", form.Fields)
+	}
+	form.Submits = []Field{{"first", "1"}, {"second", "2"}}
+	if err := form.Click("second"); err != nil || form.Get("second") != "2" {
+		t.Errorf("Click() = %v, fields: %v", err, form.Fields)
+	}
+	if err := form.Click(""); err != nil || form.Get("first") != "1" {
+		t.Errorf("Click(\"\") = %v, fields: %v", err, form.Fields)
+	}
+	if err := form.Click("missing"); err == nil {
+		t.Error("Click() of a missing button should fail")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	fields := []Field{{"b", "x y"}, {"a", "&=1"}, {"b", "中"}}
+	form := &Form{Enctype: ENCTYPE_URLENCODED, Fields: fields}
+	body, contentType, err := form.Encode()
+	if err != nil || string(body) != "b=x+y&a=%26%3D1&b=%E4%B8%AD" || contentType != ENCTYPE_URLENCODED {
+		t.Errorf("Encode() = %q, %q, %v", body, contentType, err)
+	}
+	form.Enctype = ENCTYPE_TEXT_PLAIN
+	body, contentType, err = form.Encode()
+	if err != nil || string(body) != "b=x y\r\na=&=1\r\nb=中\r\n" || contentType != ENCTYPE_TEXT_PLAIN {
+		t.Errorf("Encode() = %q, %q, %v", body, contentType, err)
+	}
+}
+
+func TestEncodeMultipart(t *testing.T) {
+	form := &Form{Enctype: ENCTYPE_MULTIPART, Fields: []Field{{"a", "1"}, {"b", "two\r\nlines"}, {"a", "3"}}}
+	body, contentType, err := form.Encode()
+	if err != nil {
+		t.Fatalf("Encode() error: %s", err)
+	}
+	// 同样的表单总会被编码为同样的请求体。
+	same := &Form{Enctype: ENCTYPE_MULTIPART, Fields: append([]Field(nil), form.Fields...)}
+	body2, contentType2, _ := same.Encode()
+	if !bytes.Equal(body, body2) || contentType != contentType2 {
+		t.Error("Encoding the same form twice gave different results")
+	}
+	// 字段不同时分隔符也不同。
+	same.Set("a", "2")
+	if _, contentType3, _ := same.Encode(); contentType3 == contentType {
+		t.Error("Different forms should use different boundaries")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != ENCTYPE_MULTIPART || !strings.HasPrefix(params["boundary"], "WebcrawlerFormBoundary") {
+		t.Fatalf("Unexpected content type %q: %v", contentType, err)
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	var got []Field
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart() error: %s", err)
+		}
+		value, _ := io.ReadAll(part)
+		got = append(got, Field{part.FormName(), string(value)})
+	}
+	if !reflect.DeepEqual(got, form.Fields) {
+		t.Errorf("Unexpected parts: %v", got)
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	forms := parseForms(t)
+	login := forms[0]
+	overrides := url.Values{"pass": {"secret"}, "extra": {"e"}}
+	req, err := login.NewRequest(overrides, 2)
+	if err != nil {
+		t.Fatalf("NewRequest() error: %s", err)
+	}
+	httpReq := req.HttpReq()
+	if httpReq.Method != http.MethodPost || httpReq.URL.String() != "http://example.com/login?next=1" ||
+		req.ContentType() != ENCTYPE_URLENCODED || req.Depth() != 2 {
+		t.Errorf("Unexpected request: %s %s (%s, depth=%d)", httpReq.Method, httpReq.URL, req.ContentType(), req.Depth())
+	}
+	values, err := url.ParseQuery(string(req.Body()))
+	if err != nil || values.Get("pass") != "secret" || values.Get("extra") != "e" || values.Get("user") != "alice" {
+		t.Errorf("Unexpected body %q", req.Body())
+	}
+	// 覆盖的字段不影响表单本身。
+	if login.Get("pass") != "" || login.Get("extra") != "" {
+		t.Errorf("NewRequest() modified the form: %v", login.Fields)
+	}
+
+	search := forms[1]
+	search.Action.RawQuery = "old=1"
+	req, err = search.NewRequest(url.Values{"q": {"go"}}, 0)
+	if err != nil {
+		t.Fatalf("NewRequest() error: %s", err)
+	}
+	if req.Method() != http.MethodGet || req.HttpReq().URL.String() != "http://example.com/account/search?q=go" || req.Body() != nil {
+		t.Errorf("Unexpected GET request: %s %s, body %q", req.Method(), req.HttpReq().URL, req.Body())
+	}
+	if _, err := (&Form{}).NewRequest(nil, 0); err == nil {
+		t.Error("NewRequest() without an action should fail")
+	}
+}
@@ -0,0 +1,598 @@
+package xpath
+
+import (
+	"golang.org/x/net/html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 值的类型。表达式的值只可能是节点集（[]nodeRef）、布尔值（bool）、数字（float64）或字符串（string）。
+type valueKind int
+
+const (
+	kindNodeSet valueKind = iota
+	kindBoolean
+	kindNumber
+	kindString
+)
+
+// 表达式的接口类型。由于不支持变量引用，表达式的值的类型在编译时就可以确定。
+type expr interface {
+	// 获得值的类型。
+	kind() valueKind
+	// 在上下文中求值。
+	eval(ctx *evalContext) interface{}
+}
+
+// 节点的引用。HTML节点树中没有属性节点，因此属性节点由其所属的元素和属性的序号表示。
+type nodeRef struct {
+	node *html.Node // 节点，或属性所属的元素。
+	attr int        // 属性的序号。为-1则表示节点本身。
+}
+
+// 获得节点本身的引用。
+func refOf(node *html.Node) nodeRef {
+	return nodeRef{node: node, attr: -1}
+}
+
+// 被求值的文档。
+type document struct {
+	root  *html.Node         // 根节点。
+	order map[*html.Node]int // 节点在文档中的序号。它会在第一次需要排序时被生成。
+}
+
+// 获得节点在文档中的序号。
+func (doc *document) orderOf(node *html.Node) int {
+	if doc.order == nil {
+		doc.order = make(map[*html.Node]int)
+		var visit func(node *html.Node)
+		visit = func(node *html.Node) {
+			doc.order[node] = len(doc.order)
+			for child := node.FirstChild; child != nil; child = child.NextSibling {
+				visit(child)
+			}
+		}
+		visit(doc.root)
+	}
+	return doc.order[node]
+}
+
+// 把节点按照文档顺序排列并去掉重复的节点。属性节点位于其所属的元素之后、该元素的子节点之前。
+func (doc *document) sortUnique(nodes []nodeRef) []nodeRef {
+	if len(nodes) < 2 {
+		return nodes
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		oi, oj := doc.orderOf(nodes[i].node), doc.orderOf(nodes[j].node)
+		if oi != oj {
+			return oi < oj
+		}
+		return nodes[i].attr < nodes[j].attr
+	})
+	unique := nodes[:1]
+	for _, node := range nodes[1:] {
+		if node != unique[len(unique)-1] {
+			unique = append(unique, node)
+		}
+	}
+	return unique
+}
+
+// 求值的上下文。
+type evalContext struct {
+	node nodeRef   // 上下文节点。
+	pos  int       // 上下文位置。
+	size int       // 上下文大小。
+	doc  *document // 被求值的文档。
+}
+
+// 字符串字面量。
+type literalExpr struct {
+	value string
+}
+
+func (e *literalExpr) kind() valueKind { return kindString }
+
+func (e *literalExpr) eval(ctx *evalContext) interface{} { return e.value }
+
+// 数字。
+type numberExpr struct {
+	value float64
+}
+
+func (e *numberExpr) kind() valueKind { return kindNumber }
+
+func (e *numberExpr) eval(ctx *evalContext) interface{} { return e.value }
+
+// 取负运算。
+type negateExpr struct {
+	operand expr
+}
+
+func (e *negateExpr) kind() valueKind { return kindNumber }
+
+func (e *negateExpr) eval(ctx *evalContext) interface{} {
+	return -toNumber(e.operand.eval(ctx))
+}
+
+// 二元运算。
+type binaryExpr struct {
+	op    string // 运算符。
+	left  expr   // 左操作数。
+	right expr   // 右操作数。
+}
+
+func (e *binaryExpr) kind() valueKind {
+	switch e.op {
+	case "+", "-", "*", "div", "mod":
+		return kindNumber
+	}
+	return kindBoolean
+}
+
+func (e *binaryExpr) eval(ctx *evalContext) interface{} {
+	switch e.op {
+	case "or":
+		return toBoolean(e.left.eval(ctx)) || toBoolean(e.right.eval(ctx))
+	case "and":
+		return toBoolean(e.left.eval(ctx)) && toBoolean(e.right.eval(ctx))
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compare(e.op, e.left.eval(ctx), e.right.eval(ctx))
+	}
+	left := toNumber(e.left.eval(ctx))
+	right := toNumber(e.right.eval(ctx))
+	switch e.op {
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "*":
+		return left * right
+	case "div":
+		return left / right
+	default:
+		return math.Mod(left, right)
+	}
+}
+
+// 比较两个值（参见XPath 1.0规范的3.4节）。
+// 若有一个值是节点集，则只要其中有一个节点的字符串值与另一个值的比较结果为true，结果就为true。
+func compare(op string, left interface{}, right interface{}) bool {
+	leftNodes, leftIsNodeSet := left.([]nodeRef)
+	rightNodes, rightIsNodeSet := right.([]nodeRef)
+	switch {
+	case leftIsNodeSet && rightIsNodeSet:
+		for _, l := range leftNodes {
+			leftValue := stringValue(l)
+			for _, r := range rightNodes {
+				if compareAtoms(op, leftValue, stringValue(r)) {
+					return true
+				}
+			}
+		}
+		return false
+	case leftIsNodeSet:
+		if b, ok := right.(bool); ok {
+			return compareAtoms(op, len(leftNodes) > 0, b)
+		}
+		for _, l := range leftNodes {
+			if compareAtoms(op, stringValue(l), right) {
+				return true
+			}
+		}
+		return false
+	case rightIsNodeSet:
+		if b, ok := left.(bool); ok {
+			return compareAtoms(op, b, len(rightNodes) > 0)
+		}
+		for _, r := range rightNodes {
+			if compareAtoms(op, left, stringValue(r)) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareAtoms(op, left, right)
+}
+
+// 比较两个不是节点集的值。
+// 对于“=”和“!=”，若有一个值是布尔值，则按布尔值比较，否则若有一个值是数字，则按数字比较，否则按字符串比较。
+// 对于其他比较运算符，总是按数字比较。
+func compareAtoms(op string, left interface{}, right interface{}) bool {
+	if op == "=" || op == "!=" {
+		var equal bool
+		_, leftIsBool := left.(bool)
+		_, rightIsBool := right.(bool)
+		_, leftIsNumber := left.(float64)
+		_, rightIsNumber := right.(float64)
+		switch {
+		case leftIsBool || rightIsBool:
+			equal = toBoolean(left) == toBoolean(right)
+		case leftIsNumber || rightIsNumber:
+			equal = toNumber(left) == toNumber(right)
+		default:
+			equal = toString(left) == toString(right)
+		}
+		return equal == (op == "=")
+	}
+	l, r := toNumber(left), toNumber(right)
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+// 并集运算。
+type unionExpr struct {
+	left  expr
+	right expr
+}
+
+func (e *unionExpr) kind() valueKind { return kindNodeSet }
+
+func (e *unionExpr) eval(ctx *evalContext) interface{} {
+	left := e.left.eval(ctx).([]nodeRef)
+	right := e.right.eval(ctx).([]nodeRef)
+	nodes := make([]nodeRef, 0, len(left)+len(right))
+	nodes = append(nodes, left...)
+	nodes = append(nodes, right...)
+	return ctx.doc.sortUnique(nodes)
+}
+
+// 过滤表达式，即带有谓词的基本表达式。
+type filterExpr struct {
+	primary    expr
+	predicates []expr
+}
+
+func (e *filterExpr) kind() valueKind { return kindNodeSet }
+
+func (e *filterExpr) eval(ctx *evalContext) interface{} {
+	nodes := e.primary.eval(ctx).([]nodeRef)
+	for _, predicate := range e.predicates {
+		nodes = filterNodes(nodes, predicate, ctx.doc)
+	}
+	return nodes
+}
+
+// 使用谓词过滤节点。参数nodes中的节点的顺序决定了它们的上下文位置。
+// 若谓词的值是数字，则只有上下文位置与之相等的节点会被保留，否则保留谓词的布尔值为true的节点。
+func filterNodes(nodes []nodeRef, predicate expr, doc *document) []nodeRef {
+	result := make([]nodeRef, 0, len(nodes))
+	ctx := &evalContext{size: len(nodes), doc: doc}
+	for i, node := range nodes {
+		ctx.node = node
+		ctx.pos = i + 1
+		value := predicate.eval(ctx)
+		if num, ok := value.(float64); ok {
+			if num == float64(ctx.pos) {
+				result = append(result, node)
+			}
+		} else if toBoolean(value) {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// 定位路径，或其前面带有过滤表达式的路径。
+type pathExpr struct {
+	filter   expr    // 过滤表达式。为nil则表示定位路径。
+	absolute bool    // 是否为绝对定位路径。
+	steps    []*step // 定位步的列表。
+}
+
+func (e *pathExpr) kind() valueKind { return kindNodeSet }
+
+func (e *pathExpr) eval(ctx *evalContext) interface{} {
+	var nodes []nodeRef
+	switch {
+	case e.filter != nil:
+		nodes = e.filter.eval(ctx).([]nodeRef)
+	case e.absolute:
+		nodes = []nodeRef{refOf(ctx.doc.root)}
+	default:
+		nodes = []nodeRef{ctx.node}
+	}
+	for _, s := range e.steps {
+		var result []nodeRef
+		for _, node := range nodes {
+			result = append(result, s.apply(node, ctx.doc)...)
+		}
+		// 单个上下文节点的结果已经是按文档顺序排列且没有重复的。
+		if len(nodes) > 1 {
+			result = ctx.doc.sortUnique(result)
+		}
+		nodes = result
+	}
+	if nodes == nil {
+		nodes = []nodeRef{}
+	}
+	return nodes
+}
+
+// 从上下文节点出发执行定位步。结果中的节点按照文档顺序排列。
+func (s *step) apply(node nodeRef, doc *document) []nodeRef {
+	var nodes []nodeRef
+	walkAxis(s.axis, node, func(candidate nodeRef) {
+		if s.test.match(candidate, s.axis) {
+			nodes = append(nodes, candidate)
+		}
+	})
+	for _, predicate := range s.predicates {
+		nodes = filterNodes(nodes, predicate, doc)
+	}
+	if s.axis.reverse() {
+		for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}
+	}
+	return nodes
+}
+
+// 判断节点是否可以通过节点测试。名称测试只匹配轴的主节点类型（属性轴为属性，其他轴为元素），且不区分大小写。
+func (test nodeTest) match(node nodeRef, axis axisType) bool {
+	switch test.typ {
+	case testNode:
+		return true
+	case testText:
+		return node.attr < 0 && node.node.Type == html.TextNode
+	case testComment:
+		return node.attr < 0 && node.node.Type == html.CommentNode
+	case testPI:
+		// HTML解析器会把处理指令解析为注释。
+		return false
+	}
+	if axis == axisAttribute {
+		if node.attr < 0 {
+			return false
+		}
+		return test.name == "*" || strings.EqualFold(node.node.Attr[node.attr].Key, test.name)
+	}
+	if node.attr >= 0 || node.node.Type != html.ElementNode {
+		return false
+	}
+	return test.name == "*" || strings.EqualFold(node.node.Data, test.name)
+}
+
+// 判断节点是否属于XPath的数据模型。文档类型声明等节点会被忽略。
+func visible(node *html.Node) bool {
+	switch node.Type {
+	case html.DocumentNode, html.ElementNode, html.TextNode, html.CommentNode:
+		return true
+	}
+	return false
+}
+
+// 按照轴的方向（反向轴为逆文档顺序）访问轴上的节点。
+func walkAxis(axis axisType, node nodeRef, visit func(nodeRef)) {
+	isAttr := node.attr >= 0
+	switch axis {
+	case axisSelf:
+		visit(node)
+	case axisChild:
+		if !isAttr {
+			walkChildren(node.node, visit)
+		}
+	case axisDescendant:
+		if !isAttr {
+			walkDescendants(node.node, visit)
+		}
+	case axisDescendantOrSelf:
+		visit(node)
+		if !isAttr {
+			walkDescendants(node.node, visit)
+		}
+	case axisParent:
+		if isAttr {
+			visit(refOf(node.node))
+		} else if node.node.Parent != nil {
+			visit(refOf(node.node.Parent))
+		}
+	case axisAncestor, axisAncestorOrSelf:
+		if axis == axisAncestorOrSelf {
+			visit(node)
+		}
+		current := node.node
+		if !isAttr {
+			current = current.Parent
+		}
+		for ; current != nil; current = current.Parent {
+			visit(refOf(current))
+		}
+	case axisFollowingSibling:
+		if !isAttr {
+			for sibling := node.node.NextSibling; sibling != nil; sibling = sibling.NextSibling {
+				if visible(sibling) {
+					visit(refOf(sibling))
+				}
+			}
+		}
+	case axisPrecedingSibling:
+		if !isAttr {
+			for sibling := node.node.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+				if visible(sibling) {
+					visit(refOf(sibling))
+				}
+			}
+		}
+	case axisFollowing:
+		// 属性节点之后的节点包括其所属的元素的后代。
+		if isAttr {
+			walkDescendants(node.node, visit)
+		}
+		for current := node.node; current != nil; current = current.Parent {
+			for sibling := current.NextSibling; sibling != nil; sibling = sibling.NextSibling {
+				if visible(sibling) {
+					visit(refOf(sibling))
+					walkDescendants(sibling, visit)
+				}
+			}
+		}
+	case axisPreceding:
+		for current := node.node; current != nil; current = current.Parent {
+			for sibling := current.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+				if visible(sibling) {
+					walkDescendantsReverse(sibling, visit)
+					visit(refOf(sibling))
+				}
+			}
+		}
+	case axisAttribute:
+		if !isAttr && node.node.Type == html.ElementNode {
+			for i, attr := range node.node.Attr {
+				// 命名空间声明不是属性节点。
+				if attr.Key == "xmlns" || strings.HasPrefix(attr.Key, "xmlns:") {
+					continue
+				}
+				visit(nodeRef{node: node.node, attr: i})
+			}
+		}
+	}
+}
+
+// 按照文档顺序访问子节点。
+func walkChildren(node *html.Node, visit func(nodeRef)) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if visible(child) {
+			visit(refOf(child))
+		}
+	}
+}
+
+// 按照文档顺序访问后代节点。
+func walkDescendants(node *html.Node, visit func(nodeRef)) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if visible(child) {
+			visit(refOf(child))
+			walkDescendants(child, visit)
+		}
+	}
+}
+
+// 按照逆文档顺序访问后代节点。
+func walkDescendantsReverse(node *html.Node, visit func(nodeRef)) {
+	for child := node.LastChild; child != nil; child = child.PrevSibling {
+		if visible(child) {
+			walkDescendantsReverse(child, visit)
+			visit(refOf(child))
+		}
+	}
+}
+
+// 获得节点的字符串值。元素和文档节点的字符串值是其所有后代文本节点的内容的拼接。
+func stringValue(node nodeRef) string {
+	if node.attr >= 0 {
+		return node.node.Attr[node.attr].Val
+	}
+	switch node.node.Type {
+	case html.TextNode, html.CommentNode:
+		return node.node.Data
+	case html.ElementNode, html.DocumentNode:
+		var buf strings.Builder
+		walkDescendants(node.node, func(descendant nodeRef) {
+			if descendant.node.Type == html.TextNode {
+				buf.WriteString(descendant.node.Data)
+			}
+		})
+		return buf.String()
+	}
+	return ""
+}
+
+// 把值转换为字符串。节点集会被转换为其中第一个节点的字符串值。
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case []nodeRef:
+		if len(v) == 0 {
+			return ""
+		}
+		return stringValue(v[0])
+	case string:
+		return v
+	case float64:
+		return numberToString(v)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return ""
+}
+
+// 把值转换为数字。
+func toNumber(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+	return stringToNumber(toString(value))
+}
+
+// 把值转换为布尔值。
+func toBoolean(value interface{}) bool {
+	switch v := value.(type) {
+	case []nodeRef:
+		return len(v) > 0
+	case string:
+		return v != ""
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case bool:
+		return v
+	}
+	return false
+}
+
+// 把字符串转换为数字。只有形如“-12.5”的字符串（前后可以有空白字符）才会被转换为相应的数字，否则结果为NaN。
+func stringToNumber(s string) float64 {
+	s = strings.Trim(s, " \t\r\n")
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || digits == "." {
+		return math.NaN()
+	}
+	dot := false
+	for _, r := range digits {
+		switch {
+		case isDigit(r):
+		case r == '.' && !dot:
+			dot = true
+		default:
+			return math.NaN()
+		}
+	}
+	num, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return num
+}
+
+// 把数字转换为字符串。整数不带小数点，且不会使用科学记数法。
+func numberToString(num float64) string {
+	switch {
+	case math.IsNaN(num):
+		return "NaN"
+	case math.IsInf(num, 1):
+		return "Infinity"
+	case math.IsInf(num, -1):
+		return "-Infinity"
+	case num == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(num, 'f', -1, 64)
+}
@@ -0,0 +1,251 @@
+package xpath
+
+import (
+	"golang.org/x/net/html"
+	"math"
+	"strings"
+)
+
+// 函数。
+type function struct {
+	minArgs     int       // 最少的参数个数。
+	maxArgs     int       // 最多的参数个数。为-1则表示不限。
+	nodeSetArgs bool      // 参数是否必须为节点集。
+	kind        valueKind // 返回值的类型。
+	// 调用函数。参数args中的表达式尚未被求值。
+	call func(ctx *evalContext, args []expr) interface{}
+}
+
+// 函数调用。
+type functionCall struct {
+	name string    // 函数名称。
+	fn   *function // 函数。
+	args []expr    // 参数的列表。
+}
+
+func (e *functionCall) kind() valueKind { return e.fn.kind }
+
+func (e *functionCall) eval(ctx *evalContext) interface{} {
+	return e.fn.call(ctx, e.args)
+}
+
+// XPath 1.0的核心函数库。
+var functions = map[string]*function{
+	// 节点集函数。
+	"last": {0, 0, false, kindNumber, func(ctx *evalContext, args []expr) interface{} {
+		return float64(ctx.size)
+	}},
+	"position": {0, 0, false, kindNumber, func(ctx *evalContext, args []expr) interface{} {
+		return float64(ctx.pos)
+	}},
+	"count": {1, 1, true, kindNumber, func(ctx *evalContext, args []expr) interface{} {
+		return float64(len(args[0].eval(ctx).([]nodeRef)))
+	}},
+	"id":         {1, 1, false, kindNodeSet, idFunc},
+	"local-name": {0, 1, true, kindString, nameFunc},
+	"name":       {0, 1, true, kindString, nameFunc},
+	"namespace-uri": {0, 1, true, kindString, func(ctx *evalContext, args []expr) interface{} {
+		return ""
+	}},
+	// 字符串函数。
+	"string": {0, 1, false, kindString, func(ctx *evalContext, args []expr) interface{} {
+		return stringArg(ctx, args, 0)
+	}},
+	"concat": {2, -1, false, kindString, func(ctx *evalContext, args []expr) interface{} {
+		var buf strings.Builder
+		for _, arg := range args {
+			buf.WriteString(toString(arg.eval(ctx)))
+		}
+		return buf.String()
+	}},
+	"starts-with": {2, 2, false, kindBoolean, func(ctx *evalContext, args []expr) interface{} {
+		return strings.HasPrefix(stringArg(ctx, args, 0), stringArg(ctx, args, 1))
+	}},
+	"contains": {2, 2, false, kindBoolean, func(ctx *evalContext, args []expr) interface{} {
+		return strings.Contains(stringArg(ctx, args, 0), stringArg(ctx, args, 1))
+	}},
+	"substring-before": {2, 2, false, kindString, func(ctx *evalContext, args []expr) interface{} {
+		s, sep := stringArg(ctx, args, 0), stringArg(ctx, args, 1)
+		if index := strings.Index(s, sep); index >= 0 {
+			return s[:index]
+		}
+		return ""
+	}},
+	"substring-after": {2, 2, false, kindString, func(ctx *evalContext, args []expr) interface{} {
+		s, sep := stringArg(ctx, args, 0), stringArg(ctx, args, 1)
+		if index := strings.Index(s, sep); index >= 0 {
+			return s[index+len(sep):]
+		}
+		return ""
+	}},
+	"substring": {2, 3, false, kindString, substringFunc},
+	"string-length": {0, 1, false, kindNumber, func(ctx *evalContext, args []expr) interface{} {
+		return float64(len([]rune(stringArg(ctx, args, 0))))
+	}},
+	"normalize-space": {0, 1, false, kindString, func(ctx *evalContext, args []expr) interface{} {
+		return strings.Join(strings.FieldsFunc(stringArg(ctx, args, 0), isSpace), " ")
+	}},
+	"translate": {3, 3, false, kindString, translateFunc},
+	// 布尔函数。
+	"boolean": {1, 1, false, kindBoolean, func(ctx *evalContext, args []expr) interface{} {
+		return toBoolean(args[0].eval(ctx))
+	}},
+	"not": {1, 1, false, kindBoolean, func(ctx *evalContext, args []expr) interface{} {
+		return !toBoolean(args[0].eval(ctx))
+	}},
+	"true": {0, 0, false, kindBoolean, func(ctx *evalContext, args []expr) interface{} {
+		return true
+	}},
+	"false": {0, 0, false, kindBoolean, func(ctx *evalContext, args []expr) interface{} {
+		return false
+	}},
+	"lang": {1, 1, false, kindBoolean, langFunc},
+	// 数字函数。
+	"number": {0, 1, false, kindNumber, func(ctx *evalContext, args []expr) interface{} {
+		if len(args) == 0 {
+			return stringToNumber(stringValue(ctx.node))
+		}
+		return toNumber(args[0].eval(ctx))
+	}},
+	"sum": {1, 1, true, kindNumber, func(ctx *evalContext, args []expr) interface{} {
+		sum := 0.0
+		for _, node := range args[0].eval(ctx).([]nodeRef) {
+			sum += stringToNumber(stringValue(node))
+		}
+		return sum
+	}},
+	"floor": {1, 1, false, kindNumber, func(ctx *evalContext, args []expr) interface{} {
+		return math.Floor(toNumber(args[0].eval(ctx)))
+	}},
+	"ceiling": {1, 1, false, kindNumber, func(ctx *evalContext, args []expr) interface{} {
+		return math.Ceil(toNumber(args[0].eval(ctx)))
+	}},
+	"round": {1, 1, false, kindNumber, func(ctx *evalContext, args []expr) interface{} {
+		return round(toNumber(args[0].eval(ctx)))
+	}},
+}
+
+// 获得第index个参数的字符串值。若该参数不存在，则使用上下文节点的字符串值。
+func stringArg(ctx *evalContext, args []expr, index int) string {
+	if index >= len(args) {
+		return stringValue(ctx.node)
+	}
+	return toString(args[index].eval(ctx))
+}
+
+// 获得节点集中第一个节点（或上下文节点）的名称。HTML文档中没有命名空间前缀，因此本地名称就是名称。
+func nameFunc(ctx *evalContext, args []expr) interface{} {
+	node := ctx.node
+	if len(args) > 0 {
+		nodes := args[0].eval(ctx).([]nodeRef)
+		if len(nodes) == 0 {
+			return ""
+		}
+		node = nodes[0]
+	}
+	if node.attr >= 0 {
+		return node.node.Attr[node.attr].Key
+	}
+	if node.node.Type == html.ElementNode {
+		return node.node.Data
+	}
+	return ""
+}
+
+// 获得id属性的值为参数中的某个ID的元素。参数为节点集时，其中各节点的字符串值都会被视为ID的列表。
+func idFunc(ctx *evalContext, args []expr) interface{} {
+	ids := make(map[string]bool)
+	value := args[0].eval(ctx)
+	if nodes, ok := value.([]nodeRef); ok {
+		for _, node := range nodes {
+			for _, id := range strings.FieldsFunc(stringValue(node), isSpace) {
+				ids[id] = true
+			}
+		}
+	} else {
+		for _, id := range strings.FieldsFunc(toString(value), isSpace) {
+			ids[id] = true
+		}
+	}
+	result := []nodeRef{}
+	if len(ids) == 0 {
+		return result
+	}
+	walkDescendants(ctx.doc.root, func(node nodeRef) {
+		if node.node.Type != html.ElementNode {
+			return
+		}
+		for _, attr := range node.node.Attr {
+			if attr.Key == "id" && ids[attr.Val] {
+				result = append(result, node)
+				break
+			}
+		}
+	})
+	return result
+}
+
+// 获得子字符串。字符的位置从1开始，第二个参数代表开始位置，第三个参数代表长度，它们都会被四舍五入。
+func substringFunc(ctx *evalContext, args []expr) interface{} {
+	runes := []rune(stringArg(ctx, args, 0))
+	start := round(toNumber(args[1].eval(ctx)))
+	end := math.Inf(1)
+	if len(args) > 2 {
+		end = start + round(toNumber(args[2].eval(ctx)))
+	}
+	var buf strings.Builder
+	for i, r := range runes {
+		if pos := float64(i + 1); pos >= start && pos < end {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// 把第一个参数中出现在第二个参数中的字符替换为第三个参数中相同位置的字符。
+// 若第三个参数中没有相应位置的字符，则删除该字符。
+func translateFunc(ctx *evalContext, args []expr) interface{} {
+	s := stringArg(ctx, args, 0)
+	from := []rune(stringArg(ctx, args, 1))
+	to := []rune(stringArg(ctx, args, 2))
+	mapping := make(map[rune]rune)
+	for i, r := range from {
+		if _, ok := mapping[r]; ok {
+			continue
+		}
+		if i < len(to) {
+			mapping[r] = to[i]
+		} else {
+			mapping[r] = -1
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		if replacement, ok := mapping[r]; ok {
+			return replacement
+		}
+		return r
+	}, s)
+}
+
+// 判断上下文节点的语言（由其自身或最近的祖先的lang或xml:lang属性指定）是否为参数指定的语言或其子语言。
+func langFunc(ctx *evalContext, args []expr) interface{} {
+	lang := toString(args[0].eval(ctx))
+	for node := ctx.node.node; node != nil; node = node.Parent {
+		for _, attr := range node.Attr {
+			if attr.Key == "lang" || attr.Key == "xml:lang" {
+				value := attr.Val
+				return strings.EqualFold(value, lang) ||
+					(len(value) > len(lang) && value[len(lang)] == '-' && strings.EqualFold(value[:len(lang)], lang))
+			}
+		}
+	}
+	return false
+}
+
+// 四舍五入。与math.Round不同，小数部分为0.5的负数会被舍入为较大的整数。
+func round(num float64) float64 {
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return num
+	}
+	return math.Floor(num + 0.5)
+}
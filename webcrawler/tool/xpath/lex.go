@@ -0,0 +1,221 @@
+package xpath
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+// 记号的类型。
+type tokenKind int
+
+const (
+	tokEOF      tokenKind = iota // 表达式的结尾。
+	tokNumber                    // 数字。
+	tokLiteral                   // 字符串字面量。
+	tokName                      // 名称测试，如“a”、“*”或“svg:*”。
+	tokNodeType                  // 节点类型，如“text”。其后必为左括号。
+	tokFunction                  // 函数名称。其后必为左括号。
+	tokAxis                      // 轴名称。其后必为“::”。
+	tokOperator                  // 运算符，包括“and”、“or”、“mod”、“div”以及“*”、“/”和“|”等符号。
+	tokPunct                     // 其他符号，即“(”、“)”、“[”、“]”、“@”、“,”、“.”、“..”和“::”。
+)
+
+// 记号。
+type token struct {
+	kind tokenKind // 类型。
+	text string    // 文本。对于字符串字面量，它不包含引号。
+	num  float64   // 数字的值。
+	pos  int       // 在表达式中的位置（以字符计）。
+}
+
+// 节点类型的名称的集合。
+var nodeTypes = map[string]bool{
+	"node":                   true,
+	"text":                   true,
+	"comment":                true,
+	"processing-instruction": true,
+}
+
+// 运算符名称的集合。
+var operatorNames = map[string]bool{
+	"and": true,
+	"or":  true,
+	"mod": true,
+	"div": true,
+}
+
+// 把表达式拆分为记号。名称与运算符的歧义按照XPath 1.0规范的3.7节消除。
+func lex(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	n := len(runes)
+	// 判断下一个“*”或名称是否应被视为运算符，即前面是否有一个不是“@”、“::”、“(”、“[”、“,”或运算符的记号。
+	operatorExpected := func() bool {
+		if len(tokens) == 0 {
+			return false
+		}
+		prev := tokens[len(tokens)-1]
+		switch prev.kind {
+		case tokOperator:
+			return false
+		case tokPunct:
+			switch prev.text {
+			case "@", "::", "(", "[", ",":
+				return false
+			}
+		}
+		return true
+	}
+	// 跳过空白字符，并返回其后的位置。
+	skipSpace := func(i int) int {
+		for i < n && isSpace(runes[i]) {
+			i++
+		}
+		return i
+	}
+	// 扫描名称（不含冒号），并返回其后的位置。
+	scanName := func(i int) int {
+		for i < n && isNameChar(runes[i]) {
+			i++
+		}
+		return i
+	}
+	for i := skipSpace(0); i < n; i = skipSpace(i) {
+		r := runes[i]
+		start := i
+		switch {
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < n && runes[end] != r {
+				end++
+			}
+			if end >= n {
+				return nil, errors.New(fmt.Sprintf("Unterminated string literal at %d", start))
+			}
+			tokens = append(tokens, token{kind: tokLiteral, text: string(runes[i+1 : end]), pos: start})
+			i = end + 1
+		case isDigit(r) || (r == '.' && i+1 < n && isDigit(runes[i+1])):
+			for i < n && isDigit(runes[i]) {
+				i++
+			}
+			if i < n && runes[i] == '.' {
+				i++
+				for i < n && isDigit(runes[i]) {
+					i++
+				}
+			}
+			num, err := strconv.ParseFloat(string(runes[start:i]), 64)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid number at %d", start))
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[start:i]), num: num, pos: start})
+		case r == '.':
+			i++
+			if i < n && runes[i] == '.' {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokPunct, text: string(runes[start:i]), pos: start})
+		case r == '/':
+			i++
+			if i < n && runes[i] == '/' {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokOperator, text: string(runes[start:i]), pos: start})
+		case r == '|' || r == '+' || r == '-' || r == '=':
+			i++
+			tokens = append(tokens, token{kind: tokOperator, text: string(r), pos: start})
+		case r == '!':
+			if i+1 >= n || runes[i+1] != '=' {
+				return nil, errors.New(fmt.Sprintf("Unexpected character '!' at %d", start))
+			}
+			i += 2
+			tokens = append(tokens, token{kind: tokOperator, text: "!=", pos: start})
+		case r == '<' || r == '>':
+			i++
+			if i < n && runes[i] == '=' {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokOperator, text: string(runes[start:i]), pos: start})
+		case r == '(' || r == ')' || r == '[' || r == ']' || r == '@' || r == ',':
+			i++
+			tokens = append(tokens, token{kind: tokPunct, text: string(r), pos: start})
+		case r == ':':
+			if i+1 >= n || runes[i+1] != ':' {
+				return nil, errors.New(fmt.Sprintf("Unexpected character ':' at %d", start))
+			}
+			i += 2
+			tokens = append(tokens, token{kind: tokPunct, text: "::", pos: start})
+		case r == '$':
+			return nil, errors.New(fmt.Sprintf("Variable references are not supported (at %d)", start))
+		case r == '*':
+			i++
+			if operatorExpected() {
+				tokens = append(tokens, token{kind: tokOperator, text: "*", pos: start})
+			} else {
+				tokens = append(tokens, token{kind: tokName, text: "*", pos: start})
+			}
+		case isNameStart(r):
+			i = scanName(i)
+			name := string(runes[start:i])
+			if operatorExpected() {
+				if !operatorNames[name] {
+					return nil, errors.New(fmt.Sprintf("Unexpected name %q at %d", name, start))
+				}
+				tokens = append(tokens, token{kind: tokOperator, text: name, pos: start})
+				continue
+			}
+			// 带有前缀的名称，如“svg:rect”或“svg:*”。
+			if i+1 < n && runes[i] == ':' && runes[i+1] != ':' {
+				switch {
+				case runes[i+1] == '*':
+					i += 2
+				case isNameStart(runes[i+1]):
+					i = scanName(i + 1)
+				default:
+					return nil, errors.New(fmt.Sprintf("Invalid name at %d", start))
+				}
+				name = string(runes[start:i])
+			}
+			next := skipSpace(i)
+			kind := tokName
+			switch {
+			case next < n && runes[next] == '(':
+				if nodeTypes[name] {
+					kind = tokNodeType
+				} else {
+					kind = tokFunction
+				}
+			case next+1 < n && runes[next] == ':' && runes[next+1] == ':':
+				kind = tokAxis
+			}
+			tokens = append(tokens, token{kind: kind, text: name, pos: start})
+		default:
+			return nil, errors.New(fmt.Sprintf("Unexpected character %q at %d", r, start))
+		}
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: n})
+	return tokens, nil
+}
+
+// 判断字符是否为XPath中的空白字符。
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+// 判断字符是否为数字。
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// 判断字符是否可以作为名称的第一个字符。
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// 判断字符是否可以作为名称中的字符。
+func isNameChar(r rune) bool {
+	return isNameStart(r) || isDigit(r) || r == '.' || r == '-' ||
+		unicode.IsDigit(r) || unicode.In(r, unicode.Mn, unicode.Mc)
+}
@@ -0,0 +1,474 @@
+package xpath
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 轴的类型。
+type axisType int
+
+const (
+	axisChild axisType = iota
+	axisDescendant
+	axisDescendantOrSelf
+	axisSelf
+	axisParent
+	axisAncestor
+	axisAncestorOrSelf
+	axisFollowingSibling
+	axisPrecedingSibling
+	axisFollowing
+	axisPreceding
+	axisAttribute
+	axisNamespace
+)
+
+// 轴名称与轴的映射。
+var axes = map[string]axisType{
+	"child":              axisChild,
+	"descendant":         axisDescendant,
+	"descendant-or-self": axisDescendantOrSelf,
+	"self":               axisSelf,
+	"parent":             axisParent,
+	"ancestor":           axisAncestor,
+	"ancestor-or-self":   axisAncestorOrSelf,
+	"following-sibling":  axisFollowingSibling,
+	"preceding-sibling":  axisPrecedingSibling,
+	"following":          axisFollowing,
+	"preceding":          axisPreceding,
+	"attribute":          axisAttribute,
+	"namespace":          axisNamespace,
+}
+
+// 判断轴是否为反向轴。反向轴上的节点的位置按照逆文档顺序计算。
+func (axis axisType) reverse() bool {
+	switch axis {
+	case axisParent, axisAncestor, axisAncestorOrSelf, axisPrecedingSibling, axisPreceding:
+		return true
+	}
+	return false
+}
+
+// 节点测试的类型。
+type testType int
+
+const (
+	testName    testType = iota // 名称测试。
+	testNode                    // node()。
+	testText                    // text()。
+	testComment                 // comment()。
+	testPI                      // processing-instruction()。
+)
+
+// 节点测试。
+type nodeTest struct {
+	typ  testType // 类型。
+	name string   // 名称测试中的本地名称（不含前缀）。“*”代表任意名称。
+}
+
+// 定位步。
+type step struct {
+	axis       axisType // 轴。
+	test       nodeTest // 节点测试。
+	predicates []expr   // 谓词的列表。
+}
+
+// 语法分析器。
+type parser struct {
+	tokens []token // 记号的列表。
+	pos    int     // 当前记号的序号。
+}
+
+// 分析整个表达式。
+func (p *parser) parse() (expr, error) {
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return e, nil
+}
+
+// 获得当前记号。
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// 获得当前记号，并前进到下一个记号。
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// 判断当前记号是否为某个运算符。
+func (p *parser) isOperator(texts ...string) bool {
+	t := p.peek()
+	if t.kind != tokOperator {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断当前记号是否为某个符号。
+func (p *parser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == text
+}
+
+// 若当前记号为某个符号，则前进到下一个记号，否则返回错误。
+func (p *parser) expectPunct(text string) error {
+	if !p.isPunct(text) {
+		t := p.peek()
+		if t.kind == tokEOF {
+			return errors.New(fmt.Sprintf("Expected '%s' at the end", text))
+		}
+		return errors.New(fmt.Sprintf("Expected '%s' at %d, found '%s'", text, t.pos, t.text))
+	}
+	p.next()
+	return nil
+}
+
+// 生成遇到意外的记号时的错误。
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokEOF {
+		return errors.New("Unexpected end of the expression")
+	}
+	return errors.New(fmt.Sprintf("Unexpected '%s' at %d", t.text, t.pos))
+}
+
+// Expr ::= OrExpr
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseBinary(0)
+}
+
+// 二元运算符按优先级从低到高排列的列表。
+var binaryLevels = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "div", "mod"},
+}
+
+// 分析指定优先级及更高优先级的二元运算。所有二元运算符都是左结合的。
+func (p *parser) parseBinary(level int) (expr, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator(binaryLevels[level]...) {
+		op := p.next().text
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// UnaryExpr ::= UnionExpr | '-' UnaryExpr
+func (p *parser) parseUnary() (expr, error) {
+	if p.isOperator("-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negateExpr{operand: operand}, nil
+	}
+	return p.parseUnion()
+}
+
+// UnionExpr ::= PathExpr | UnionExpr '|' PathExpr
+func (p *parser) parseUnion() (expr, error) {
+	left, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("|") {
+		t := p.next()
+		right, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if left.kind() != kindNodeSet || right.kind() != kindNodeSet {
+			return nil, errors.New(fmt.Sprintf("The operands of '|' at %d must be node-sets", t.pos))
+		}
+		left = &unionExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// PathExpr ::= LocationPath | FilterExpr | FilterExpr '/' RelativeLocationPath
+// | FilterExpr '//' RelativeLocationPath
+func (p *parser) parsePath() (expr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokLiteral || t.kind == tokNumber || t.kind == tokFunction ||
+		(t.kind == tokPunct && t.text == "("):
+		filter, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOperator("/", "//") {
+			return filter, nil
+		}
+		if filter.kind() != kindNodeSet {
+			return nil, errors.New(fmt.Sprintf("The expression before '%s' at %d must be a node-set",
+				p.peek().text, p.peek().pos))
+		}
+		steps, err := p.parseRelativePath(nil)
+		if err != nil {
+			return nil, err
+		}
+		return &pathExpr{filter: filter, steps: steps}, nil
+	case t.kind == tokOperator && (t.text == "/" || t.text == "//"):
+		p.next()
+		path := &pathExpr{absolute: true}
+		if t.text == "/" && !p.startsStep() {
+			return path, nil
+		}
+		var steps []*step
+		if t.text == "//" {
+			steps = append(steps, descendantOrSelfStep())
+		}
+		steps, err := p.parseRelativePath(steps)
+		if err != nil {
+			return nil, err
+		}
+		path.steps = steps
+		return path, nil
+	default:
+		steps, err := p.parseRelativePath(nil)
+		if err != nil {
+			return nil, err
+		}
+		return &pathExpr{steps: steps}, nil
+	}
+}
+
+// 判断当前记号是否可以作为定位步的开始。
+func (p *parser) startsStep() bool {
+	t := p.peek()
+	switch t.kind {
+	case tokName, tokNodeType, tokAxis:
+		return true
+	case tokPunct:
+		return t.text == "@" || t.text == "." || t.text == ".."
+	}
+	return false
+}
+
+// 获得“//”所代表的定位步，即descendant-or-self::node()。
+func descendantOrSelfStep() *step {
+	return &step{axis: axisDescendantOrSelf, test: nodeTest{typ: testNode}}
+}
+
+// 分析相对定位路径，并把其中的定位步追加到参数steps之后。
+// 若参数steps为nil且当前记号为“/”或“//”，则先跳过该记号（用于过滤表达式之后的路径）。
+// RelativeLocationPath ::= Step | RelativeLocationPath '/' Step | RelativeLocationPath '//' Step
+func (p *parser) parseRelativePath(steps []*step) ([]*step, error) {
+	if steps == nil && p.isOperator("/", "//") {
+		if p.next().text == "//" {
+			steps = append(steps, descendantOrSelfStep())
+		}
+	}
+	for {
+		s, err := p.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, s)
+		if !p.isOperator("/", "//") {
+			return steps, nil
+		}
+		if p.next().text == "//" {
+			steps = append(steps, descendantOrSelfStep())
+		}
+	}
+}
+
+// Step ::= AxisSpecifier NodeTest Predicate* | '.' | '..'
+func (p *parser) parseStep() (*step, error) {
+	if p.isPunct(".") {
+		p.next()
+		return &step{axis: axisSelf, test: nodeTest{typ: testNode}}, nil
+	}
+	if p.isPunct("..") {
+		p.next()
+		return &step{axis: axisParent, test: nodeTest{typ: testNode}}, nil
+	}
+	s := &step{axis: axisChild}
+	switch t := p.peek(); {
+	case t.kind == tokAxis:
+		p.next()
+		axis, ok := axes[t.text]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown axis '%s' at %d", t.text, t.pos))
+		}
+		s.axis = axis
+		if err := p.expectPunct("::"); err != nil {
+			return nil, err
+		}
+	case t.kind == tokPunct && t.text == "@":
+		p.next()
+		s.axis = axisAttribute
+	}
+	t := p.next()
+	switch t.kind {
+	case tokName:
+		name := t.text
+		if index := strings.Index(name, ":"); index >= 0 {
+			name = name[index+1:]
+		}
+		s.test = nodeTest{typ: testName, name: name}
+	case tokNodeType:
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		switch t.text {
+		case "node":
+			s.test = nodeTest{typ: testNode}
+		case "text":
+			s.test = nodeTest{typ: testText}
+		case "comment":
+			s.test = nodeTest{typ: testComment}
+		default:
+			s.test = nodeTest{typ: testPI}
+			if p.peek().kind == tokLiteral {
+				p.next()
+			}
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.unexpected(t)
+	}
+	predicates, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	s.predicates = predicates
+	return s, nil
+}
+
+// Predicate ::= '[' Expr ']'
+func (p *parser) parsePredicates() ([]expr, error) {
+	var predicates []expr
+	for p.isPunct("[") {
+		p.next()
+		predicate, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, predicate)
+	}
+	return predicates, nil
+}
+
+// FilterExpr ::= PrimaryExpr | FilterExpr Predicate
+func (p *parser) parseFilter() (expr, error) {
+	t := p.peek()
+	primary, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isPunct("[") {
+		return primary, nil
+	}
+	if primary.kind() != kindNodeSet {
+		return nil, errors.New(fmt.Sprintf("The expression at %d filtered by predicates must be a node-set", t.pos))
+	}
+	predicates, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	return &filterExpr{primary: primary, predicates: predicates}, nil
+}
+
+// PrimaryExpr ::= '(' Expr ')' | Literal | Number | FunctionCall
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLiteral:
+		return &literalExpr{value: t.text}, nil
+	case tokNumber:
+		return &numberExpr{value: t.num}, nil
+	case tokFunction:
+		return p.parseFunctionCall(t)
+	case tokPunct:
+		if t.text == "(" {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+	}
+	return nil, p.unexpected(t)
+}
+
+// FunctionCall ::= FunctionName '(' ( Argument ( ',' Argument )* )? ')'
+func (p *parser) parseFunctionCall(name token) (expr, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown function '%s' at %d", name.text, name.pos))
+	}
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	var args []expr
+	if !p.isPunct(")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, errors.New(fmt.Sprintf("Wrong number of arguments to %s() at %d: %d",
+			name.text, name.pos, len(args)))
+	}
+	if fn.nodeSetArgs {
+		for _, arg := range args {
+			if arg.kind() != kindNodeSet {
+				return nil, errors.New(fmt.Sprintf("The arguments to %s() at %d must be node-sets",
+					name.text, name.pos))
+			}
+		}
+	}
+	return &functionCall{name: name.text, fn: fn, args: args}, nil
+}
@@ -0,0 +1,134 @@
+package xpath
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/html"
+)
+
+// 已编译的XPath 1.0表达式。它可以在HTML节点树（即html.Parse函数的结果，
+// 或goquery文档和选择中的Nodes字段中的节点）上求值，且可以被并发使用。
+// 为了适应HTML文档，名称测试不区分大小写且忽略命名空间前缀，文档类型声明会被忽略。
+// 它支持全部的轴（命名空间轴总是为空）、谓词以及XPath 1.0的核心函数库，但不支持变量引用。
+type Expr struct {
+	source string // 表达式的源文本。
+	root   expr   // 表达式的语法树。
+}
+
+// 编译XPath表达式。
+func Compile(source string) (*Expr, error) {
+	tokens, err := lex(source)
+	if err == nil {
+		p := &parser{tokens: tokens}
+		var root expr
+		if root, err = p.parse(); err == nil {
+			return &Expr{source: source, root: root}, nil
+		}
+	}
+	errMsg := fmt.Sprintf("Invalid xpath '%s': %s", source, err)
+	return nil, errors.New(errMsg)
+}
+
+// 编译XPath表达式。若表达式无效，则引发运行时恐慌。
+func MustCompile(source string) *Expr {
+	e, err := Compile(source)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// 获得表达式的源文本。
+func (e *Expr) String() string {
+	return e.source
+}
+
+// 以参数node为上下文节点求值。
+func (e *Expr) evaluate(node *html.Node) interface{} {
+	root := node
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	ctx := &evalContext{
+		node: refOf(node),
+		pos:  1,
+		size: 1,
+		doc:  &document{root: root},
+	}
+	return e.root.eval(ctx)
+}
+
+// 以参数node为上下文节点求值，并返回结果中的节点（按文档顺序排列）。
+// 若结果不是节点集，则返回nil。由于HTML节点树中没有属性节点，结果中的属性会被忽略，
+// 可以使用SelectStrings方法获得属性值。
+func (e *Expr) Select(node *html.Node) []*html.Node {
+	if node == nil {
+		return nil
+	}
+	refs, ok := e.evaluate(node).([]nodeRef)
+	if !ok {
+		return nil
+	}
+	nodes := make([]*html.Node, 0, len(refs))
+	for _, ref := range refs {
+		if ref.attr < 0 {
+			nodes = append(nodes, ref.node)
+		}
+	}
+	return nodes
+}
+
+// 以参数node为上下文节点求值，并返回结果中的各节点（包括属性）的字符串值。
+// 若结果不是节点集，则返回只包含结果的字符串形式的列表，如“count(//a)”的结果为[]string{"3"}。
+func (e *Expr) SelectStrings(node *html.Node) []string {
+	if node == nil {
+		return nil
+	}
+	value := e.evaluate(node)
+	refs, ok := value.([]nodeRef)
+	if !ok {
+		return []string{toString(value)}
+	}
+	values := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		values = append(values, stringValue(ref))
+	}
+	return values
+}
+
+// 以参数node为上下文节点求值，并返回结果的字符串形式（即XPath中string函数的结果）。
+// 对于节点集，它是其中第一个节点的字符串值。若节点集为空，则它为空字符串。
+func (e *Expr) SelectString(node *html.Node) string {
+	if node == nil {
+		return ""
+	}
+	return toString(e.evaluate(node))
+}
+
+// 以参数node为上下文节点求值，并返回结果的布尔值（即XPath中boolean函数的结果）。
+// 对于节点集，只要其不为空，结果就为true。
+func (e *Expr) SelectBool(node *html.Node) bool {
+	if node == nil {
+		return false
+	}
+	return toBoolean(e.evaluate(node))
+}
+
+// 在参数node代表的节点（通常为文档）中查找与XPath表达式匹配的节点。参见Expr的Select方法。
+func Find(node *html.Node, source string) ([]*html.Node, error) {
+	e, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return e.Select(node), nil
+}
+
+// 获得XPath表达式在参数node代表的节点（通常为文档）中的求值结果的字符串值的列表。
+// 参见Expr的SelectStrings方法。
+func FindStrings(node *html.Node, source string) ([]string, error) {
+	e, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return e.SelectStrings(node), nil
+}
@@ -0,0 +1,308 @@
+package xpath
+
+import (
+	"golang.org/x/net/html"
+	"strings"
+	"testing"
+)
+
+const testPage = `<!DOCTYPE html>
+<html lang="en"><head><title>Test</title></head>
+<body>
+<div id="main" class="a b"><p id="p1" lang="en-US">One</p><p id="p2">Two <b>bold</b></p><p id="p3" class="x">Three</p><!-- note --></div>
+<ul id="list"><li>1</li><li>2</li><li>3</li><li>4</li></ul>
+<a href="/a" rel="next">A</a><a href="/b">B</a>
+</body></html>`
+
+func parseTestPage(t *testing.T) *html.Node {
+	doc, err := html.Parse(strings.NewReader(testPage))
+	if err != nil {
+		t.Fatalf("html.Parse() error: %s", err)
+	}
+	return doc
+}
+
+// 以文档为上下文节点求值，并把结果中的各字符串值用“,”连接起来。
+func evalJoined(t *testing.T, doc *html.Node, source string) string {
+	e, err := Compile(source)
+	if err != nil {
+		t.Fatalf("Compile(%q) error: %s", source, err)
+	}
+	return strings.Join(e.SelectStrings(doc), ",")
+}
+
+func TestAxes(t *testing.T) {
+	doc := parseTestPage(t)
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"//p/@id", "p1,p2,p3"},
+		{"/html/body/div/child::p/@id", "p1,p2,p3"},
+		{"//p[1]/following-sibling::p/@id", "p2,p3"},
+		{"//p[3]/preceding-sibling::p/@id", "p1,p2"},
+		// 反向轴上的位置从离上下文节点最近的节点开始计算，但结果仍按文档顺序排列。
+		{"//p[3]/preceding-sibling::p[1]/@id", "p2"},
+		{"//b/ancestor::*/@id", "main,p2"},
+		{"//b/ancestor::*[1]/@id", "p2"},
+		{"name(//b/ancestor-or-self::*[1])", "b"},
+		{"count(//div/descendant::*)", "4"},
+		{"count(//div/descendant-or-self::*)", "5"},
+		{"//b/parent::p/@id", "p2"},
+		{"//b/../@id", "p2"},
+		{"//li[2]/following::a/@href", "/a,/b"},
+		{"//li[1]/preceding::p/@id", "p1,p2,p3"},
+		{"//p[@id='p1']/self::p/@id", "p1"},
+		{"count(//p/self::div)", "0"},
+		{"count(//div/attribute::*)", "2"},
+		{"//div/@*", "main,a b"},
+		{"count(//div/namespace::*)", "0"},
+		{"count(//div/comment())", "1"},
+		{"//div/comment()", " note "},
+		{"count(//ul/li/text())", "4"},
+		{"//ul/node()[2]", "2"},
+		{"count(//li/@*)", "0"},
+		// 名称测试不区分大小写，文档类型声明被忽略。
+		{"count(//P)", "3"},
+		{"count(/node())", "1"},
+		{"name(/*)", "html"},
+		{"count(//*[@id]/@id)", "5"},
+	}
+	for _, c := range cases {
+		if got := evalJoined(t, doc, c.expr); got != c.want {
+			t.Errorf("%s = %q, want %q", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	doc := parseTestPage(t)
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"//li[position() > 2]", "3,4"},
+		{"//li[last()]", "4"},
+		{"//li[last() - 1]", "3"},
+		{"//li[position() mod 2 = 0]", "2,4"},
+		{"//li[2]", "2"},
+		{"//li[2.5]", ""},
+		{"//li[2][1]", "2"},
+		{"//li[1][2]", ""},
+		{"(//li)[2]", "2"},
+		{"(//li | //p)[1]", "One"},
+		{"//li[. = '3']", "3"},
+		{"//li[. > 2][1]", "3"},
+		{"//p[@class]/@id", "p3"},
+		{"//p[b]/@id", "p2"},
+		{"//p[not(@id = 'p2')]/@id", "p1,p3"},
+		{"//a[@rel='next'][1]/@href", "/a"},
+		{"//a[@href][2]/@href", "/b"},
+		{"//a[contains(@href, 'b')]", "B"},
+		{"//p[1]/@id | //a/@href", "p1,/a,/b"},
+		{"//ul/li[position() = last()]/preceding-sibling::li[1]", "3"},
+	}
+	for _, c := range cases {
+		if got := evalJoined(t, doc, c.expr); got != c.want {
+			t.Errorf("%s = %q, want %q", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	doc := parseTestPage(t)
+	cases := []struct {
+		expr string
+		want string
+	}{
+		// 节点集函数。
+		{"count(//li)", "4"},
+		{"name(//*[@id='p1'])", "p"},
+		{"local-name(//b)", "b"},
+		{"namespace-uri(//b)", ""},
+		{"count(id('p2 p3'))", "2"},
+		{"string(id('p2')/b)", "bold"},
+		{"count(id('missing'))", "0"},
+		{"string(//p[2])", "Two bold"},
+		{"string(//nothing)", ""},
+		// 字符串函数。
+		{"string-length('héllo')", "5"},
+		{"concat('a', 'b', 1)", "ab1"},
+		{"contains('crawler', 'awl')", "true"},
+		{"starts-with('crawler', 'craw')", "true"},
+		{"substring-before('2024-01', '-')", "2024"},
+		{"substring-after('2024-01', '-')", "01"},
+		{"substring-after('2024-01', '/')", ""},
+		{"substring('12345', 2, 3)", "234"},
+		{"substring('12345', 2)", "2345"},
+		{"substring('12345', 1.5, 2.6)", "234"},
+		{"substring('12345', 0, 3)", "12"},
+		{"substring('12345', 0 div 0, 3)", ""},
+		{"substring('12345', -42, 1 div 0)", "12345"},
+		{"translate('bar', 'abc', 'ABC')", "BAr"},
+		{"translate('--aaa--', 'abc-', 'ABC')", "AAA"},
+		{"normalize-space('  a \t\n b  ')", "a b"},
+		{"normalize-space(//p[2])", "Two bold"},
+		// 布尔函数。
+		{"boolean('')", "false"},
+		{"boolean('0')", "true"},
+		{"boolean(0)", "false"},
+		{"boolean(//li)", "true"},
+		{"boolean(//nothing)", "false"},
+		{"not(1)", "false"},
+		{"true() and false()", "false"},
+		{"true() or false()", "true"},
+		{"count(//p[lang('en')])", "3"},
+		{"count(//p[lang('en-us')])", "1"},
+		{"count(//p[lang('fr')])", "0"},
+		// 数字函数与运算。
+		{"number('  12.5 ')", "12.5"},
+		{"number('abc')", "NaN"},
+		{"number('1e3')", "NaN"},
+		{"sum(//li)", "10"},
+		{"floor(-1.5)", "-2"},
+		{"ceiling(1.2)", "2"},
+		{"round(2.5)", "3"},
+		{"round(-2.5)", "-2"},
+		{"round(-0.4)", "0"},
+		{"1 div 0", "Infinity"},
+		{"-1 div 0", "-Infinity"},
+		{"0 div 0", "NaN"},
+		{"7 mod 3", "1"},
+		{"-7 mod 3", "-1"},
+		{"10 div 4", "2.5"},
+		{"1.5 * 2", "3"},
+		{"1 - -1", "2"},
+		{"1000000 * 1000000", "1000000000000"},
+		{"0.5 + 0.25", "0.75"},
+		// 比较。
+		{"1 = 1.0", "true"},
+		{"'1' = 1", "true"},
+		{"'a' != 'b'", "true"},
+		{"//p = 'Three'", "true"},
+		{"//p != 'Three'", "true"},
+		{"//li > 3", "true"},
+		{"//li > 4", "false"},
+		{"//nothing = //nothing", "false"},
+		{"1 < 2 = true()", "true"},
+		{"0 div 0 = 0 div 0", "false"},
+	}
+	for _, c := range cases {
+		if got := evalJoined(t, doc, c.expr); got != c.want {
+			t.Errorf("%s = %q, want %q", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestContextNode(t *testing.T) {
+	doc := parseTestPage(t)
+	div := MustCompile("//div").Select(doc)
+	if len(div) != 1 {
+		t.Fatalf("Got %d div elements, want 1", len(div))
+	}
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"p/@id", "p1,p2,p3"},
+		{"./p[2]/b", "bold"},
+		{"@id", "main"},
+		{"count(//li)", "4"},
+		{"count(/html)", "1"},
+		{"position()", "1"},
+		{"last()", "1"},
+		{"name()", "div"},
+		{"string-length(name())", "3"},
+		{"count(..)", "1"},
+	}
+	for _, c := range cases {
+		if got := strings.Join(MustCompile(c.expr).SelectStrings(div[0]), ","); got != c.want {
+			t.Errorf("%s = %q, want %q", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	doc := parseTestPage(t)
+	nodes := MustCompile("//p | //b | //p/@id").Select(doc)
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.Data)
+	}
+	// 属性会被忽略，结果按文档顺序排列。
+	if got := strings.Join(names, ","); got != "p,p,b,p" {
+		t.Errorf("Select() = %q, want %q", got, "p,p,b,p")
+	}
+	if nodes := MustCompile("count(//p)").Select(doc); nodes != nil {
+		t.Errorf("Select() of a number = %v, want nil", nodes)
+	}
+	if got := MustCompile("//li").SelectString(doc); got != "1" {
+		t.Errorf("SelectString() = %q, want %q", got, "1")
+	}
+	if !MustCompile("//li[4]").SelectBool(doc) || MustCompile("//li[5]").SelectBool(doc) {
+		t.Error("Unexpected SelectBool() result")
+	}
+	if got := MustCompile("//li").SelectStrings(nil); got != nil {
+		t.Errorf("SelectStrings(nil) = %v, want nil", got)
+	}
+	found, err := Find(doc, "//a")
+	if err != nil || len(found) != 2 {
+		t.Errorf("Find() = %v, %v", found, err)
+	}
+	strs, err := FindStrings(doc, "//a/@href")
+	if err != nil || strings.Join(strs, ",") != "/a,/b" {
+		t.Errorf("FindStrings() = %q, %v", strs, err)
+	}
+	if _, err := Find(doc, "//a["); err == nil {
+		t.Error("Find() with an invalid expression should fail")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"   ",
+		"//",
+		"/a/",
+		"//a[",
+		"//a[1",
+		"//a]",
+		"a[]",
+		"(//a",
+		"//a)",
+		"1 +",
+		"* 2",
+		"'unterminated",
+		"\"unterminated",
+		"$var",
+		"unknown()",
+		"count()",
+		"count(1)",
+		"sum('a')",
+		"concat('a')",
+		"substring('a')",
+		"true(1)",
+		"foo(",
+		"bogus::a",
+		"child::",
+		"@",
+		"1 2",
+		"a b",
+		"//a | 'b'",
+		"a!b",
+		"..[1]",
+	}
+	for _, source := range cases {
+		if e, err := Compile(source); err == nil {
+			t.Errorf("Compile(%q) should fail, got %v", source, e)
+		} else if !strings.Contains(err.Error(), "Invalid xpath") {
+			t.Errorf("Compile(%q) error %q does not name the expression", source, err)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("MustCompile() with an invalid expression should panic")
+		}
+	}()
+	MustCompile("//a[")
+}